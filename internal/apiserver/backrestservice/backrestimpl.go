@@ -16,6 +16,7 @@ limitations under the License.
 */
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -435,7 +436,7 @@ func getInfo(clusterName, storageType, podname, ns string) (string, error) {
 		cmd = append(cmd, repoTypeFlagS3...)
 	}
 
-	output, stderr, err := kubeapi.ExecToPodThroughAPI(apiserver.RESTConfig, apiserver.Clientset, cmd, containername, podname, ns, nil)
+	output, stderr, err := kubeapi.ExecToPodThroughAPI(context.TODO(), apiserver.RESTConfig, apiserver.Clientset, cmd, containername, podname, ns, nil)
 
 	if err != nil {
 		log.Error(err, stderr)
@@ -16,6 +16,7 @@ limitations under the License.
 */
 
 import (
+	"context"
 	"errors"
 	"strings"
 
@@ -115,7 +116,7 @@ func cat(
 
 	log.Debugf("running Exec in namespace=[%s] podname=[%s] container name=[%s] command=[%v]", ns, pod.Name, pod.Spec.Containers[0].Name, command)
 
-	stdout, stderr, err := kubeapi.ExecToPodThroughAPI(restconfig, apiserver.Clientset, command, pod.Spec.Containers[0].Name, pod.Name, ns, nil)
+	stdout, stderr, err := kubeapi.ExecToPodThroughAPI(context.TODO(), restconfig, apiserver.Clientset, command, pod.Spec.Containers[0].Name, pod.Name, ns, nil)
 	if err != nil {
 		log.Error(err)
 		return "error in exec to pod", err
@@ -16,6 +16,7 @@ limitations under the License.
 */
 
 import (
+	"context"
 	"fmt"
 	"strings"
 
@@ -282,7 +283,7 @@ func getPodDf(cluster *crv1.Pgcluster, pod *v1.Pod, podResultsChannel chan msgs.
 
 		cmd := []string{"du", "-s", "--block-size", "1", pvcMountPoint}
 
-		stdout, stderr, err := kubeapi.ExecToPodThroughAPI(apiserver.RESTConfig,
+		stdout, stderr, err := kubeapi.ExecToPodThroughAPI(context.TODO(), apiserver.RESTConfig,
 			apiserver.Clientset, cmd, pvcContainerName, pod.Name, cluster.Spec.Namespace, nil)
 
 		// if the command fails, exit here
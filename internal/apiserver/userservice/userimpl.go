@@ -17,6 +17,7 @@ limitations under the License.
 
 import (
 	"bufio"
+	"context"
 	"fmt"
 	"regexp"
 	"strings"
@@ -692,7 +693,7 @@ func executeSQL(pod *v1.Pod, port, sql string, extraCommandArgs []string) (strin
 	command = append(command, extraCommandArgs...)
 
 	// execute into the primary pod to run the query
-	stdout, stderr, err := kubeapi.ExecToPodThroughAPI(apiserver.RESTConfig,
+	stdout, stderr, err := kubeapi.ExecToPodThroughAPI(context.TODO(), apiserver.RESTConfig,
 		apiserver.Clientset, command,
 		"database", pod.Name, pod.ObjectMeta.Namespace, strings.NewReader(sql))
 
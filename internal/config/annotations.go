@@ -30,6 +30,9 @@ const (
 	ANNOTATION_IS_UPGRADED = "is-upgraded"
 	// annotation to store the Operator versions upgraded from and to
 	ANNOTATION_UPGRADE_INFO = "upgrade-info"
+	// annotation on a PVC that keeps the Operator from deleting it, even when
+	// it carries LABEL_PGREMOVE
+	ANNOTATION_PVC_RETAIN_ON_DELETE = "retain-on-delete"
 	// annotation to store the string boolean, used when checking upgrade status
 	ANNOTATIONS_FALSE = "false"
 )
@@ -83,10 +83,6 @@ var PolicyJobTemplate *template.Template
 
 const policyJobTemplatePath = "pgo.sqlrunner-template.json"
 
-var PVCTemplate *template.Template
-
-const pvcPath = "pvc.json"
-
 var ContainerResourcesTemplate *template.Template
 
 const containerResourcesTemplatePath = "container-resources.json"
@@ -171,13 +167,9 @@ var PgRestoreJobTemplate *template.Template
 
 const pgRestoreJobPath = "pgrestore-job.json"
 
-var PVCMatchLabelsTemplate *template.Template
-
-const pvcMatchLabelsPath = "pvc-matchlabels.json"
-
-var PVCStorageClassTemplate *template.Template
-
-const pvcSCPath = "pvc-storageclass.json"
+// removedPVCTemplatePaths are the files of the templates that PVCs were once
+// created from
+var removedPVCTemplatePaths = []string{"pvc.json", "pvc-matchlabels.json", "pvc-storageclass.json"}
 
 var CollectTemplate *template.Template
 
@@ -549,6 +541,17 @@ func (c *PgoConfig) GetConfig(clientset *kubernetes.Clientset, namespace string)
 
 	c.CheckEnv()
 
+	// PVCs are no longer created from templates, so a customized one would
+	// otherwise be ignored without notice
+	if cMap != nil {
+		for _, name := range removedPVCTemplatePaths {
+			if _, ok := cMap.Data[name]; ok {
+				log.Warnf("%s in the %s ConfigMap is no longer used to create PVCs and is ignored",
+					name, CustomConfigMapName)
+			}
+		}
+	}
+
 	//load up all the templates
 	PgoDefaultServiceAccountTemplate, err = c.LoadTemplate(cMap, rootPath, PGODefaultServiceAccountPath)
 	if err != nil {
@@ -591,11 +594,6 @@ func (c *PgoConfig) GetConfig(clientset *kubernetes.Clientset, namespace string)
 		return err
 	}
 
-	PVCTemplate, err = c.LoadTemplate(cMap, rootPath, pvcPath)
-	if err != nil {
-		return err
-	}
-
 	PolicyJobTemplate, err = c.LoadTemplate(cMap, rootPath, policyJobTemplatePath)
 	if err != nil {
 		return err
@@ -696,16 +694,6 @@ func (c *PgoConfig) GetConfig(clientset *kubernetes.Clientset, namespace string)
 		return err
 	}
 
-	PVCMatchLabelsTemplate, err = c.LoadTemplate(cMap, rootPath, pvcMatchLabelsPath)
-	if err != nil {
-		return err
-	}
-
-	PVCStorageClassTemplate, err = c.LoadTemplate(cMap, rootPath, pvcSCPath)
-	if err != nil {
-		return err
-	}
-
 	AffinityTemplate, err = c.LoadTemplate(cMap, rootPath, affinityTemplatePath)
 	if err != nil {
 		return err
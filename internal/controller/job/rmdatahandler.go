@@ -16,6 +16,7 @@ limitations under the License.
 */
 
 import (
+	"context"
 	"fmt"
 	"time"
 
@@ -74,7 +75,7 @@ func (c *Controller) handleRMDataUpdate(job *apiv1.Job) error {
 	//if a user has specified --archive for a cluster then
 	// an xlog PVC will be present and can be removed
 	pvcName := clusterName + "-xlog"
-	if err := pvc.DeleteIfExists(c.JobClientset, pvcName, job.Namespace); err != nil {
+	if err := pvc.DeleteIfExists(context.TODO(), c.JobClientset, pvcName, job.Namespace, pvc.DeleteOptions{}); err != nil {
 		log.Error(err)
 		return err
 	}
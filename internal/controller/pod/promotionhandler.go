@@ -16,6 +16,7 @@ limitations under the License.
 */
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"strings"
@@ -143,7 +144,7 @@ func waitForStandbyPromotion(restConfig *rest.Config, clientset *kubernetes.Clie
 				cmd := isInRecoveryCMD
 				cmd = append(cmd, cluster.Spec.Port)
 
-				isInRecoveryStr, _, _ := kubeapi.ExecToPodThroughAPI(restConfig, clientset,
+				isInRecoveryStr, _, _ := kubeapi.ExecToPodThroughAPI(context.TODO(), restConfig, clientset,
 					cmd, newPod.Spec.Containers[0].Name, newPod.Name,
 					newPod.Namespace, nil)
 				if strings.Contains(isInRecoveryStr, "f") {
@@ -151,7 +152,7 @@ func waitForStandbyPromotion(restConfig *rest.Config, clientset *kubernetes.Clie
 				}
 			}
 			if recoveryDisabled {
-				primaryJSONStr, _, _ := kubeapi.ExecToPodThroughAPI(restConfig, clientset,
+				primaryJSONStr, _, _ := kubeapi.ExecToPodThroughAPI(context.TODO(), restConfig, clientset,
 					leaderStatusCMD, newPod.Spec.Containers[0].Name, newPod.Name,
 					newPod.Namespace, nil)
 				var primaryJSON map[string]interface{}
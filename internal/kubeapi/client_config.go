@@ -16,6 +16,10 @@ package kubeapi
 */
 
 import (
+	"fmt"
+	"os"
+	"strconv"
+
 	clientset "github.com/crunchydata/postgres-operator/pkg/generated/clientset/versioned"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
@@ -43,14 +47,35 @@ func loadClientConfig() (*rest.Config, error) {
 }
 
 // NewKubeClient returns a Clientset for interacting with Kubernetes resources, along with
-// the REST config used to create the client
+// the REST config used to create the client. The QPS and Burst limits of the client can
+// be set using the PGO_KUBE_QPS and PGO_KUBE_BURST environment variables.
 func NewKubeClient() (*rest.Config, *kubernetes.Clientset, error) {
 
+	qps, burst, err := rateLimitsFromEnv()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return NewKubeClientWithConfig(qps, burst)
+}
+
+// NewKubeClientWithConfig returns a Clientset for interacting with Kubernetes resources
+// that is limited to the provided QPS and Burst, along with the REST config used to create
+// the client. A zero value keeps the client-go default.
+func NewKubeClientWithConfig(qps float32, burst int) (*rest.Config, *kubernetes.Clientset, error) {
+
 	config, err := loadClientConfig()
 	if err != nil {
 		return nil, nil, err
 	}
 
+	if qps != 0 {
+		config.QPS = qps
+	}
+	if burst != 0 {
+		config.Burst = burst
+	}
+
 	clientset, err := createKubeClient(config)
 	if err != nil {
 		return nil, nil, err
@@ -58,6 +83,31 @@ func NewKubeClient() (*rest.Config, *kubernetes.Clientset, error) {
 	return config, clientset, err
 }
 
+// rateLimitsFromEnv parses the PGO_KUBE_QPS and PGO_KUBE_BURST environment variables.
+// A variable that is unset or empty is returned as zero.
+func rateLimitsFromEnv() (float32, int, error) {
+	var qps float32
+	var burst int
+
+	if value := os.Getenv("PGO_KUBE_QPS"); value != "" {
+		parsed, err := strconv.ParseFloat(value, 32)
+		if err != nil || parsed < 0 {
+			return 0, 0, fmt.Errorf("invalid PGO_KUBE_QPS %q", value)
+		}
+		qps = float32(parsed)
+	}
+
+	if value := os.Getenv("PGO_KUBE_BURST"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 0 {
+			return 0, 0, fmt.Errorf("invalid PGO_KUBE_BURST %q", value)
+		}
+		burst = parsed
+	}
+
+	return qps, burst, nil
+}
+
 // NewPGOClient returns a Clientset and a REST client for interacting with PostgreSQL Operator
 // resources, along with the REST config used to create the clients
 func NewPGOClient() (*rest.Config, *rest.RESTClient, *clientset.Clientset, error) {
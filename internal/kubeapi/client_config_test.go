@@ -0,0 +1,111 @@
+package kubeapi
+
+/*
+ Copyright 2020 Crunchy Data Solutions, Inc.
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const testKubeconfig = `
+apiVersion: v1
+kind: Config
+clusters:
+- name: test
+  cluster:
+    server: https://127.0.0.1:6443
+contexts:
+- name: test
+  context:
+    cluster: test
+current-context: test
+`
+
+// setenv sets the environment variable key to value and returns a function
+// that restores its original value.
+func setenv(t *testing.T, key, value string) func() {
+	original, ok := os.LookupEnv(key)
+	if err := os.Setenv(key, value); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return func() {
+		if ok {
+			os.Setenv(key, original)
+		} else {
+			os.Unsetenv(key)
+		}
+	}
+}
+
+func TestNewKubeClientRateLimits(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kubeapi")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	kubeconfig := filepath.Join(dir, "config")
+	if err := ioutil.WriteFile(kubeconfig, []byte(testKubeconfig), 0600); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer setenv(t, "KUBECONFIG", kubeconfig)()
+
+	t.Run("config", func(t *testing.T) {
+		config, _, err := NewKubeClientWithConfig(50, 100)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if config.QPS != 50 || config.Burst != 100 {
+			t.Errorf("expected 50/100, got %v/%v", config.QPS, config.Burst)
+		}
+	})
+
+	t.Run("env", func(t *testing.T) {
+		defer setenv(t, "PGO_KUBE_QPS", "25.5")()
+		defer setenv(t, "PGO_KUBE_BURST", "40")()
+
+		config, _, err := NewKubeClient()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if config.QPS != 25.5 || config.Burst != 40 {
+			t.Errorf("expected 25.5/40, got %v/%v", config.QPS, config.Burst)
+		}
+	})
+
+	t.Run("unset", func(t *testing.T) {
+		defer setenv(t, "PGO_KUBE_QPS", "")()
+		defer setenv(t, "PGO_KUBE_BURST", "")()
+
+		config, _, err := NewKubeClient()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if config.QPS != 0 || config.Burst != 0 {
+			t.Errorf("expected the client-go defaults, got %v/%v", config.QPS, config.Burst)
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		defer setenv(t, "PGO_KUBE_BURST", "lots")()
+
+		if _, _, err := NewKubeClient(); err == nil {
+			t.Error("expected an error")
+		}
+	})
+}
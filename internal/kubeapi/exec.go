@@ -17,25 +17,70 @@ package kubeapi
 
 import (
 	"bytes"
+	"context"
+	"errors"
+	"fmt"
 	"io"
+	"net/http"
 
 	log "github.com/sirupsen/logrus"
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/httpstream"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/remotecommand"
+	"k8s.io/client-go/transport/spdy"
+	utilexec "k8s.io/client-go/util/exec"
 )
 
 // ExecToPodThroughAPI uninterractively exec to the pod with the command specified.
+// :param context.Context ctx: the exec stream is torn down when ctx is done
 // :param string command: list of the str which specify the command.
 // :param string pod_name: Pod name
 // :param string namespace: namespace of the Pod.
 // :param io.Reader stdin: Standerd Input if necessary, otherwise `nil`
 // :return: string: Output of the command. (STDOUT)
 //          string: Errors. (STDERR)
-//           error: If any error has occurred otherwise `nil`
-func ExecToPodThroughAPI(config *rest.Config, clientset kubernetes.Interface, command []string, containerName, podName, namespace string, stdin io.Reader) (string, string, error) {
+//           error: If any error has occurred otherwise `nil`. When ctx is done
+//                  before the command completes, the error wraps ctx.Err(), e.g.
+//                  context.DeadlineExceeded.
+func ExecToPodThroughAPI(ctx context.Context, config *rest.Config, clientset kubernetes.Interface, command []string, containerName, podName, namespace string, stdin io.Reader) (string, string, error) {
+	stdout, stderr, _, err := ExecToPodThroughAPIWithExitCode(ctx, config, clientset, command,
+		containerName, podName, namespace, stdin)
+	return stdout, stderr, err
+}
+
+// ExecToPodThroughAPIWithExitCode is ExecToPodThroughAPI, but it also returns the exit
+// status of the command. The exit status is zero when the command succeeds, and -1 when
+// the command did not run to completion, e.g. when the exec request itself failed.
+// Failures of the exec stream, rather than of the command, are an ExecTransportError.
+func ExecToPodThroughAPIWithExitCode(ctx context.Context, config *rest.Config, clientset kubernetes.Interface, command []string, containerName, podName, namespace string, stdin io.Reader) (string, string, int, error) {
+	var stdout, stderr bytes.Buffer
+	code, err := ExecToPodThroughAPIStream(ctx, config, clientset, command,
+		containerName, podName, namespace, stdin, &stdout, &stderr)
+	return stdout.String(), stderr.String(), code, err
+}
+
+// ExecToPodThroughAPIWithLimit is ExecToPodThroughAPIWithExitCode, but it keeps
+// only the last limit bytes of stdout and of stderr, so that the output of a
+// verbose command is safe to hold. Truncated output begins with a marker that
+// reports how much was dropped. A limit of zero or less keeps all of it.
+func ExecToPodThroughAPIWithLimit(ctx context.Context, config *rest.Config, clientset kubernetes.Interface, command []string, containerName, podName, namespace string, stdin io.Reader, limit int) (string, string, int, error) {
+	stdout, stderr := NewTailBuffer(limit), NewTailBuffer(limit)
+	code, err := ExecToPodThroughAPIStream(ctx, config, clientset, command,
+		containerName, podName, namespace, stdin, stdout, stderr)
+	return stdout.String(), stderr.String(), code, err
+}
+
+// ExecToPodThroughAPIStream is ExecToPodThroughAPIWithExitCode, but it writes the
+// output of the command to stdout and stderr as it arrives rather than returning
+// it once the command completes, e.g. to show the progress of a long command.
+func ExecToPodThroughAPIStream(ctx context.Context, config *rest.Config, clientset kubernetes.Interface, command []string, containerName, podName, namespace string, stdin io.Reader, stdout, stderr io.Writer) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return -1, err
+	}
+
 	req := clientset.CoreV1().RESTClient().Post().
 		Resource("pods").
 		Name(podName).
@@ -44,7 +89,7 @@ func ExecToPodThroughAPI(config *rest.Config, clientset kubernetes.Interface, co
 	scheme := runtime.NewScheme()
 	if err := v1.AddToScheme(scheme); err != nil {
 		log.Error(err)
-		return "", "", err
+		return -1, err
 	}
 
 	parameterCodec := runtime.NewParameterCodec(scheme)
@@ -59,23 +104,167 @@ func ExecToPodThroughAPI(config *rest.Config, clientset kubernetes.Interface, co
 
 	log.Debugf("Request URL: %s", req.URL().String())
 
-	exec, err := remotecommand.NewSPDYExecutor(config, "POST", req.URL())
+	transport, upgrader, err := spdy.RoundTripperFor(config)
 	if err != nil {
+		err = &ExecTransportError{Pod: podName, Err: err}
 		log.Error(err)
-		return "", "", err
+		return -1, err
+	}
+
+	exec, err := remotecommand.NewSPDYExecutorForTransports(transport,
+		contextUpgrader{ctx: ctx, Upgrader: upgrader}, "POST", req.URL())
+	if err != nil {
+		err = &ExecTransportError{Pod: podName, Err: err}
+		log.Error(err)
+		return -1, err
 	}
 
-	var stdout, stderr bytes.Buffer
 	err = exec.Stream(remotecommand.StreamOptions{
 		Stdin:  stdin,
-		Stdout: &stdout,
-		Stderr: &stderr,
+		Stdout: stdout,
+		Stderr: stderr,
 		Tty:    false,
 	})
+	if ctx.Err() != nil {
+		err = fmt.Errorf("exec in pod %s was aborted: %w", podName, ctx.Err())
+	} else if err != nil && exitCode(err) == -1 {
+		err = &ExecTransportError{Pod: podName, Err: err}
+	}
 	if err != nil {
 		log.Error(err)
-		return stdout.String(), stderr.String(), err
+		return exitCode(err), err
 	}
 
-	return stdout.String(), stderr.String(), nil
+	return 0, nil
+}
+
+// ExecTransportError is returned when the exec stream to a pod fails rather
+// than the command run through it, e.g. when the SPDY upgrade is refused or the
+// connection is lost mid-command. The command may or may not have run, but it
+// did not report an exit status.
+type ExecTransportError struct {
+	Pod string
+	Err error
+}
+
+func (e *ExecTransportError) Error() string {
+	return fmt.Sprintf("exec in pod %s failed: %v", e.Pod, e.Err)
+}
+
+func (e *ExecTransportError) Unwrap() error { return e.Err }
+
+// IsExecTransportError returns true when err is or wraps an ExecTransportError.
+func IsExecTransportError(err error) bool {
+	var transportErr *ExecTransportError
+	return errors.As(err, &transportErr)
+}
+
+// exitCode returns the exit status carried by err, or -1 when err does not carry
+// one.
+func exitCode(err error) int {
+	var exitErr utilexec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitStatus()
+	}
+	return -1
+}
+
+// contextUpgrader closes every connection it upgrades once ctx is done. The
+// executor of client-go does not accept a context, so this is how an exec
+// stream is aborted.
+type contextUpgrader struct {
+	spdy.Upgrader
+	ctx context.Context
+}
+
+func (u contextUpgrader) NewConnection(resp *http.Response) (httpstream.Connection, error) {
+	conn, err := u.Upgrader.NewConnection(resp)
+	if err != nil {
+		return conn, err
+	}
+
+	go func() {
+		select {
+		case <-u.ctx.Done():
+			conn.Close()
+		case <-conn.CloseChan():
+		}
+	}()
+
+	return conn, nil
+}
+
+// TailBufferMarker begins the String of a TailBuffer that dropped some of what
+// was written to it. It is formatted with the number of bytes dropped.
+const TailBufferMarker = "[... %d bytes truncated ...]\n"
+
+// TailBuffer is an io.Writer that keeps only the last bytes written to it, up to
+// a limit, in a ring. The zero value keeps everything, like a bytes.Buffer.
+type TailBuffer struct {
+	limit   int
+	ring    []byte
+	start   int
+	written int64
+}
+
+// NewTailBuffer returns a TailBuffer that keeps the last limit bytes written to
+// it. A limit of zero or less keeps everything.
+func NewTailBuffer(limit int) *TailBuffer {
+	return &TailBuffer{limit: limit}
+}
+
+// Write keeps the end of p, discarding the oldest bytes once the limit is
+// reached. It never fails.
+func (b *TailBuffer) Write(p []byte) (int, error) {
+	n := len(p)
+	b.written += int64(n)
+
+	switch {
+	case b.limit <= 0:
+		b.ring = append(b.ring, p...)
+		return n, nil
+
+	case n >= b.limit:
+		b.ring = append(b.ring[:0], p[n-b.limit:]...)
+		b.start = 0
+		return n, nil
+
+	case len(b.ring) < b.limit:
+		room := b.limit - len(b.ring)
+		if n <= room {
+			b.ring = append(b.ring, p...)
+			return n, nil
+		}
+		b.ring = append(b.ring, p[:room]...)
+		p = p[room:]
+	}
+
+	// the ring is full; overwrite the oldest bytes
+	for len(p) > 0 {
+		copied := copy(b.ring[b.start:], p)
+		p = p[copied:]
+		b.start = (b.start + copied) % b.limit
+	}
+	return n, nil
+}
+
+// Bytes returns the bytes that were kept, oldest first.
+func (b *TailBuffer) Bytes() []byte {
+	kept := make([]byte, 0, len(b.ring))
+	kept = append(kept, b.ring[b.start:]...)
+	return append(kept, b.ring[:b.start]...)
+}
+
+// Truncated returns the number of bytes that were written but not kept.
+func (b *TailBuffer) Truncated() int64 {
+	return b.written - int64(len(b.ring))
+}
+
+// String returns the bytes that were kept, preceded by TailBufferMarker when
+// any were dropped.
+func (b *TailBuffer) String() string {
+	if truncated := b.Truncated(); truncated > 0 {
+		return fmt.Sprintf(TailBufferMarker, truncated) + string(b.Bytes())
+	}
+	return string(b.Bytes())
 }
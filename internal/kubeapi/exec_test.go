@@ -0,0 +1,262 @@
+package kubeapi
+
+/*
+ Copyright 2020 Crunchy Data Solutions, Inc.
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/httpstream"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	utilexec "k8s.io/client-go/util/exec"
+)
+
+// testConnection is an httpstream.Connection that records when it is closed
+type testConnection struct {
+	httpstream.Connection
+	once   sync.Once
+	closed chan bool
+}
+
+func (c *testConnection) Close() error {
+	c.once.Do(func() { close(c.closed) })
+	return nil
+}
+
+func (c *testConnection) CloseChan() <-chan bool { return c.closed }
+
+// testUpgrader returns conn from every upgrade
+type testUpgrader struct{ conn *testConnection }
+
+func (u testUpgrader) NewConnection(*http.Response) (httpstream.Connection, error) {
+	return u.conn, nil
+}
+
+func TestContextUpgrader(t *testing.T) {
+	t.Run("canceled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		conn := &testConnection{closed: make(chan bool)}
+
+		if _, err := (contextUpgrader{ctx: ctx, Upgrader: testUpgrader{conn}}).NewConnection(nil); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		cancel()
+
+		select {
+		case <-conn.closed:
+		case <-time.After(5 * time.Second):
+			t.Fatal("expected the connection to be closed")
+		}
+	})
+
+	t.Run("completed", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		conn := &testConnection{closed: make(chan bool)}
+
+		if _, err := (contextUpgrader{ctx: ctx, Upgrader: testUpgrader{conn}}).NewConnection(nil); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		select {
+		case <-conn.closed:
+			t.Fatal("expected the connection to stay open")
+		case <-time.After(100 * time.Millisecond):
+		}
+
+		// closing the connection ends the watch without waiting on ctx
+		conn.Close()
+	})
+}
+
+func TestExecToPodThroughAPICanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, _, err := ExecToPodThroughAPI(ctx, nil, nil, []string{"true"}, "database", "pod", "ns", nil); err != context.Canceled {
+		t.Errorf("expected %v, got %v", context.Canceled, err)
+	}
+}
+
+func TestExecToPodThroughAPIStreamCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	var stdout, stderr bytes.Buffer
+	code, err := ExecToPodThroughAPIStream(ctx, nil, nil, []string{"true"}, "database", "pod", "ns", nil, &stdout, &stderr)
+	if err != context.Canceled || code != -1 {
+		t.Errorf("expected %v and -1, got %v and %d", context.Canceled, err, code)
+	}
+	if stdout.Len() != 0 || stderr.Len() != 0 {
+		t.Errorf("expected no output, got %q and %q", stdout.String(), stderr.String())
+	}
+}
+
+func TestExecToPodThroughAPIStreamTransportError(t *testing.T) {
+	// the API server refuses to upgrade the exec request to SPDY
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "Upgrade request required", http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	config := &rest.Config{Host: server.URL}
+	clientset, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	code, err := ExecToPodThroughAPIStream(context.Background(), config, clientset,
+		[]string{"true"}, "database", "pod", "ns", nil, &stdout, &stderr)
+
+	var transportErr *ExecTransportError
+	if !errors.As(err, &transportErr) {
+		t.Fatalf("expected an ExecTransportError, got %T: %v", err, err)
+	}
+	if transportErr.Pod != "pod" {
+		t.Errorf("expected pod %q, got %q", "pod", transportErr.Pod)
+	}
+	if code != -1 {
+		t.Errorf("expected -1, got %d", code)
+	}
+}
+
+func TestIsExecTransportError(t *testing.T) {
+	exited := utilexec.CodeExitError{Err: errors.New("command terminated with exit code 25"), Code: 25}
+	transport := &ExecTransportError{Pod: "pod", Err: errors.New("unable to upgrade connection")}
+
+	for _, tt := range []struct {
+		err      error
+		expected bool
+	}{
+		{transport, true},
+		{fmt.Errorf("backup failed: %w", transport), true},
+		{exited, false},
+		{context.DeadlineExceeded, false},
+		{nil, false},
+	} {
+		if actual := IsExecTransportError(tt.err); actual != tt.expected {
+			t.Errorf("expected %t for %v, got %t", tt.expected, tt.err, actual)
+		}
+	}
+}
+
+func TestExitCode(t *testing.T) {
+	exited := utilexec.CodeExitError{Err: errors.New("command terminated with exit code 25"), Code: 25}
+
+	for _, tt := range []struct {
+		err      error
+		expected int
+	}{
+		{exited, 25},
+		{&exited, 25},
+		{fmt.Errorf("backup failed: %w", exited), 25},
+		{errors.New("unable to upgrade connection"), -1},
+		{context.DeadlineExceeded, -1},
+	} {
+		if actual := exitCode(tt.err); actual != tt.expected {
+			t.Errorf("expected %d for %v, got %d", tt.expected, tt.err, actual)
+		}
+	}
+}
+
+func TestTailBuffer(t *testing.T) {
+	t.Run("large output", func(t *testing.T) {
+		buffer := NewTailBuffer(1024)
+
+		// write a megabyte in uneven chunks, ending with a recognizable line
+		line := strings.Repeat("x", 99) + "\n"
+		var written int
+		for written < 1024*1024 {
+			n, err := buffer.Write([]byte(line))
+			if err != nil || n != len(line) {
+				t.Fatalf("expected %d and no error, got %d and %v", len(line), n, err)
+			}
+			written += n
+		}
+		buffer.Write([]byte("last line\n"))
+		written += len("last line\n")
+
+		if len(buffer.Bytes()) != 1024 {
+			t.Errorf("expected 1024 bytes kept, got %d", len(buffer.Bytes()))
+		}
+		if buffer.Truncated() != int64(written-1024) {
+			t.Errorf("expected %d bytes truncated, got %d", written-1024, buffer.Truncated())
+		}
+
+		output := buffer.String()
+		marker := fmt.Sprintf(TailBufferMarker, written-1024)
+		if !strings.HasPrefix(output, marker) {
+			t.Errorf("expected output to begin with %q, got %q", marker, output[:len(marker)])
+		}
+		if !strings.HasSuffix(output, "x\nlast line\n") {
+			t.Errorf("expected output to end with the last line, got %q", output[len(output)-20:])
+		}
+	})
+
+	t.Run("single large write", func(t *testing.T) {
+		buffer := NewTailBuffer(4)
+		buffer.Write([]byte("ab"))
+		buffer.Write([]byte("cdefgh"))
+
+		if actual := string(buffer.Bytes()); actual != "efgh" {
+			t.Errorf("expected %q, got %q", "efgh", actual)
+		}
+		if buffer.Truncated() != 4 {
+			t.Errorf("expected 4 bytes truncated, got %d", buffer.Truncated())
+		}
+	})
+
+	t.Run("wraps", func(t *testing.T) {
+		buffer := NewTailBuffer(4)
+		for _, chunk := range []string{"abc", "de", "f", "ghi"} {
+			buffer.Write([]byte(chunk))
+		}
+
+		if actual := string(buffer.Bytes()); actual != "fghi" {
+			t.Errorf("expected %q, got %q", "fghi", actual)
+		}
+	})
+
+	t.Run("within limit", func(t *testing.T) {
+		buffer := NewTailBuffer(1024)
+		buffer.Write([]byte("stanza: db\n"))
+
+		if actual := buffer.String(); actual != "stanza: db\n" {
+			t.Errorf("expected no marker, got %q", actual)
+		}
+	})
+
+	t.Run("unbounded", func(t *testing.T) {
+		buffer := NewTailBuffer(0)
+		large := strings.Repeat("x", 1024*1024)
+		buffer.Write([]byte(large))
+
+		if buffer.Truncated() != 0 || buffer.String() != large {
+			t.Errorf("expected all output to be kept, %d bytes truncated", buffer.Truncated())
+		}
+	})
+}
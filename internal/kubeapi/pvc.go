@@ -40,32 +40,37 @@ func GetPVCs(clientset *kubernetes.Clientset, selector, namespace string) (*v1.P
 }
 
 // GetPVC gets a PVC by name
-func GetPVC(clientset *kubernetes.Clientset, name, namespace string) (*v1.PersistentVolumeClaim, error) {
+func GetPVC(clientset kubernetes.Interface, name, namespace string) (*v1.PersistentVolumeClaim, error) {
 	options := meta_v1.GetOptions{}
 	return clientset.CoreV1().PersistentVolumeClaims(namespace).Get(name, options)
 }
 
 // GetPVCIfExists gets a PVC by name. If the PVC does not exist, it returns nils.
-func GetPVCIfExists(clientset *kubernetes.Clientset, name, namespace string) (*v1.PersistentVolumeClaim, error) {
+// Any other error, e.g. Forbidden, is returned with a nil PVC.
+func GetPVCIfExists(clientset kubernetes.Interface, name, namespace string) (*v1.PersistentVolumeClaim, error) {
 	pvc, err := GetPVC(clientset, name, namespace)
-	if err != nil {
-		pvc = nil
-	}
 	if IsNotFound(err) {
-		err = nil
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
 	}
-	return pvc, err
+	return pvc, nil
 }
 
 // DeletePVC deletes a PVC by name
-func DeletePVC(clientset *kubernetes.Clientset, name, namespace string) error {
+func DeletePVC(clientset kubernetes.Interface, name, namespace string) error {
 	delOptions := meta_v1.DeleteOptions{}
 	var delProp meta_v1.DeletionPropagation
 	delProp = meta_v1.DeletePropagationForeground
 	delOptions.PropagationPolicy = &delProp
 
-	//err := clientset.CoreV1().PersistentVolumelaims(namespace).Delete(name, &meta_v1.DeleteOptions{})
-	err := clientset.CoreV1().PersistentVolumeClaims(namespace).Delete(name, &delOptions)
+	return DeletePVCWithOptions(clientset, name, namespace, &delOptions)
+}
+
+// DeletePVCWithOptions deletes a PVC by name using the provided DeleteOptions
+func DeletePVCWithOptions(clientset kubernetes.Interface, name, namespace string, delOptions *meta_v1.DeleteOptions) error {
+	err := clientset.CoreV1().PersistentVolumeClaims(namespace).Delete(name, delOptions)
 	if err != nil {
 		log.Error("error deleting pvc " + err.Error())
 		return err
@@ -0,0 +1,59 @@
+package kubeapi
+
+/*
+ Copyright 2018 - 2020 Crunchy Data Solutions, Inc.
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+import (
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestGetPVCIfExists(t *testing.T) {
+	clientset := fake.NewSimpleClientset(&v1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{Name: "some-pvc", Namespace: "ns"},
+	})
+
+	pvc, err := GetPVCIfExists(clientset, "some-pvc", "ns")
+	if err != nil || pvc == nil || pvc.Name != "some-pvc" {
+		t.Errorf("expected the pvc, got %v and %v", pvc, err)
+	}
+
+	// NotFound means the PVC is absent
+	pvc, err = GetPVCIfExists(clientset, "missing", "ns")
+	if err != nil || pvc != nil {
+		t.Errorf("expected nils, got %v and %v", pvc, err)
+	}
+
+	// any other error is returned
+	clientset.PrependReactor("get", "persistentvolumeclaims",
+		func(k8stesting.Action) (bool, runtime.Object, error) {
+			return true, &v1.PersistentVolumeClaim{}, kerrors.NewForbidden(
+				v1.Resource("persistentvolumeclaims"), "some-pvc", nil)
+		})
+
+	pvc, err = GetPVCIfExists(clientset, "some-pvc", "ns")
+	if !kerrors.IsForbidden(err) || pvc != nil {
+		t.Errorf("expected Forbidden and no pvc, got %v and %v", pvc, err)
+	}
+	if IsNotFound(err) {
+		t.Error("expected Forbidden not to be NotFound")
+	}
+}
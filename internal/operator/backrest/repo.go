@@ -17,6 +17,7 @@ package backrest
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"os"
@@ -95,7 +96,8 @@ func CreateRepoDeployment(clientset *kubernetes.Clientset, namespace string, clu
 		if existing != nil {
 			log.Debugf("pvc [%s] already present, will not recreate", repoName)
 		} else {
-			_, err = pvc.CreatePVC(clientset, &cluster.Spec.BackrestStorage, repoName, cluster.Name, namespace)
+			_, err = pvc.CreateIfNotExists(context.TODO(), clientset, cluster.Spec.BackrestStorage,
+				repoName, cluster.Name, namespace, cluster)
 			if err != nil {
 				return err
 			}
@@ -120,7 +122,7 @@ func CreateRepoDeployment(clientset *kubernetes.Clientset, namespace string, clu
 		PgbackrestS3EnvVars:   operator.GetPgbackrestS3EnvVars(*cluster, clientset, namespace),
 		Name:                  serviceName,
 		ClusterName:           cluster.Name,
-		SecurityContext:       operator.GetPodSecurityContext(cluster.Spec.BackrestStorage.GetSupplementalGroups()),
+		SecurityContext:       operator.GetPodSecurityContext(pvc.SupplementalGroupsFor(cluster.Spec.BackrestStorage)),
 		Replicas:              replicas,
 		PodAntiAffinity: operator.GetPodAntiAffinity(cluster,
 			crv1.PodAntiAffinityDeploymentPgBackRest, cluster.Spec.PodAntiAffinity.PgBackRest),
@@ -17,6 +17,7 @@ package backrest
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"os"
@@ -83,8 +84,8 @@ func Restore(restclient *rest.RESTClient, namespace string, clientset *kubernete
 
 	//create the "to-cluster" PVC to hold the new dataPVC]
 	restoreToName := task.Spec.Parameters[config.LABEL_BACKREST_RESTORE_TO_PVC]
-	dataVolume, walVolume, tablespaceVolumes, err := pvc.CreateMissingPostgreSQLVolumes(
-		clientset, &cluster, namespace, restoreToName, cluster.Spec.PrimaryStorage)
+	dataVolume, walVolume, tablespaceVolumes, _, err := pvc.CreateMissingPostgreSQLVolumes(
+		context.TODO(), clientset, &cluster, namespace, restoreToName, cluster.Spec.PrimaryStorage)
 	if err != nil {
 		log.Error(err)
 		return
@@ -290,8 +291,8 @@ func createRestoredDeployment(restclient *rest.RESTClient, cluster *crv1.Pgclust
 
 	// interpret the storage specs again. the volumes were already created during
 	// the restore job.
-	dataVolume, walVolume, tablespaceVolumes, err := pvc.CreateMissingPostgreSQLVolumes(
-		clientset, cluster, namespace, restoreToName, cluster.Spec.PrimaryStorage)
+	dataVolume, walVolume, tablespaceVolumes, _, err := pvc.CreateMissingPostgreSQLVolumes(
+		context.TODO(), clientset, cluster, namespace, restoreToName, cluster.Spec.PrimaryStorage)
 
 	//primaryLabels := operator.GetPrimaryLabels(cluster.Spec.Name, cluster.Spec.ClusterName, false, cluster.Spec.UserLabels)
 
@@ -17,6 +17,7 @@ package cluster
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -490,7 +491,7 @@ func createPgBackRestRepoSyncJob(clientset *kubernetes.Clientset, namespace stri
 	jobName := fmt.Sprintf(pgBackRestRepoSyncJobNamePrefix, targetClusterName, util.RandStringBytesRmndr(4))
 
 	podSecurityContext := v1.PodSecurityContext{
-		SupplementalGroups: sourcePgcluster.Spec.BackrestStorage.GetSupplementalGroups(),
+		SupplementalGroups: pvc.SupplementalGroupsFor(sourcePgcluster.Spec.BackrestStorage),
 	}
 
 	if !operator.Pgo.Cluster.DisableFSGroup {
@@ -699,8 +700,8 @@ func createPVCs(clientset *kubernetes.Clientset, client *rest.RESTClient,
 		}
 		// the PVCName for pgBackRest is derived from the target cluster name
 		backrestPVCName := fmt.Sprintf(util.BackrestRepoPVCName, targetClusterName)
-		backrestVolume, err = pvc.CreateIfNotExists(clientset,
-			storage, backrestPVCName, targetClusterName, namespace)
+		backrestVolume, err = pvc.CreateIfNotExists(context.TODO(), clientset,
+			storage, backrestPVCName, targetClusterName, namespace, nil)
 	}
 
 	// now create the PVC for the target cluster
@@ -709,13 +710,13 @@ func createPVCs(clientset *kubernetes.Clientset, client *rest.RESTClient,
 		if size := task.Spec.Parameters[util.CloneParameterPVCSize]; size != "" {
 			storage.Size = size
 		}
-		dataVolume, err = pvc.CreateIfNotExists(clientset,
-			storage, targetClusterName, targetClusterName, namespace)
+		dataVolume, err = pvc.CreateIfNotExists(context.TODO(), clientset,
+			storage, targetClusterName, targetClusterName, namespace, nil)
 	}
 
 	if err == nil {
-		walVolume, err = pvc.CreateIfNotExists(clientset,
-			sourcePgcluster.Spec.WALStorage, targetClusterName+"-wal", targetClusterName, namespace)
+		walVolume, err = pvc.CreateIfNotExists(context.TODO(), clientset,
+			sourcePgcluster.Spec.WALStorage, targetClusterName+"-wal", targetClusterName, namespace, nil)
 	}
 
 	// if there are any tablespaces, create PVCs for those
@@ -725,8 +726,8 @@ func createPVCs(clientset *kubernetes.Clientset, client *rest.RESTClient,
 			// generate the tablespace PVC name from the name of the clone cluster and
 			// the name of this tablespace
 			tablespacePVCName := operator.GetTablespacePVCName(targetClusterName, tablespaceName)
-			tablespaceVolumes[tablespaceName], err = pvc.CreateIfNotExists(clientset,
-				storageSpec, tablespacePVCName, targetClusterName, namespace)
+			tablespaceVolumes[tablespaceName], err = pvc.CreateIfNotExists(context.TODO(), clientset,
+				storageSpec, tablespacePVCName, targetClusterName, namespace, nil)
 		}
 	}
 
@@ -896,7 +897,7 @@ func getLinkMap(clientset *kubernetes.Clientset, restConfig *rest.Config, cluste
 
 	// PGVERSION environment variable is available in our PostgreSQL containers.
 	// The following is the same logic we use in shell scripts there.
-	stdout, _, err := kubeapi.ExecToPodThroughAPI(restConfig, clientset,
+	stdout, _, err := kubeapi.ExecToPodThroughAPI(context.TODO(), restConfig, clientset,
 		[]string{"bash", "-c", `
 		if printf '10\n'${PGVERSION} | sort -VC
 		then
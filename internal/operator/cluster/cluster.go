@@ -19,6 +19,7 @@ package cluster
 */
 
 import (
+	"context"
 	"fmt"
 	"strconv"
 	"time"
@@ -70,13 +71,19 @@ func AddClusterBase(clientset *kubernetes.Clientset, client *rest.RESTClient, cl
 		return
 	}
 
-	dataVolume, walVolume, tablespaceVolumes, err := pvc.CreateMissingPostgreSQLVolumes(
-		clientset, cl, namespace, cl.Annotations[config.ANNOTATION_CURRENT_PRIMARY], cl.Spec.PrimaryStorage)
+	volumes, err := pvc.CreateClusterVolumes(
+		context.TODO(), clientset, cl, namespace, cl.Annotations[config.ANNOTATION_CURRENT_PRIMARY], cl.Spec.PrimaryStorage)
 	if err != nil {
 		log.Error(err)
 		publishClusterCreateFailure(cl, err.Error())
 		return
 	}
+	dataVolume, walVolume, tablespaceVolumes := volumes.Data, volumes.WAL, volumes.Tablespaces
+
+	for tablespaceName, storage := range volumes.TablespaceStorage {
+		log.Debugf("tablespace %s of cluster %s uses %s storage, class %q, access modes %v",
+			tablespaceName, cl.Name, storage.StorageType, storage.StorageClass, storage.AccessModes)
+	}
 
 	if err = addClusterCreateMissingService(clientset, cl, namespace); err != nil {
 		log.Error("error in creating primary service " + err.Error())
@@ -227,8 +234,8 @@ func ScaleBase(clientset *kubernetes.Clientset, client *rest.RESTClient, replica
 		return
 	}
 
-	dataVolume, walVolume, tablespaceVolumes, err := pvc.CreateMissingPostgreSQLVolumes(
-		clientset, &cluster, namespace, replica.Spec.Name, replica.Spec.ReplicaStorage)
+	dataVolume, walVolume, tablespaceVolumes, _, err := pvc.CreateMissingPostgreSQLVolumes(
+		context.TODO(), clientset, &cluster, namespace, replica.Spec.Name, replica.Spec.ReplicaStorage)
 	if err != nil {
 		log.Error(err)
 		publishScaleError(namespace, replica.ObjectMeta.Labels[config.LABEL_PGOUSER], &cluster)
@@ -400,8 +407,8 @@ func UpdateTablespaces(clientset *kubernetes.Clientset, restConfig *rest.Config,
 			// and now create it! If it errors, we just need to return, which
 			// potentially leaves things in an inconsistent state, but at this point
 			// only PVC objects have been created
-			tablespaceVolumes[i][tablespaceName], err = pvc.CreateIfNotExists(clientset,
-				storageSpec, tablespacePVCName, cluster.Name, cluster.Namespace)
+			tablespaceVolumes[i][tablespaceName], err = pvc.CreateIfNotExists(context.TODO(), clientset,
+				storageSpec, tablespacePVCName, cluster.Name, cluster.Namespace, cluster)
 			if err != nil {
 				return err
 			}
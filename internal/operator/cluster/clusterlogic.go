@@ -104,7 +104,8 @@ func addClusterCreateDeployments(clientset *kubernetes.Clientset, client *rest.R
 	if cl.Labels[config.LABEL_BACKREST] == "true" {
 		//backrest requires us to turn on archive mode
 		archiveMode = "on"
-		if err := backrest.CreateRepoDeployment(clientset, namespace, cl, true,
+		// the repo PVC was created along with the other volumes of the cluster
+		if err := backrest.CreateRepoDeployment(clientset, namespace, cl, false,
 			0); err != nil {
 			log.Error("could not create backrest repo deployment")
 			return err
@@ -19,6 +19,7 @@ package cluster
 */
 
 import (
+	"context"
 	"fmt"
 	"time"
 
@@ -159,7 +160,7 @@ func promote(
 		"-d '{\"candidate\":\"%s\"}'", config.DEFAULT_PATRONI_PORT, pod.Name)
 
 	log.Debugf("running Exec with namespace=[%s] podname=[%s] container name=[%s]", namespace, pod.Name, pod.Spec.Containers[0].Name)
-	stdout, stderr, err := kubeapi.ExecToPodThroughAPI(restconfig, clientset, command, pod.Spec.Containers[0].Name, pod.Name, namespace, nil)
+	stdout, stderr, err := kubeapi.ExecToPodThroughAPI(context.TODO(), restconfig, clientset, command, pod.Spec.Containers[0].Name, pod.Name, namespace, nil)
 	log.Debugf("stdout=[%s] stderr=[%s]", stdout, stderr)
 	if err != nil {
 		log.Error(err)
@@ -227,7 +228,7 @@ func RemovePrimaryOnRoleChangeTag(clientset *kubernetes.Clientset, restconfig *r
 
 	log.Debugf("running Exec command '%s' with namespace=[%s] podname=[%s] container name=[%s]",
 		command, namespace, pod.Name, pod.Spec.Containers[0].Name)
-	stdout, stderr, err := kubeapi.ExecToPodThroughAPI(restconfig, clientset, command,
+	stdout, stderr, err := kubeapi.ExecToPodThroughAPI(context.TODO(), restconfig, clientset, command,
 		pod.Spec.Containers[0].Name, pod.Name, namespace, nil)
 	log.Debugf("stdout=[%s] stderr=[%s]", stdout, stderr)
 	if err != nil {
@@ -17,6 +17,7 @@ package cluster
 
 import (
 	"bytes"
+	"context"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
@@ -100,7 +101,7 @@ func AddPgAdmin(
 	pvcName := fmt.Sprintf(pgAdminDeploymentFormat, cluster.Name)
 
 	// create the pgAdmin storage volume
-	if _, err := pvc.CreateIfNotExists(clientset, *storageClass, pvcName, cluster.Name, ns); err != nil {
+	if _, err := pvc.CreateIfNotExists(context.TODO(), clientset, *storageClass, pvcName, cluster.Name, ns, cluster); err != nil {
 		log.Errorf("Error creating PVC: %s", err.Error())
 		return err
 	} else {
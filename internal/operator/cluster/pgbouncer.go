@@ -18,6 +18,7 @@ package cluster
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"os"
@@ -366,7 +367,7 @@ func UninstallPgBouncer(clientset *kubernetes.Clientset, restconfig *rest.Config
 	cmd := []string{"psql", "-p", cluster.Spec.Port}
 
 	// exec into the pod to run the query
-	_, stderr, err := kubeapi.ExecToPodThroughAPI(restconfig, clientset,
+	_, stderr, err := kubeapi.ExecToPodThroughAPI(context.TODO(), restconfig, clientset,
 		cmd, "database", pod.Name, pod.ObjectMeta.Namespace, sql)
 
 	// if there is an error executing the command, log the error message from
@@ -431,7 +432,7 @@ func checkPgBouncerInstall(clientset *kubernetes.Clientset, restconfig *rest.Con
 	cmd := []string{"psql", "-A", "-t", "-p", port}
 
 	// exec into the pod to run the query
-	stdout, stderr, err := kubeapi.ExecToPodThroughAPI(restconfig, clientset,
+	stdout, stderr, err := kubeapi.ExecToPodThroughAPI(context.TODO(), restconfig, clientset,
 		cmd, "database", pod.Name, pod.ObjectMeta.Namespace, sql)
 
 	// if there is an error executing the command, log the error message from
@@ -610,7 +611,7 @@ func disablePgBouncer(clientset *kubernetes.Clientset, restconfig *rest.Config,
 	cmd := []string{"psql"}
 
 	// exec into the pod to run the query
-	_, stderr, err := kubeapi.ExecToPodThroughAPI(restconfig, clientset,
+	_, stderr, err := kubeapi.ExecToPodThroughAPI(context.TODO(), restconfig, clientset,
 		cmd, "database", pod.Name, pod.ObjectMeta.Namespace, sql)
 
 	// if there is an error, log the error from the stderr and return the error
@@ -628,7 +629,7 @@ func execPgBouncerScript(clientset *kubernetes.Clientset, restconfig *rest.Confi
 	cmd := []string{"psql", "-p", port, databaseName, "-f", script}
 
 	// exec into the pod to run the query
-	_, stderr, err := kubeapi.ExecToPodThroughAPI(restconfig, clientset,
+	_, stderr, err := kubeapi.ExecToPodThroughAPI(context.TODO(), restconfig, clientset,
 		cmd, "database", pod.Name, pod.ObjectMeta.Namespace, nil)
 
 	// if there is an error executing the command, log the error as a warning
@@ -738,7 +739,7 @@ func getPgBouncerDatabases(clientset *kubernetes.Clientset, restconfig *rest.Con
 	cmd := []string{"psql", "-A", "-t", "-p", port}
 
 	// exec into the pod to run the query
-	stdout, stderr, err := kubeapi.ExecToPodThroughAPI(restconfig, clientset,
+	stdout, stderr, err := kubeapi.ExecToPodThroughAPI(context.TODO(), restconfig, clientset,
 		cmd, "database", pod.Name, pod.ObjectMeta.Namespace, sql)
 
 	// if there is an error executing the command, log the error message from
@@ -16,6 +16,7 @@ limitations under the License.
 */
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -158,8 +159,8 @@ func EnableStandby(clientset *kubernetes.Clientset, cluster crv1.Pgcluster) erro
 		} else {
 			storageSpec = cluster.Spec.ReplicaStorage
 		}
-		if err := pvc.Create(clientset, currPVC.Name, clusterName, &storageSpec,
-			namespace); err != nil {
+		if _, err := pvc.Create(context.TODO(), clientset, currPVC.Name, clusterName, namespace,
+			pvc.CreateOptions{Spec: &storageSpec, Owner: &cluster}); err != nil {
 			log.Error(err)
 			return fmt.Errorf("Unable to create primary PVC while enabling standby mode: %w", err)
 		}
@@ -16,6 +16,7 @@ package config
 */
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -243,7 +244,7 @@ func (l *LocalDB) apply(configName string) error {
 	// add the config name and patroni port as params for the call to the apply & reload script
 	applyCommand := append(applyAndReloadConfigCMD, localConfig, config.DEFAULT_PATRONI_PORT)
 
-	stdout, stderr, err := kubeapi.ExecToPodThroughAPI(l.restConfig, l.kubeclientset, applyCommand,
+	stdout, stderr, err := kubeapi.ExecToPodThroughAPI(context.TODO(), l.restConfig, l.kubeclientset, applyCommand,
 		dbPod.Spec.Containers[0].Name, dbPod.GetName(), namespace, nil)
 
 	if err != nil {
@@ -320,7 +321,7 @@ func (l *LocalDB) getLocalConfigFromCluster(configName string) (*LocalDBConfig,
 	}
 	dbPod := &dbPodList.Items[0]
 
-	stdout, stderr, err := kubeapi.ExecToPodThroughAPI(l.restConfig, l.kubeclientset, readConfigCMD,
+	stdout, stderr, err := kubeapi.ExecToPodThroughAPI(context.TODO(), l.restConfig, l.kubeclientset, readConfigCMD,
 		dbPod.Spec.Containers[0].Name, dbPod.GetName(), namespace, nil)
 	if err != nil {
 		log.Errorf(stderr)
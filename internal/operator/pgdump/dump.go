@@ -17,6 +17,7 @@ package pgdump
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"os"
 
@@ -65,18 +66,21 @@ func Dump(namespace string, clientset *kubernetes.Clientset, client *rest.RESTCl
 	pvcName := task.Spec.Parameters[config.LABEL_PVC_NAME]
 
 	// create the PVC if name is empty or it doesn't exist
-	if !(len(pvcName) > 0) || !pvc.Exists(clientset, pvcName, namespace) {
+	if !(len(pvcName) > 0) || !pvc.Exists(context.TODO(), clientset, pvcName, namespace) {
 
 		// set pvcName if empty - should not be empty as apiserver code should have specified.
 		if !(len(pvcName) > 0) {
 			pvcName = task.Spec.Name + "-pvc"
 		}
 
-		pvcName, err = pvc.CreatePVC(clientset, &task.Spec.StorageSpec, pvcName,
-			task.Spec.Parameters[config.LABEL_PGDUMP_HOST], namespace)
+		volume, err := pvc.CreateIfNotExists(context.TODO(), clientset, task.Spec.StorageSpec, pvcName,
+			task.Spec.Parameters[config.LABEL_PGDUMP_HOST], namespace, nil)
 		if err != nil {
 			log.Error(err.Error())
 		} else {
+			if volume.PersistentVolumeClaimName != "" {
+				pvcName = volume.PersistentVolumeClaimName
+			}
 			log.Info("created backup PVC =" + pvcName + " in namespace " + namespace)
 		}
 	}
@@ -104,7 +108,7 @@ func Dump(namespace string, clientset *kubernetes.Clientset, client *rest.RESTCl
 		TaskName:         taskName,
 		ClusterName:      task.Spec.Parameters[config.LABEL_PG_CLUSTER],
 		PodName:          task.Spec.Parameters[config.LABEL_POD_NAME],
-		SecurityContext:  operator.GetPodSecurityContext(task.Spec.StorageSpec.GetSupplementalGroups()),
+		SecurityContext:  operator.GetPodSecurityContext(pvc.SupplementalGroupsFor(task.Spec.StorageSpec)),
 		Command:          cmd, //??
 		CommandOpts:      task.Spec.Parameters[config.LABEL_PGDUMP_OPTS],
 		CCPImagePrefix:   util.GetValueOrDefault(cluster.Spec.CCPImagePrefix, operator.Pgo.Cluster.CCPImagePrefix),
@@ -17,6 +17,7 @@ package pgdump
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"os"
 
@@ -59,7 +60,7 @@ func Restore(namespace string, clientset *kubernetes.Clientset, restclient *rest
 
 	fromPvcName := task.Spec.Parameters[config.LABEL_PGRESTORE_FROM_PVC]
 
-	if !(len(fromPvcName) > 0) || !pvc.Exists(clientset, fromPvcName, namespace) {
+	if !(len(fromPvcName) > 0) || !pvc.Exists(context.TODO(), clientset, fromPvcName, namespace) {
 		log.Errorf("pgrestore: could not find source pvc required for restore: %s", fromPvcName)
 		return
 	}
@@ -81,7 +82,7 @@ func Restore(namespace string, clientset *kubernetes.Clientset, restclient *rest
 		JobName:             "pgrestore-" + task.Spec.Parameters[config.LABEL_PGRESTORE_FROM_CLUSTER] + "-from-" + fromPvcName + "-" + util.RandStringBytesRmndr(4),
 		TaskName:            taskName,
 		ClusterName:         clusterName,
-		SecurityContext:     operator.GetPodSecurityContext(storage.GetSupplementalGroups()),
+		SecurityContext:     operator.GetPodSecurityContext(pvc.SupplementalGroupsFor(storage)),
 		FromClusterPVCName:  fromPvcName,
 		PgRestoreHost:       task.Spec.Parameters[config.LABEL_PGRESTORE_HOST],
 		PgRestoreDB:         task.Spec.Parameters[config.LABEL_PGRESTORE_DB],
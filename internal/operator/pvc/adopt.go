@@ -0,0 +1,84 @@
+package pvc
+
+/*
+ Copyright 2020 Crunchy Data Solutions, Inc.
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/crunchydata/postgres-operator/internal/config"
+	crv1 "github.com/crunchydata/postgres-operator/pkg/apis/crunchydata.com/v1"
+	log "github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+)
+
+// adopt adds the labels of the Operator to the existing PVC name so that it is
+// managed with clusterName, e.g. when a database is imported onto a PVC that was
+// created by hand. Labels already on the PVC are left as they are, and a PVC
+// that already belongs to a cluster is not changed. A storageSpec that is
+// RetainOnDelete marks the PVC to be retained, as it would on a new PVC.
+func adopt(ctx context.Context, clientset kubernetes.Interface, storageSpec *crv1.PgStorageSpec, name, clusterName, namespace string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	existing, err := clientset.CoreV1().PersistentVolumeClaims(namespace).Get(name, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+
+	if owner, ok := existing.Labels[config.LABEL_PG_CLUSTER]; ok {
+		if owner != clusterName {
+			logFields(name, namespace).WithFields(log.Fields{"cluster": clusterName, "owner": owner}).
+				Warn("pvc belongs to another cluster, not adopting it")
+		}
+		return nil
+	}
+
+	labels := map[string]string{}
+	for key, value := range managedLabels(clusterName) {
+		if _, ok := existing.Labels[key]; !ok {
+			labels[key] = value
+		}
+	}
+
+	metadata := map[string]interface{}{"labels": labels}
+	if storageSpec.RetainOnDelete {
+		metadata["annotations"] = map[string]string{
+			config.ANNOTATION_PVC_RETAIN_ON_DELETE: "true",
+		}
+	}
+
+	patch, err := json.Marshal(map[string]interface{}{"metadata": metadata})
+	if err != nil {
+		return err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if _, err := clientset.CoreV1().PersistentVolumeClaims(namespace).Patch(name,
+		types.MergePatchType, patch); err != nil {
+		return err
+	}
+
+	logFields(name, namespace).WithField("cluster", clusterName).Info("adopted pvc")
+
+	return nil
+}
@@ -0,0 +1,123 @@
+package pvc
+
+/*
+ Copyright 2020 Crunchy Data Solutions, Inc.
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+import (
+	"context"
+	"testing"
+
+	"github.com/crunchydata/postgres-operator/internal/config"
+	crv1 "github.com/crunchydata/postgres-operator/pkg/apis/crunchydata.com/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestCreateIfNotExistsAdopt(t *testing.T) {
+	spec := crv1.PgStorageSpec{
+		AccessMode: "ReadWriteOnce", Size: "1Gi", StorageClass: "standard", StorageType: "dynamic",
+	}
+
+	// patches counts the patch requests sent to clientset
+	patches := func(clientset *fake.Clientset) (count int) {
+		for _, action := range clientset.Actions() {
+			if action.GetVerb() == "patch" {
+				count++
+			}
+		}
+		return
+	}
+
+	t.Run("unlabeled", func(t *testing.T) {
+		existing := newTestPVC("hippo", "ns", "1Gi", "standard")
+		existing.Labels = map[string]string{"imported-from": "legacy"}
+		clientset := fake.NewSimpleClientset(newTestStorageClass("standard", true), existing)
+
+		if _, err := CreateIfNotExists(context.Background(), clientset, spec, "hippo", "hippo", "ns", nil); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		pvc, err := clientset.CoreV1().PersistentVolumeClaims("ns").Get("hippo", metav1.GetOptions{})
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		for key, expected := range map[string]string{
+			config.LABEL_PG_CLUSTER: "hippo",
+			config.LABEL_PGREMOVE:   "true",
+			config.LABEL_VENDOR:     config.LABEL_CRUNCHY,
+			"imported-from":         "legacy",
+		} {
+			if actual := pvc.Labels[key]; actual != expected {
+				t.Errorf("expected label %s=%q, got %q", key, expected, actual)
+			}
+		}
+		if _, ok := pvc.Annotations[config.ANNOTATION_PVC_RETAIN_ON_DELETE]; ok {
+			t.Errorf("expected no retain annotation, got %v", pvc.Annotations)
+		}
+	})
+
+	t.Run("retain on delete", func(t *testing.T) {
+		existing := newTestPVC("hippo", "ns", "1Gi", "standard")
+		existing.Labels = map[string]string{config.LABEL_PGREMOVE: "false"}
+		clientset := fake.NewSimpleClientset(newTestStorageClass("standard", true), existing)
+
+		retained := spec
+		retained.RetainOnDelete = true
+
+		if _, err := CreateIfNotExists(context.Background(), clientset, retained, "hippo", "hippo", "ns", nil); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		pvc, err := clientset.CoreV1().PersistentVolumeClaims("ns").Get("hippo", metav1.GetOptions{})
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if pvc.Labels[config.LABEL_PG_CLUSTER] != "hippo" {
+			t.Errorf("expected the pvc to be adopted, got %v", pvc.Labels)
+		}
+		if pvc.Labels[config.LABEL_PGREMOVE] != "false" {
+			t.Errorf("expected the existing %s label to be kept, got %v", config.LABEL_PGREMOVE, pvc.Labels)
+		}
+		if pvc.Annotations[config.ANNOTATION_PVC_RETAIN_ON_DELETE] != "true" {
+			t.Errorf("expected the retain annotation, got %v", pvc.Annotations)
+		}
+	})
+
+	t.Run("already labeled", func(t *testing.T) {
+		existing := newTestPVC("hippo", "ns", "1Gi", "standard")
+		existing.Labels = managedLabels("hippo")
+		clientset := fake.NewSimpleClientset(newTestStorageClass("standard", true), existing)
+
+		if _, err := CreateIfNotExists(context.Background(), clientset, spec, "hippo", "hippo", "ns", nil); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if count := patches(clientset); count != 0 {
+			t.Errorf("expected no patch, got %d", count)
+		}
+	})
+
+	t.Run("another cluster", func(t *testing.T) {
+		existing := newTestPVC("hippo", "ns", "1Gi", "standard")
+		existing.Labels = map[string]string{config.LABEL_PG_CLUSTER: "rhino"}
+		clientset := fake.NewSimpleClientset(newTestStorageClass("standard", true), existing)
+
+		if _, err := CreateIfNotExists(context.Background(), clientset, spec, "hippo", "hippo", "ns", nil); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if count := patches(clientset); count != 0 {
+			t.Errorf("expected no patch, got %d", count)
+		}
+	})
+}
@@ -0,0 +1,94 @@
+package pvc
+
+/*
+ Copyright 2020 Crunchy Data Solutions, Inc.
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/crunchydata/postgres-operator/internal/kubeapi"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Clone creates the PVC dstName of clusterName as a copy of the PVC srcName in
+// the same namespace. The new PVC is labeled like those of Create, and asks for the same StorageClass, size, and modes as the
+// source and names the source as its data source, which the CSI driver of the
+// StorageClass must support. The source must exist and the destination must
+// not. Any error from the API server, such as one about cloning not being
+// supported, is returned.
+func Clone(ctx context.Context, clientset kubernetes.Interface, srcName, dstName, clusterName, namespace string) (*v1.PersistentVolumeClaim, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	src, err := kubeapi.GetPVCIfExists(clientset, srcName, namespace)
+	if err != nil {
+		return nil, err
+	}
+	if src == nil {
+		return nil, fmt.Errorf("source pvc %s does not exist", srcName)
+	}
+
+	dst, err := kubeapi.GetPVCIfExists(clientset, dstName, namespace)
+	if err != nil {
+		return nil, err
+	}
+	if dst != nil {
+		return nil, fmt.Errorf("destination pvc %s already exists", dstName)
+	}
+
+	clone := newClonePersistentVolumeClaim(src, dstName, clusterName)
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	created, err := clientset.CoreV1().PersistentVolumeClaims(namespace).Create(clone)
+	if err != nil {
+		return nil, fmt.Errorf("unable to clone pvc %s to %s: %w", srcName, dstName, err)
+	}
+
+	logFields(dstName, namespace).WithField("source", srcName).Info("cloned pvc")
+
+	return created, nil
+}
+
+// newClonePersistentVolumeClaim returns a PVC of clusterName named name that
+// copies src.
+func newClonePersistentVolumeClaim(src *v1.PersistentVolumeClaim, name, clusterName string) *v1.PersistentVolumeClaim {
+	return &v1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   name,
+			Labels: managedLabels(clusterName),
+		},
+		Spec: v1.PersistentVolumeClaimSpec{
+			AccessModes:      src.Spec.AccessModes,
+			StorageClassName: src.Spec.StorageClassName,
+			VolumeMode:       src.Spec.VolumeMode,
+			Resources: v1.ResourceRequirements{
+				Requests: v1.ResourceList{
+					v1.ResourceStorage: src.Spec.Resources.Requests[v1.ResourceStorage],
+				},
+			},
+			DataSource: &v1.TypedLocalObjectReference{
+				Kind: "PersistentVolumeClaim",
+				Name: src.Name,
+			},
+		},
+	}
+}
@@ -0,0 +1,110 @@
+package pvc
+
+/*
+ Copyright 2020 Crunchy Data Solutions, Inc.
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/crunchydata/postgres-operator/internal/config"
+	v1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestClone(t *testing.T) {
+	src := newTestPVC("hippo", "ns", "5Gi", "csi-fast")
+	src.Labels = map[string]string{config.LABEL_PG_CLUSTER: "hippo"}
+	src.Spec.AccessModes = []v1.PersistentVolumeAccessMode{v1.ReadWriteOnce}
+
+	t.Run("clone", func(t *testing.T) {
+		clientset := fake.NewSimpleClientset(src)
+
+		created, err := Clone(context.Background(), clientset, "hippo", "hippo-test", "hippo-test", "ns")
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		stored, err := clientset.CoreV1().PersistentVolumeClaims("ns").Get("hippo-test", metav1.GetOptions{})
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if created.Name != stored.Name {
+			t.Errorf("expected %q, got %q", stored.Name, created.Name)
+		}
+
+		ds := stored.Spec.DataSource
+		if ds == nil || ds.Kind != "PersistentVolumeClaim" || ds.Name != "hippo" || ds.APIGroup != nil {
+			t.Errorf("expected the source pvc as the data source, got %+v", ds)
+		}
+		if stored.Spec.StorageClassName == nil || *stored.Spec.StorageClassName != "csi-fast" {
+			t.Errorf("expected storage class csi-fast, got %v", stored.Spec.StorageClassName)
+		}
+		if q := stored.Spec.Resources.Requests[v1.ResourceStorage]; q.String() != "5Gi" {
+			t.Errorf("expected 5Gi, got %q", q.String())
+		}
+		if len(stored.Spec.AccessModes) != 1 || stored.Spec.AccessModes[0] != v1.ReadWriteOnce {
+			t.Errorf("expected ReadWriteOnce, got %v", stored.Spec.AccessModes)
+		}
+		if stored.Labels[config.LABEL_PG_CLUSTER] != "hippo-test" {
+			t.Errorf("expected the clone to belong to its own cluster, got %v", stored.Labels)
+		}
+
+		// the clone is found and removed with the rest of its cluster
+		pvcs, err := List(context.Background(), clientset, "hippo-test", "ns")
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if len(pvcs) != 1 || pvcs[0].Name != "hippo-test" {
+			t.Errorf("expected the clone to be listed, got %v", pvcs)
+		}
+	})
+
+	t.Run("missing source", func(t *testing.T) {
+		_, err := Clone(context.Background(), fake.NewSimpleClientset(), "hippo", "hippo-test", "hippo-test", "ns")
+		if err == nil || !strings.Contains(err.Error(), "source pvc hippo does not exist") {
+			t.Errorf("expected the source to be missing, got %v", err)
+		}
+	})
+
+	t.Run("existing destination", func(t *testing.T) {
+		clientset := fake.NewSimpleClientset(src, newTestPVC("hippo-test", "ns", "1Gi", ""))
+
+		_, err := Clone(context.Background(), clientset, "hippo", "hippo-test", "hippo-test", "ns")
+		if err == nil || !strings.Contains(err.Error(), "hippo-test already exists") {
+			t.Errorf("expected the destination to exist, got %v", err)
+		}
+	})
+
+	t.Run("not supported", func(t *testing.T) {
+		clientset := fake.NewSimpleClientset(src)
+		clientset.PrependReactor("create", "persistentvolumeclaims",
+			func(k8stesting.Action) (bool, runtime.Object, error) {
+				return true, nil, kerrors.NewInvalid(v1.SchemeGroupVersion.WithKind("PersistentVolumeClaim").GroupKind(),
+					"hippo-test", nil)
+			})
+
+		_, err := Clone(context.Background(), clientset, "hippo", "hippo-test", "hippo-test", "ns")
+		if !kerrors.IsInvalid(errors.Unwrap(err)) {
+			t.Errorf("expected the server error to be kept, got %v", err)
+		}
+	})
+}
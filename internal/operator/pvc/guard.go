@@ -0,0 +1,99 @@
+package pvc
+
+/*
+ Copyright 2020 Crunchy Data Solutions, Inc.
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	v1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+// createGuard serializes the creates of each PVC within this process, e.g.
+// when two reconciles of the same cluster run at once. A create that waited
+// for another create of the same PVC to succeed returns AlreadyExists without
+// calling the API server.
+type createGuard struct {
+	sync.Mutex
+	calls map[string]*createCall
+}
+
+// createCall is a create of a PVC that is in progress
+type createCall struct {
+	done chan struct{}
+	err  error
+}
+
+// errCreatePanicked is the result of a create that panicked
+var errCreatePanicked = errors.New("pvc create panicked")
+
+// creates guards the creates of Create
+var creates = &createGuard{calls: map[string]*createCall{}}
+
+// do calls create unless another create of the PVC name in namespace is in
+// progress. It waits for that create and returns AlreadyExists when it
+// succeeded, or calls create when it failed. It returns the error of ctx when
+// ctx is done while waiting.
+func (g *createGuard) do(ctx context.Context, name, namespace string,
+	create func() (*v1.PersistentVolumeClaim, error),
+) (*v1.PersistentVolumeClaim, error) {
+	key := namespace + "/" + name
+
+	for {
+		g.Lock()
+		call, ok := g.calls[key]
+		if !ok {
+			call = &createCall{done: make(chan struct{})}
+			g.calls[key] = call
+			g.Unlock()
+
+			return g.call(key, call, create)
+		}
+		g.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-call.done:
+		}
+
+		if call.err == nil {
+			return nil, kerrors.NewAlreadyExists(v1.Resource("persistentvolumeclaims"), name)
+		}
+	}
+}
+
+// call calls create for the call in progress at key. The call is released when
+// create returns or panics; a create that panicked is a failure, so that those
+// waiting on it call create for themselves.
+func (g *createGuard) call(key string, call *createCall,
+	create func() (*v1.PersistentVolumeClaim, error),
+) (*v1.PersistentVolumeClaim, error) {
+	call.err = errCreatePanicked
+
+	defer func() {
+		g.Lock()
+		delete(g.calls, key)
+		g.Unlock()
+		close(call.done)
+	}()
+
+	created, err := create()
+	call.err = err
+	return created, err
+}
@@ -0,0 +1,165 @@
+package pvc
+
+/*
+ Copyright 2020 Crunchy Data Solutions, Inc.
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	crv1 "github.com/crunchydata/postgres-operator/pkg/apis/crunchydata.com/v1"
+	v1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestCreateConcurrently(t *testing.T) {
+	spec := crv1.PgStorageSpec{AccessMode: "ReadWriteOnce", Size: "1Gi", StorageType: "create"}
+
+	// blocking holds the first create in the API server until release is
+	// closed, so that the others arrive while it is in progress
+	blocking := func(clientset *fake.Clientset, release chan struct{}, result error) <-chan struct{} {
+		entered := make(chan struct{})
+		var once sync.Once
+		clientset.PrependReactor("create", "persistentvolumeclaims", func(k8stesting.Action) (bool, runtime.Object, error) {
+			once.Do(func() { close(entered) })
+			<-release
+			if result != nil {
+				return true, nil, result
+			}
+			return false, nil, nil
+		})
+		return entered
+	}
+	creates := func(clientset *fake.Clientset) int {
+		count := 0
+		for _, action := range clientset.Actions() {
+			if action.GetVerb() == "create" {
+				count++
+			}
+		}
+		return count
+	}
+	run := func(clientset *fake.Clientset, release chan struct{}, entered <-chan struct{}, n int) []error {
+		errs := make([]error, n)
+		var wg sync.WaitGroup
+		start := func(i int) {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				spec := spec
+				_, errs[i] = Create(context.Background(), clientset, "hippo", "hippo", "ns", CreateOptions{Spec: &spec})
+			}()
+		}
+
+		start(0)
+		<-entered
+		for i := 1; i < n; i++ {
+			start(i)
+		}
+
+		// give the others time to find the create in progress
+		time.Sleep(200 * time.Millisecond)
+		close(release)
+		wg.Wait()
+		return errs
+	}
+
+	t.Run("success", func(t *testing.T) {
+		clientset := fake.NewSimpleClientset()
+		release := make(chan struct{})
+		entered := blocking(clientset, release, nil)
+
+		errs := run(clientset, release, entered, 5)
+
+		if errs[0] != nil {
+			t.Errorf("expected the first create to succeed, got %v", errs[0])
+		}
+		for _, err := range errs[1:] {
+			if !kerrors.IsAlreadyExists(err) {
+				t.Errorf("expected AlreadyExists, got %v", err)
+			}
+		}
+		if count := creates(clientset); count != 1 {
+			t.Errorf("expected one create, got %d", count)
+		}
+	})
+
+	t.Run("failure", func(t *testing.T) {
+		clientset := fake.NewSimpleClientset()
+		release := make(chan struct{})
+		entered := blocking(clientset, release,
+			kerrors.NewForbidden(v1.Resource("persistentvolumeclaims"), "hippo", errors.New("quota")))
+
+		errs := run(clientset, release, entered, 3)
+
+		// every create waits its turn and then tries for itself
+		for _, err := range errs {
+			if !kerrors.IsForbidden(err) {
+				t.Errorf("expected Forbidden, got %v", err)
+			}
+		}
+		if count := creates(clientset); count != 3 {
+			t.Errorf("expected three creates, got %d", count)
+		}
+	})
+}
+
+func TestCreateGuardPanic(t *testing.T) {
+	guard := &createGuard{calls: map[string]*createCall{}}
+	entered, release := make(chan struct{}), make(chan struct{})
+
+	go func() {
+		defer func() { _ = recover() }()
+		_, _ = guard.do(context.Background(), "hippo", "ns", func() (*v1.PersistentVolumeClaim, error) {
+			close(entered)
+			<-release
+			panic("boom")
+		})
+	}()
+
+	<-entered
+	result := make(chan error, 1)
+	go func() {
+		_, err := guard.do(context.Background(), "hippo", "ns", func() (*v1.PersistentVolumeClaim, error) {
+			return &v1.PersistentVolumeClaim{}, nil
+		})
+		result <- err
+	}()
+
+	// give the second create time to find the first in progress
+	time.Sleep(100 * time.Millisecond)
+	close(release)
+
+	select {
+	case err := <-result:
+		if err != nil {
+			t.Errorf("expected the waiting create to succeed, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the waiting create to be released")
+	}
+
+	guard.Lock()
+	defer guard.Unlock()
+	if len(guard.calls) != 0 {
+		t.Errorf("expected no calls in progress, got %v", guard.calls)
+	}
+}
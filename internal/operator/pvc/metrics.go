@@ -0,0 +1,82 @@
+package pvc
+
+/*
+ Copyright 2020 Crunchy Data Solutions, Inc.
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+// The values of the "result" label of the PVC metrics
+const (
+	metricResultSuccess = "success"
+	metricResultFailure = "failure"
+	metricResultExists  = "exists"
+	metricResultSkipped = "skipped"
+)
+
+var (
+	// createTotal counts the volumes resolved from a storage specification, by
+	// the StorageType of the specification and whether it succeeded. Nothing is
+	// created for "emptydir" and "existing" storage, so those that resolve are
+	// "skipped" and "success" counts only PVCs the API server created
+	createTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "pvc_create_total",
+		Help: "Number of PVC create operations by storage type and result.",
+	}, []string{"storage_type", "result"})
+
+	// createDuration measures how long it takes the API server to accept a PVC,
+	// including any retries
+	createDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "pvc_create_duration_seconds",
+		Help:    "Time taken to create a PVC, in seconds.",
+		Buckets: prometheus.DefBuckets,
+	})
+
+	// deleteTotal counts the PVC delete operations by their result
+	deleteTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "pvc_delete_total",
+		Help: "Number of PVC delete operations by result.",
+	}, []string{"result"})
+)
+
+func init() {
+	prometheus.MustRegister(createTotal, createDuration, deleteTotal)
+}
+
+// createResult is the "result" label of a create that returned err
+func createResult(err error) string {
+	switch {
+	case err == nil:
+		return metricResultSuccess
+	case kerrors.IsAlreadyExists(err):
+		return metricResultExists
+	default:
+		return metricResultFailure
+	}
+}
+
+// deleteResult is the "result" label of a delete that returned deleted and err
+func deleteResult(deleted bool, err error) string {
+	switch {
+	case err != nil:
+		return metricResultFailure
+	case deleted:
+		return metricResultSuccess
+	default:
+		return metricResultSkipped
+	}
+}
@@ -0,0 +1,164 @@
+package pvc
+
+/*
+ Copyright 2020 Crunchy Data Solutions, Inc.
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/crunchydata/postgres-operator/internal/config"
+	crv1 "github.com/crunchydata/postgres-operator/pkg/apis/crunchydata.com/v1"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	v1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestCreateMetrics(t *testing.T) {
+	// the metrics are global, so compare against what they were at the start
+	count := func(storageType, result string) float64 {
+		return testutil.ToFloat64(createTotal.WithLabelValues(storageType, result))
+	}
+
+	t.Run("success", func(t *testing.T) {
+		for _, storageType := range []string{"create", "dynamic"} {
+			before := count(storageType, metricResultSuccess)
+			spec := crv1.PgStorageSpec{AccessMode: "ReadWriteOnce", Size: "1G", StorageType: storageType}
+
+			if _, err := Create(context.Background(), fake.NewSimpleClientset(), "some-pvc", "some-cluster", "ns", CreateOptions{Spec: &spec}); err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if actual := count(storageType, metricResultSuccess); actual != before+1 {
+				t.Errorf("expected %v %s successes, got %v", before+1, storageType, actual)
+			}
+		}
+	})
+
+	t.Run("failure", func(t *testing.T) {
+		before := count("dynamic", metricResultFailure)
+		spec := crv1.PgStorageSpec{AccessMode: "ReadWriteOnce", Size: "1G", StorageType: "dynamic"}
+
+		clientset := fake.NewSimpleClientset()
+		clientset.PrependReactor("create", "persistentvolumeclaims",
+			func(k8stesting.Action) (bool, runtime.Object, error) {
+				return true, nil, kerrors.NewForbidden(v1.Resource("persistentvolumeclaims"), "some-pvc",
+					errors.New("exceeded quota"))
+			})
+
+		if _, err := Create(context.Background(), clientset, "some-pvc", "some-cluster", "ns", CreateOptions{Spec: &spec}); err == nil {
+			t.Fatal("expected an error")
+		}
+		if actual := count("dynamic", metricResultFailure); actual != before+1 {
+			t.Errorf("expected %v failures, got %v", before+1, actual)
+		}
+	})
+
+	t.Run("exists", func(t *testing.T) {
+		before := count("create", metricResultExists)
+		spec := crv1.PgStorageSpec{AccessMode: "ReadWriteOnce", Size: "1G", StorageType: "create"}
+		clientset := fake.NewSimpleClientset(newTestPVC("some-pvc", "ns", "1G", ""))
+
+		if _, err := CreateIfNotExists(context.Background(), clientset, spec, "some-pvc", "some-cluster", "ns", nil); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if actual := count("create", metricResultExists); actual != before+1 {
+			t.Errorf("expected %v existing, got %v", before+1, actual)
+		}
+	})
+
+	t.Run("emptydir and existing", func(t *testing.T) {
+		for _, spec := range []crv1.PgStorageSpec{
+			{StorageType: "emptydir"},
+			{StorageType: "existing", Name: "mine"},
+		} {
+			before := count(spec.StorageType, metricResultSuccess)
+			skipped := count(spec.StorageType, metricResultSkipped)
+			if _, err := CreateIfNotExists(context.Background(), fake.NewSimpleClientset(), spec, "some-pvc", "some-cluster", "ns", nil); err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if actual := count(spec.StorageType, metricResultSuccess); actual != before {
+				t.Errorf("expected %v %s successes, got %v", before, spec.StorageType, actual)
+			}
+			if actual := count(spec.StorageType, metricResultSkipped); actual != skipped+1 {
+				t.Errorf("expected %v %s skipped, got %v", skipped+1, spec.StorageType, actual)
+			}
+		}
+
+		before := count("emptydir", metricResultFailure)
+		if _, err := CreateIfNotExists(context.Background(), fake.NewSimpleClientset(),
+			crv1.PgStorageSpec{StorageType: "emptydir", Size: "lots"}, "some-pvc", "some-cluster", "ns", nil); err == nil {
+			t.Fatal("expected an error")
+		}
+		if actual := count("emptydir", metricResultFailure); actual != before+1 {
+			t.Errorf("expected %v emptydir failures, got %v", before+1, actual)
+		}
+	})
+
+	t.Run("dry run", func(t *testing.T) {
+		clientset, server, _ := newDryRunClientset(t)
+		defer server.Close()
+
+		before := count("dynamic", metricResultSuccess)
+		spec := crv1.PgStorageSpec{AccessMode: "ReadWriteOnce", Size: "1G", StorageType: "dynamic"}
+		if _, err := Create(context.Background(), clientset, "some-pvc", "some-cluster", "ns", CreateOptions{Spec: &spec, DryRun: true}); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if actual := count("dynamic", metricResultSuccess); actual != before {
+			t.Errorf("expected a dry run not to be counted, got %v", actual)
+		}
+	})
+}
+
+func TestDeleteMetrics(t *testing.T) {
+	count := func(result string) float64 {
+		return testutil.ToFloat64(deleteTotal.WithLabelValues(result))
+	}
+
+	removable := newTestPVC("some-pvc", "ns", "1G", "")
+	removable.Labels = map[string]string{config.LABEL_PGREMOVE: "true"}
+
+	before := count(metricResultSuccess)
+	if err := DeleteIfExists(context.Background(), fake.NewSimpleClientset(removable), "some-pvc", "ns", DeleteOptions{}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if actual := count(metricResultSuccess); actual != before+1 {
+		t.Errorf("expected %v deletes, got %v", before+1, actual)
+	}
+
+	before = count(metricResultSkipped)
+	if err := DeleteIfExists(context.Background(), fake.NewSimpleClientset(), "some-pvc", "ns", DeleteOptions{}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if actual := count(metricResultSkipped); actual != before+1 {
+		t.Errorf("expected %v skipped, got %v", before+1, actual)
+	}
+
+	before = count(metricResultFailure)
+	clientset := fake.NewSimpleClientset(removable)
+	clientset.PrependReactor("delete", "persistentvolumeclaims",
+		func(k8stesting.Action) (bool, runtime.Object, error) {
+			return true, nil, kerrors.NewInternalError(errors.New("etcd is down"))
+		})
+	if err := DeleteIfExists(context.Background(), clientset, "some-pvc", "ns", DeleteOptions{}); err == nil {
+		t.Fatal("expected an error")
+	}
+	if actual := count(metricResultFailure); actual != before+1 {
+		t.Errorf("expected %v failures, got %v", before+1, actual)
+	}
+}
@@ -0,0 +1,61 @@
+package pvc
+
+/*
+ Copyright 2020 Crunchy Data Solutions, Inc.
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+import (
+	"sync"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+// Mutator changes a PVC that Create is about to submit, e.g. to add an
+// annotation that a CSI driver requires.
+type Mutator func(*v1.PersistentVolumeClaim)
+
+// mutatorRegistry holds the Mutators of each storage type. The Mutators of
+// every PVC are kept under the empty storage type.
+type mutatorRegistry struct {
+	sync.RWMutex
+	mutators map[string][]Mutator
+}
+
+// mutators are the Mutators applied by Create
+var mutators = &mutatorRegistry{mutators: map[string][]Mutator{}}
+
+// RegisterMutator adds mutator to the PVCs that Create builds from a storage
+// spec of storageType, or to every PVC when storageType is empty. Mutators run
+// in the order they are registered, those of every PVC first.
+func RegisterMutator(storageType string, mutator Mutator) {
+	mutators.Lock()
+	defer mutators.Unlock()
+
+	mutators.mutators[storageType] = append(mutators.mutators[storageType], mutator)
+}
+
+// mutate applies the Mutators of storageType to pvc
+func (r *mutatorRegistry) mutate(storageType string, pvc *v1.PersistentVolumeClaim) {
+	r.RLock()
+	defer r.RUnlock()
+
+	for _, mutator := range r.mutators[""] {
+		mutator(pvc)
+	}
+	if storageType != "" {
+		for _, mutator := range r.mutators[storageType] {
+			mutator(pvc)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package pvc
+
+/*
+ Copyright 2020 Crunchy Data Solutions, Inc.
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	crv1 "github.com/crunchydata/postgres-operator/pkg/apis/crunchydata.com/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestRegisterMutator(t *testing.T) {
+	defer func(registry *mutatorRegistry) { mutators = registry }(mutators)
+	mutators = &mutatorRegistry{mutators: map[string][]Mutator{}}
+
+	annotate := func(key, value string) Mutator {
+		return func(pvc *v1.PersistentVolumeClaim) {
+			if pvc.Annotations == nil {
+				pvc.Annotations = map[string]string{}
+			}
+			// keep the order the mutators ran in
+			pvc.Annotations["order"] += key
+			pvc.Annotations[key] = value
+		}
+	}
+
+	RegisterMutator("", annotate("csi.example.com/everywhere", "true"))
+	RegisterMutator("dynamic", annotate("csi.example.com/dynamic", "true"))
+
+	clientset := fake.NewSimpleClientset(newTestStorageClass("standard", false))
+
+	t.Run("dynamic", func(t *testing.T) {
+		spec := crv1.PgStorageSpec{AccessMode: "ReadWriteOnce", Size: "1Gi", StorageType: "dynamic", StorageClass: "standard"}
+		created, err := Create(context.Background(), clientset, "hippo", "hippo", "ns", CreateOptions{Spec: &spec})
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		expected := map[string]string{
+			"csi.example.com/everywhere": "true",
+			"csi.example.com/dynamic":    "true",
+			"order":                      "csi.example.com/everywherecsi.example.com/dynamic",
+		}
+		if !reflect.DeepEqual(created.Annotations, expected) {
+			t.Errorf("expected %v, got %v", expected, created.Annotations)
+		}
+	})
+
+	t.Run("create", func(t *testing.T) {
+		spec := crv1.PgStorageSpec{AccessMode: "ReadWriteOnce", Size: "1Gi", StorageType: "create"}
+		created, err := Create(context.Background(), clientset, "hippo-wal", "hippo", "ns", CreateOptions{Spec: &spec})
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		if _, ok := created.Annotations["csi.example.com/dynamic"]; ok {
+			t.Error("expected only the mutators of every pvc")
+		}
+		if created.Annotations["csi.example.com/everywhere"] != "true" {
+			t.Errorf("expected the mutator of every pvc, got %v", created.Annotations)
+		}
+	})
+}
@@ -16,86 +16,656 @@ package pvc
 */
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
-	"os"
+	"fmt"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/crunchydata/postgres-operator/internal/config"
 	"github.com/crunchydata/postgres-operator/internal/kubeapi"
 	"github.com/crunchydata/postgres-operator/internal/operator"
+	"github.com/crunchydata/postgres-operator/internal/util"
 	crv1 "github.com/crunchydata/postgres-operator/pkg/apis/crunchydata.com/v1"
 	log "github.com/sirupsen/logrus"
 	v1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
 )
 
-type matchLabelsTemplateFields struct {
-	Key   string
-	Value string
+// snapshotAPIGroup is the API group of the CSI VolumeSnapshot resource
+const snapshotAPIGroup = "snapshot.storage.k8s.io"
+
+// tablespacePVCName generates the PVC name of a tablespace
+var tablespacePVCName = operator.GetTablespacePVCName
+
+// PollOptions determine how often WaitForBound and DeleteIfExistsAndWait check
+// a PVC.
+type PollOptions struct {
+	// Interval is the least amount of time between two checks.
+	Interval time.Duration
+
+	// JitterFactor makes each wait a random amount longer than Interval, up to
+	// Interval times JitterFactor, so that many waits across clusters do not
+	// poll the API server in lockstep. Zero disables jitter.
+	JitterFactor float64
 }
 
-// TemplateFields ...
-type TemplateFields struct {
-	Name         string
-	AccessMode   string
-	ClusterName  string
-	Size         string
-	StorageClass string
-	MatchLabels  string
+// DefaultPollOptions check a PVC about every half second.
+var DefaultPollOptions = PollOptions{
+	Interval:     500 * time.Millisecond,
+	JitterFactor: 0.5,
+}
+
+// errPollTimeout is returned by poll when its timeout elapses
+var errPollTimeout = errors.New("timed out")
+
+// poll calls condition right away and then after each jittered interval of
+// DefaultPollOptions until it returns true or an error. It returns
+// errPollTimeout when condition is still false after timeout, and the error of
+// ctx when ctx is done first.
+func poll(ctx context.Context, timeout time.Duration, condition func() (bool, error)) error {
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+
+	for {
+		if done, err := condition(); err != nil || done {
+			return err
+		}
+
+		next := time.NewTimer(wait.Jitter(DefaultPollOptions.Interval, DefaultPollOptions.JitterFactor))
+
+		select {
+		case <-ctx.Done():
+			next.Stop()
+			return ctx.Err()
+		case <-deadline.C:
+			next.Stop()
+			return errPollTimeout
+		case <-next.C:
+		}
+	}
+}
+
+// annotationDefaultStorageClass marks the StorageClass of a PVC that does not
+// name one
+const annotationDefaultStorageClass = "storageclass.kubernetes.io/is-default-class"
+
+// annotationSelectedNode is set on a PVC once the scheduler has picked the node
+// of its first consumer
+const annotationSelectedNode = "volume.kubernetes.io/selected-node"
+
+// ErrStorageMismatch is returned when an existing PVC differs from the storage
+// specification that would have created it.
+var ErrStorageMismatch = errors.New("existing pvc does not match its storage specification")
+
+// ErrClusterMismatch is returned when a PVC to be deleted does not belong to
+// the expected cluster.
+var ErrClusterMismatch = errors.New("pvc does not belong to the expected cluster")
+
+// VolumeCreateError identifies the volume that CreateMissingPostgreSQLVolumes
+// or CreateClusterVolumes was unable to create.
+type VolumeCreateError struct {
+	// Role is one of "data", "wal", "tablespace", or "repo".
+	Role string
+
+	// Name is the name of the tablespace when Role is "tablespace", and the
+	// name of the PVC otherwise.
+	Name string
+
+	Err error
+}
+
+func (e *VolumeCreateError) Error() string {
+	return fmt.Sprintf("unable to create %s volume %s: %v", e.Role, e.Name, e.Err)
+}
+
+func (e *VolumeCreateError) Unwrap() error { return e.Err }
+
+// CreateOptions describe a PVC to create and how it is submitted to the API
+// server. Everything other than Spec is optional.
+type CreateOptions struct {
+	// Spec is the storage specification of the PVC. It is required.
+	Spec *crv1.PgStorageSpec
+
+	// Owner, when not nil, is the cluster the PVC is created for. A PVC whose
+	// Spec is OwnedByCluster is owned by Owner and garbage collected with it.
+	Owner *crv1.Pgcluster
+
+	// DryRun asks the API server to validate the PVC without persisting it.
+	DryRun bool
+
+	// Backoff determines how often a PVC is submitted again after a transient
+	// server error. When nil, DefaultCreateBackoff is used.
+	Backoff *wait.Backoff
+
+	// Recorder, when not nil, records an Event on Owner when the PVC is
+	// created or fails to be created. Nothing is recorded for a dry run.
+	Recorder record.EventRecorder
+}
+
+// errSpecRequired is returned when CreateOptions have no Spec
+var errSpecRequired = errors.New("a storage spec is required to create a pvc")
+
+// Reasons of the Events recorded by Create
+const (
+	EventReasonCreated      = "PVCCreated"
+	EventReasonCreateFailed = "PVCCreateFailed"
+)
+
+// DefaultCreateBackoff retries a PVC a handful of times over a few seconds,
+// which is enough to ride out a rolling restart of the API server.
+var DefaultCreateBackoff = wait.Backoff{
+	Steps:    5,
+	Duration: 500 * time.Millisecond,
+	Factor:   2.0,
+	Jitter:   0.1,
+}
+
+// DeleteOptions modify how a PVC is deleted. The zero value deletes in the
+// foreground with the default grace period.
+type DeleteOptions struct {
+	// PropagationPolicy is one of Foreground, Background, or Orphan. When
+	// empty, Foreground is used.
+	PropagationPolicy metav1.DeletionPropagation
+
+	// GracePeriodSeconds overrides the default grace period when it is not nil.
+	// Zero deletes immediately.
+	GracePeriodSeconds *int64
+
+	// ClusterName, when not empty, is the cluster the PVC must belong to. A
+	// PVC whose pg-cluster label is missing or different is not deleted, and
+	// ErrClusterMismatch is returned.
+	ClusterName string
 }
 
 // CreateMissingPostgreSQLVolumes converts the storage specifications of cluster
 // related to PostgreSQL into StorageResults. When a specification calls for a
-// PVC to be created, the PVC is created unless it already exists.
-func CreateMissingPostgreSQLVolumes(clientset *kubernetes.Clientset,
+// PVC to be created, the PVC is created unless it already exists. When a volume
+// fails, the error is a *VolumeCreateError and the volumes handled before it
+// are still returned so they can be cleaned up. The storage class and access
+// mode of every tablespace is summarized in tablespaceStorage, even when a
+// volume fails.
+func CreateMissingPostgreSQLVolumes(ctx context.Context, clientset kubernetes.Interface,
 	cluster *crv1.Pgcluster, namespace string,
 	pvcNamePrefix string, dataStorageSpec crv1.PgStorageSpec,
 ) (
 	dataVolume, walVolume operator.StorageResult,
 	tablespaceVolumes map[string]operator.StorageResult,
+	tablespaceStorage map[string]TablespaceStorage,
 	err error,
 ) {
-	dataVolume, err = CreateIfNotExists(clientset,
-		dataStorageSpec, pvcNamePrefix, cluster.Spec.Name, namespace)
+	return createMissingPostgreSQLVolumes(ctx, clientset,
+		cluster, namespace, pvcNamePrefix, dataStorageSpec, CreateOptions{}, nil, nil)
+}
+
+// ClusterVolumes are the volumes of a cluster resolved by CreateClusterVolumes.
+type ClusterVolumes struct {
+	Data        operator.StorageResult
+	WAL         operator.StorageResult
+	Tablespaces map[string]operator.StorageResult
+
+	// TablespaceStorage summarizes the storage of every tablespace in
+	// Tablespaces. See CreateMissingPostgreSQLVolumes.
+	TablespaceStorage map[string]TablespaceStorage
+
+	// BackrestRepo is the volume of the local pgBackRest repository. It is the
+	// zero StorageResult when the cluster only keeps its backups in S3 or has
+	// no BackrestStorage.
+	BackrestRepo operator.StorageResult
+}
+
+// CreateClusterVolumes is CreateMissingPostgreSQLVolumes for every volume of
+// cluster, including the pgBackRest repository that is described by its
+// BackrestStorage. The repository is handled last and only when pgBackRest is
+// enabled for the cluster; its Deployment mounts the volume even when backups
+// are only kept in S3. Like CreateMissingPostgreSQLVolumes,
+// PVCs that already exist are left as they are and the volumes handled before
+// a failure are still returned.
+func CreateClusterVolumes(ctx context.Context, clientset kubernetes.Interface,
+	cluster *crv1.Pgcluster, namespace string,
+	pvcNamePrefix string, dataStorageSpec crv1.PgStorageSpec,
+) (volumes ClusterVolumes, err error) {
+	volumes.Data, volumes.WAL, volumes.Tablespaces, volumes.TablespaceStorage, err =
+		createMissingPostgreSQLVolumes(ctx, clientset,
+			cluster, namespace, pvcNamePrefix, dataStorageSpec, CreateOptions{}, nil, nil)
+	if err != nil {
+		return
+	}
 
-	if err == nil {
-		walVolume, err = CreateIfNotExists(clientset,
-			cluster.Spec.WALStorage, pvcNamePrefix+"-wal", cluster.Spec.Name, namespace)
+	repoName := fmt.Sprintf(util.BackrestRepoPVCName, cluster.Name)
+
+	switch {
+	case cluster.Labels[config.LABEL_BACKREST] != "true":
+		log.Debugf("pgbackrest is not enabled for %s, skipping the repo volume", cluster.Name)
+	case cluster.Spec.BackrestStorage.StorageType == "":
+		log.Debugf("no backrest storage for %s, skipping the repo volume", cluster.Name)
+	default:
+		volumes.BackrestRepo, err = createIfNotExists(ctx, clientset, repoName, cluster.Name, namespace,
+			CreateOptions{Spec: &cluster.Spec.BackrestStorage, Owner: cluster})
+		if err != nil {
+			err = &VolumeCreateError{Role: "repo", Name: repoName, Err: err}
+		}
 	}
 
+	return
+}
+
+// DryRunMissingPostgreSQLVolumes is the dry-run variant of
+// CreateMissingPostgreSQLVolumes. Every PVC that would be created is validated
+// by the API server and returned as the Claim of its StorageResult, but
+// nothing is persisted and existing PVCs are not resized.
+func DryRunMissingPostgreSQLVolumes(ctx context.Context, clientset kubernetes.Interface,
+	cluster *crv1.Pgcluster, namespace string,
+	pvcNamePrefix string, dataStorageSpec crv1.PgStorageSpec,
+) (
+	dataVolume, walVolume operator.StorageResult,
+	tablespaceVolumes map[string]operator.StorageResult,
+	tablespaceStorage map[string]TablespaceStorage,
+	err error,
+) {
+	return createMissingPostgreSQLVolumes(ctx, clientset,
+		cluster, namespace, pvcNamePrefix, dataStorageSpec, CreateOptions{DryRun: true}, nil, nil)
+}
+
+// ReconcilePostgreSQLVolumes is CreateMissingPostgreSQLVolumes for a cluster
+// whose volumes were resolved by an earlier pass. Both prior and volumes map the
+// name of each volume to its StorageResult: the name of the data volume is
+// pvcNamePrefix, and the others are named like the PVCs they would create. A
+// volume found in prior that still matches its specification is returned as it
+// was, without any calls to the API server. The names of the volumes that were
+// created by this pass are returned in created.
+func ReconcilePostgreSQLVolumes(ctx context.Context, clientset kubernetes.Interface,
+	cluster *crv1.Pgcluster, namespace string,
+	pvcNamePrefix string, dataStorageSpec crv1.PgStorageSpec,
+	prior map[string]operator.StorageResult,
+) (
+	volumes map[string]operator.StorageResult,
+	created []string,
+	err error,
+) {
+	volumes = map[string]operator.StorageResult{}
+	created = []string{}
+
+	// only the volumes that were resolved are recorded, so that a volume that
+	// failed is resolved again by the next pass
+	_, _, _, _, err = createMissingPostgreSQLVolumes(ctx, clientset,
+		cluster, namespace, pvcNamePrefix, dataStorageSpec, CreateOptions{}, prior,
+		func(name string, volume operator.StorageResult) {
+			volumes[name] = volume
+			if volume.Created {
+				created = append(created, name)
+			}
+		})
+
+	return volumes, created, err
+}
+
+func createMissingPostgreSQLVolumes(ctx context.Context, clientset kubernetes.Interface,
+	cluster *crv1.Pgcluster, namespace string,
+	pvcNamePrefix string, dataStorageSpec crv1.PgStorageSpec, opts CreateOptions,
+	prior map[string]operator.StorageResult,
+	resolved func(name string, volume operator.StorageResult),
+) (
+	dataVolume, walVolume operator.StorageResult,
+	tablespaceVolumes map[string]operator.StorageResult,
+	tablespaceStorage map[string]TablespaceStorage,
+	err error,
+) {
 	tablespaceVolumes = make(map[string]operator.StorageResult, len(cluster.Spec.TablespaceMounts))
-	for tablespaceName, storageSpec := range cluster.Spec.TablespaceMounts {
-		if err == nil {
-			tablespacePVCName := operator.GetTablespacePVCName(pvcNamePrefix, tablespaceName)
-			tablespaceVolumes[tablespaceName], err = CreateIfNotExists(clientset,
-				storageSpec, tablespacePVCName, cluster.Spec.Name, namespace)
+	tablespaceStorage = make(map[string]TablespaceStorage, len(cluster.Spec.TablespaceMounts))
+	opts.Owner = cluster
+
+	// create tablespaces in a consistent order so that the volumes returned
+	// after a failure are predictable
+	tablespaceNames := make([]string, 0, len(cluster.Spec.TablespaceMounts))
+	for tablespaceName := range cluster.Spec.TablespaceMounts {
+		tablespaceNames = append(tablespaceNames, tablespaceName)
+	}
+	sort.Strings(tablespaceNames)
+
+	tablespacePVCNames, err := uniqueTablespacePVCNames(pvcNamePrefix, tablespaceNames)
+	if err != nil {
+		return
+	}
+
+	for _, tablespaceName := range tablespaceNames {
+		spec := cluster.Spec.TablespaceMounts[tablespaceName]
+		tablespaceStorage[tablespaceName], err = summarizeStorage(&spec)
+		if err != nil {
+			err = &VolumeCreateError{Role: "tablespace", Name: tablespaceName, Err: err}
+			return
+		}
+	}
+
+	// check the WAL storage before any volume is created so that a missing
+	// StorageClass does not leave a data volume behind
+	if err = checkWALStorage(clientset, &dataStorageSpec, &cluster.Spec.WALStorage); err != nil {
+		err = &VolumeCreateError{Role: "wal", Name: pvcNamePrefix + "-wal", Err: err}
+		return
+	}
+
+	volume, err := resolveVolume(ctx, clientset,
+		dataStorageSpec, pvcNamePrefix, cluster.Spec.Name, namespace, opts, prior, resolved)
+	if err != nil {
+		err = &VolumeCreateError{Role: "data", Name: pvcNamePrefix, Err: err}
+		return
+	}
+	dataVolume = volume
+
+	if cluster.Spec.WALStorage.StorageType == "" {
+		log.Debugf("no wal storage for %s, skipping the wal volume", pvcNamePrefix)
+	} else {
+		volume, err = resolveVolume(ctx, clientset,
+			cluster.Spec.WALStorage, pvcNamePrefix+"-wal", cluster.Spec.Name, namespace, opts, prior, resolved)
+		if err != nil {
+			err = &VolumeCreateError{Role: "wal", Name: pvcNamePrefix + "-wal", Err: err}
+			return
 		}
+		walVolume = volume
+	}
+
+	for _, tablespaceName := range tablespaceNames {
+		volume, err = resolveVolume(ctx, clientset,
+			cluster.Spec.TablespaceMounts[tablespaceName], tablespacePVCNames[tablespaceName],
+			cluster.Spec.Name, namespace, opts, prior, resolved)
+		if err != nil {
+			err = &VolumeCreateError{Role: "tablespace", Name: tablespaceName, Err: err}
+			return
+		}
+		tablespaceVolumes[tablespaceName] = volume
 	}
 
 	return
 }
 
+// resolveVolume returns the StorageResult of the volume name from prior when it
+// still matches spec, and calls createIfNotExists with spec otherwise. A
+// StorageResult from prior never has a Claim, since nothing was created for it.
+// The StorageResult is passed to resolved, if any, unless there is an error.
+func resolveVolume(ctx context.Context, clientset kubernetes.Interface, spec crv1.PgStorageSpec, name, clusterName, namespace string, opts CreateOptions,
+	prior map[string]operator.StorageResult, resolved func(string, operator.StorageResult),
+) (operator.StorageResult, error) {
+	volume, ok := prior[name]
+	if ok && matchesPrior(spec, name, volume) {
+		volume.Claim, volume.Created = nil, false
+	} else {
+		var err error
+		opts.Spec = &spec
+		if volume, err = createIfNotExists(ctx, clientset, name, clusterName, namespace, opts); err != nil {
+			return volume, err
+		}
+	}
+
+	if resolved != nil {
+		resolved(name, volume)
+	}
+	return volume, nil
+}
+
+// matchesPrior returns true when volume, the StorageResult of an earlier pass
+// for the volume name, refers to the same claim that spec calls for and was
+// resolved from the same size, StorageClass, and security settings. A volume
+// that does not match is resolved again, so that a PVC that is now too small
+// is grown.
+func matchesPrior(spec crv1.PgStorageSpec, name string, volume operator.StorageResult) bool {
+	if !equalGroups(SupplementalGroupsFor(spec), volume.SupplementalGroups) ||
+		!equalInt64(spec.FSGroup, volume.FSGroup) {
+		return false
+	}
+
+	switch spec.StorageType {
+	case "":
+		return volume.PersistentVolumeClaimName == ""
+	case "emptydir":
+		return volume.PersistentVolumeClaimName == "" && equalSize(spec.Size, volume.SizeLimit)
+	case "existing":
+		// an "existing" spec without a Name refers to whichever PVC was found
+		return volume.PersistentVolumeClaimName != "" &&
+			(spec.Name == "" || spec.Name == volume.PersistentVolumeClaimName) &&
+			spec.ReadOnly == volume.ReadOnly
+	case "create", "dynamic":
+		storageClass := ""
+		if spec.StorageType == "dynamic" {
+			storageClass = spec.StorageClass
+		}
+		return volume.PersistentVolumeClaimName == name &&
+			volume.StorageClass == storageClass && equalSize(spec.Size, volume.Size)
+	}
+	return false
+}
+
+// equalGroups returns true when a and b have the same groups in the same order
+func equalGroups(a, b []int64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// equalInt64 returns true when a and b are both nil or point to the same value
+func equalInt64(a, b *int64) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+// equalSize returns true when size is the quantity q, or when size is empty and
+// q is nil
+func equalSize(size string, q *resource.Quantity) bool {
+	if size == "" || q == nil {
+		return size == "" && q == nil
+	}
+	parsed, err := resource.ParseQuantity(size)
+	return err == nil && parsed.Cmp(*q) == 0
+}
+
+// TablespaceStorage is the kind of storage that a tablespace volume uses
+type TablespaceStorage struct {
+	// StorageType is the StorageType of the specification of the tablespace.
+	StorageType string
+
+	// StorageClass is the StorageClass the PVC of a "dynamic" tablespace asks
+	// for. It is empty when the default StorageClass is used or when the volume
+	// is not provisioned by a StorageClass.
+	StorageClass string
+
+	// AccessModes are the access modes of a PVC the Operator creates. It is
+	// empty for an "emptydir" or "existing" volume.
+	AccessModes []v1.PersistentVolumeAccessMode
+}
+
+// summarizeStorage returns the TablespaceStorage of storageSpec.
+func summarizeStorage(storageSpec *crv1.PgStorageSpec) (TablespaceStorage, error) {
+	summary := TablespaceStorage{StorageType: storageSpec.StorageType}
+
+	switch storageSpec.StorageType {
+	case "create", "dynamic":
+		modes, err := storageAccessModes(storageSpec)
+		if err != nil {
+			return summary, err
+		}
+		summary.AccessModes = modes
+
+		if storageSpec.StorageType == "dynamic" {
+			summary.StorageClass = storageSpec.StorageClass
+		}
+	}
+
+	return summary, nil
+}
+
+// RequireTablespaceAccessMode returns an error naming every tablespace in
+// tablespaceStorage with a PVC that is not created with mode.
+func RequireTablespaceAccessMode(tablespaceStorage map[string]TablespaceStorage, mode v1.PersistentVolumeAccessMode) error {
+	mismatched := []string{}
+	for tablespaceName, storage := range tablespaceStorage {
+		if len(storage.AccessModes) > 0 && !hasAccessMode(storage.AccessModes, mode) {
+			mismatched = append(mismatched, fmt.Sprintf("%s is %s", tablespaceName, joinAccessModes(storage.AccessModes)))
+		}
+	}
+
+	if len(mismatched) > 0 {
+		sort.Strings(mismatched)
+		return fmt.Errorf("tablespaces require access mode %s: %s", mode, strings.Join(mismatched, ", "))
+	}
+	return nil
+}
+
+// uniqueTablespacePVCNames returns the PVC name of each tablespace in
+// tablespaceNames. It returns an error listing the tablespaces when any of them
+// would share a PVC.
+func uniqueTablespacePVCNames(pvcNamePrefix string, tablespaceNames []string) (map[string]string, error) {
+	names := make(map[string]string, len(tablespaceNames))
+	tablespaces := map[string][]string{}
+
+	for _, tablespaceName := range tablespaceNames {
+		pvcName := tablespacePVCName(pvcNamePrefix, tablespaceName)
+		names[tablespaceName] = pvcName
+		tablespaces[pvcName] = append(tablespaces[pvcName], tablespaceName)
+	}
+
+	conflicts := []string{}
+	for pvcName, shared := range tablespaces {
+		if len(shared) > 1 {
+			sort.Strings(shared)
+			conflicts = append(conflicts, fmt.Sprintf("%s share pvc %s", strings.Join(shared, ", "), pvcName))
+		}
+	}
+
+	if len(conflicts) > 0 {
+		sort.Strings(conflicts)
+		return nil, fmt.Errorf("tablespace pvc names conflict: %s", strings.Join(conflicts, "; "))
+	}
+
+	return names, nil
+}
+
+// SupplementalGroupsFor returns the supplemental groups that a pod needs to use
+// the volume of spec, in the order they are listed and without duplicates.
+func SupplementalGroupsFor(spec crv1.PgStorageSpec) []int64 {
+	groups := []int64{}
+	seen := map[int64]bool{}
+	for _, group := range spec.GetSupplementalGroups() {
+		if !seen[group] {
+			seen[group] = true
+			groups = append(groups, group)
+		}
+	}
+	return groups
+}
+
 // CreateIfNotExists converts a storage specification into a StorageResult. If
-// spec calls for a PVC to be created and pvcName does not exist, it will be created.
-func CreateIfNotExists(clientset *kubernetes.Clientset, spec crv1.PgStorageSpec, pvcName, clusterName, namespace string) (operator.StorageResult, error) {
+// spec calls for a PVC to be created and pvcName does not exist, it will be
+// created and returned as the Claim of the StorageResult, which is then Created.
+// When it already exists without the labels of the Operator, it is adopted by clusterName. An
+// "existing" spec without a Name refers to the one PVC matched by its labels.
+// See CreateOptions.Owner for how owner is used.
+func CreateIfNotExists(ctx context.Context, clientset kubernetes.Interface, spec crv1.PgStorageSpec, pvcName, clusterName, namespace string, owner *crv1.Pgcluster) (operator.StorageResult, error) {
+	return createIfNotExists(ctx, clientset, pvcName, clusterName, namespace,
+		CreateOptions{Spec: &spec, Owner: owner})
+}
+
+// CreateIfNotExistsWithOptions is CreateIfNotExists for the Spec of opts. The
+// other fields of opts apply to the PVC when it is created.
+func CreateIfNotExistsWithOptions(ctx context.Context, clientset kubernetes.Interface, pvcName, clusterName, namespace string, opts CreateOptions) (operator.StorageResult, error) {
+	return createIfNotExists(ctx, clientset, pvcName, clusterName, namespace, opts)
+}
+
+func createIfNotExists(ctx context.Context, clientset kubernetes.Interface, pvcName, clusterName, namespace string, opts CreateOptions) (operator.StorageResult, error) {
+	if opts.Spec == nil {
+		return operator.StorageResult{}, errSpecRequired
+	}
+	spec := *opts.Spec
+
 	result := operator.StorageResult{
-		SupplementalGroups: spec.GetSupplementalGroups(),
+		SupplementalGroups: SupplementalGroupsFor(spec),
+	}
+	if spec.FSGroup != nil {
+		fsGroup := *spec.FSGroup
+		result.FSGroup = &fsGroup
 	}
 
 	switch spec.StorageType {
-	case "", "emptydir":
+	case "":
 		// no-op
 
+	case "emptydir":
+		if spec.Size != "" {
+			limit, err := resource.ParseQuantity(spec.Size)
+			if err != nil {
+				createTotal.WithLabelValues(spec.StorageType, metricResultFailure).Inc()
+				return result, fmt.Errorf("emptydir size %q is invalid: %w", spec.Size, err)
+			}
+			result.SizeLimit = &limit
+		}
+		createTotal.WithLabelValues(spec.StorageType, metricResultSkipped).Inc()
+
 	case "existing":
-		result.PersistentVolumeClaimName = spec.Name
+		if spec.DataSource != "" {
+			createTotal.WithLabelValues(spec.StorageType, metricResultFailure).Inc()
+			return result, fmt.Errorf("data source %q cannot be used with existing pvc %s",
+				spec.DataSource, spec.Name)
+		}
+
+		name := spec.Name
+		if name == "" {
+			var err error
+			if name, err = findExisting(ctx, clientset, &spec, namespace); err != nil {
+				createTotal.WithLabelValues(spec.StorageType, metricResultFailure).Inc()
+				return result, err
+			}
+		}
+		result.PersistentVolumeClaimName = name
+		result.ReadOnly = spec.ReadOnly
+		createTotal.WithLabelValues(spec.StorageType, metricResultSkipped).Inc()
 
 	case "create", "dynamic":
 		result.PersistentVolumeClaimName = pvcName
-		err := Create(clientset, pvcName, clusterName, &spec, namespace)
-		if err != nil && !kubeapi.IsAlreadyExists(err) {
-			log.Errorf("error in pvc create: %v", err)
+
+		// the size is parsed before anything is submitted so that it can be
+		// reported whether or not the PVC already exists
+		size, err := storageSize(pvcName, &spec)
+		if err != nil {
+			createTotal.WithLabelValues(spec.StorageType, metricResultFailure).Inc()
+			logFields(pvcName, namespace).WithField("storageType", spec.StorageType).
+				WithError(err).Error("unable to create pvc")
+			return result, err
+		}
+		result.Size = &size
+		if spec.StorageType == "dynamic" {
+			result.StorageClass = spec.StorageClass
+		}
+
+		claim, err := Create(ctx, clientset, pvcName, clusterName, namespace, opts)
+		if kubeapi.IsAlreadyExists(err) {
+			err = matchExisting(ctx, clientset, &spec, pvcName, namespace, opts)
+			if err == nil && !opts.DryRun {
+				err = adopt(ctx, clientset, &spec, pvcName, clusterName, namespace)
+			}
+		} else if err == nil {
+			result.Claim = claim
+			result.Created = !opts.DryRun
+		}
+		if err != nil {
+			logFields(pvcName, namespace).WithField("storageType", spec.StorageType).
+				WithError(err).Error("unable to create pvc")
 			return result, err
 		}
 	}
@@ -103,122 +673,877 @@ func CreateIfNotExists(clientset *kubernetes.Clientset, spec crv1.PgStorageSpec,
 	return result, nil
 }
 
-// CreatePVC create a pvc
-func CreatePVC(clientset *kubernetes.Clientset, storageSpec *crv1.PgStorageSpec, pvcName, clusterName, namespace string) (string, error) {
+// findExisting returns the name of the one available PVC in namespace that
+// matches the MatchLabels and Selector of an "existing" storageSpec that has
+// no Name. A PVC is available unless it is being deleted or has lost its
+// volume. It is an error for no PVC, or more than one, to match.
+func findExisting(ctx context.Context, clientset kubernetes.Interface, storageSpec *crv1.PgStorageSpec, namespace string) (string, error) {
+	labelSelector, err := storageSelector(storageSpec)
+	if err != nil {
+		return "", err
+	}
+	if labelSelector == nil {
+		return "", errors.New("existing storage requires a pvc name or match labels")
+	}
+
+	selector, err := metav1.LabelSelectorAsSelector(labelSelector)
+	if err != nil {
+		return "", err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	list, err := clientset.CoreV1().PersistentVolumeClaims(namespace).List(
+		metav1.ListOptions{LabelSelector: selector.String()})
+	if err != nil {
+		return "", err
+	}
+
+	names := []string{}
+	for _, pvc := range list.Items {
+		if pvc.DeletionTimestamp == nil && pvc.Status.Phase != v1.ClaimLost {
+			names = append(names, pvc.Name)
+		}
+	}
+	sort.Strings(names)
+
+	switch len(names) {
+	case 0:
+		return "", fmt.Errorf("no existing pvc matches %q", selector.String())
+	case 1:
+		logFields(names[0], namespace).WithField("selector", selector.String()).
+			Debug("existing pvc matches selector")
+		return names[0], nil
+	default:
+		return "", fmt.Errorf("existing pvcs %s all match %q; expected only one",
+			strings.Join(names, ", "), selector.String())
+	}
+}
+
+// matchExisting compares the existing PVC name with storageSpec. A PVC that
+// was provisioned by a different StorageClass is reported as an
+// ErrStorageMismatch. A PVC that is smaller than storageSpec now asks for is
+// grown to the requested size, except when opts.DryRun is set. When its
+// StorageClass does not allow that, the difference in size is reported as an
+// ErrStorageMismatch as well.
+func matchExisting(ctx context.Context, clientset kubernetes.Interface, storageSpec *crv1.PgStorageSpec, name, namespace string, opts CreateOptions) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	existing, err := clientset.CoreV1().PersistentVolumeClaims(namespace).Get(name, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+
+	// only a "dynamic" PVC names its StorageClass, and one that does not is
+	// free to be provisioned by whichever class is the default
+	if storageSpec.StorageType == "dynamic" && storageSpec.StorageClass != "" {
+		actual := ""
+		if existing.Spec.StorageClassName != nil {
+			actual = *existing.Spec.StorageClassName
+		}
+		if actual != storageSpec.StorageClass {
+			return fmt.Errorf("%w: pvc %s has storage class %q, expected %q",
+				ErrStorageMismatch, name, actual, storageSpec.StorageClass)
+		}
+	}
+
+	if opts.DryRun {
+		return nil
+	}
+
+	err = resizeIfLarger(ctx, clientset, existing, storageSpec.Size)
+	if errors.Is(err, errNotExpandable) {
+		current := existing.Spec.Resources.Requests[v1.ResourceStorage]
+		return fmt.Errorf("%w: pvc %s requests %s, expected %s; %v",
+			ErrStorageMismatch, name, current.String(), storageSpec.Size, err)
+	}
+	return err
+}
+
+// CreatePVC converts storageSpec into a StorageResult like CreateIfNotExists,
+// for a PVC that is not owned by a cluster.
+//
+// Deprecated: use CreateIfNotExists.
+func CreatePVC(ctx context.Context, clientset kubernetes.Interface, storageSpec *crv1.PgStorageSpec, pvcName, clusterName, namespace string) (operator.StorageResult, error) {
+	return CreateIfNotExists(ctx, clientset, *storageSpec, pvcName, clusterName, namespace, nil)
+}
+
+// Create a pvc from opts.Spec and return the object returned by the API server.
+// The PVC is not submitted when ctx is already done, and it is changed by any
+// registered Mutators before it is. Creates of the same PVC within this process
+// are serialized, and one that finds that another has just succeeded returns
+// AlreadyExists without submitting anything. See CreateOptions for how the rest
+// of opts is used.
+func Create(ctx context.Context, clientset kubernetes.Interface, name, clusterName, namespace string, opts CreateOptions) (*v1.PersistentVolumeClaim, error) {
+	if opts.Spec == nil {
+		return nil, errSpecRequired
+	}
+
+	start := time.Now()
+
+	var created *v1.PersistentVolumeClaim
 	var err error
+	if opts.DryRun {
+		created, err = create(ctx, clientset, name, clusterName, namespace, opts)
+	} else {
+		created, err = creates.do(ctx, name, namespace, func() (*v1.PersistentVolumeClaim, error) {
+			return create(ctx, clientset, name, clusterName, namespace, opts)
+		})
+	}
 
-	switch storageSpec.StorageType {
-	case "":
-		log.Debug("StorageType is empty")
-	case "emptydir":
-		log.Debug("StorageType is emptydir")
-	case "existing":
-		log.Debug("StorageType is existing")
-		pvcName = storageSpec.Name
-	case "create", "dynamic":
-		log.Debug("StorageType is create")
-		log.Debugf("pvcname=%s storagespec=%v", pvcName, storageSpec)
-		err = Create(clientset, pvcName, clusterName, storageSpec, namespace)
+	if !opts.DryRun {
+		createDuration.Observe(time.Since(start).Seconds())
+		createTotal.WithLabelValues(opts.Spec.StorageType, createResult(err)).Inc()
+
+		if err == nil {
+			// the size was already parsed to create the PVC
+			size, _ := NormalizeSize(opts.Spec.Size)
+			logFields(name, namespace).WithFields(log.Fields{
+				"storageType": opts.Spec.StorageType,
+				"size":        size,
+			}).Info("created pvc")
+		}
+	}
+
+	if opts.Recorder != nil && opts.Owner != nil && !opts.DryRun {
 		if err != nil {
-			log.Error("error in pvc create " + err.Error())
-			return pvcName, err
+			opts.Recorder.Eventf(opts.Owner, v1.EventTypeWarning, EventReasonCreateFailed,
+				"unable to create pvc %s: %v", name, err)
+		} else {
+			opts.Recorder.Eventf(opts.Owner, v1.EventTypeNormal, EventReasonCreated,
+				"created pvc %s", name)
 		}
-		log.Info("created PVC =" + pvcName + " in namespace " + namespace)
 	}
 
-	return pvcName, err
+	return created, err
 }
 
-// Create a pvc
-func Create(clientset *kubernetes.Clientset, name, clusterName string, storageSpec *crv1.PgStorageSpec, namespace string) error {
+func create(ctx context.Context, clientset kubernetes.Interface, name, clusterName, namespace string, opts CreateOptions) (*v1.PersistentVolumeClaim, error) {
 	log.Debug("in createPVC")
-	var doc2 bytes.Buffer
-	var err error
+	storageSpec := opts.Spec
+
+	newpvc, err := newPersistentVolumeClaim(name, clusterName, storageSpec)
+	if err != nil {
+		logFields(name, namespace).WithError(err).Error("unable to build pvc")
+		return nil, err
+	}
+
+	setOwner(newpvc, storageSpec, opts.Owner)
+	mutators.mutate(storageSpec.StorageType, newpvc)
+
+	if err := checkStorageClass(clientset, storageSpec); err != nil {
+		logFields(name, namespace).WithField("storageClass", storageSpec.StorageClass).
+			WithError(err).Error("unable to use storage class")
+		return nil, err
+	}
+
+	// the rendered PVC goes through the logger so that it is not interleaved
+	// with other log entries
+	if operator.CRUNCHY_DEBUG {
+		if b, err := json.MarshalIndent(newpvc, "", "    "); err == nil {
+			logFields(name, namespace).WithField("document", string(b)).Debug("rendered pvc")
+		}
+	}
+
+	backoff := DefaultCreateBackoff
+	if opts.Backoff != nil {
+		backoff = *opts.Backoff
+	}
+	if backoff.Steps < 1 {
+		backoff.Steps = 1
+	}
+
+	var created *v1.PersistentVolumeClaim
+	var lastErr error
+
+	err = wait.ExponentialBackoff(backoff, func() (bool, error) {
+		// the typed client does not accept a context, so check it before every
+		// attempt to submit the PVC
+		if err := ctx.Err(); err != nil {
+			return false, err
+		}
+
+		if opts.DryRun {
+			created, lastErr = dryRunCreate(clientset, namespace, newpvc)
+		} else {
+			created, lastErr = clientset.CoreV1().PersistentVolumeClaims(namespace).Create(newpvc)
+		}
+
+		if isTransient(lastErr) {
+			logFields(name, namespace).WithError(lastErr).Warn("transient error creating pvc, retrying")
+			return false, nil
+		}
+		return true, lastErr
+	})
+
+	if err == wait.ErrWaitTimeout {
+		err = lastErr
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return created, nil
+}
+
+// isTransient returns true when err is a server error that may succeed if the
+// request is tried again.
+func isTransient(err error) bool {
+	return kerrors.IsInternalError(err) ||
+		kerrors.IsServerTimeout(err) ||
+		kerrors.IsTimeout(err) ||
+		kerrors.IsTooManyRequests(err) ||
+		kerrors.IsServiceUnavailable(err) ||
+		kerrors.IsConflict(err)
+}
+
+// dryRunCreate submits pvc with the "All" dry-run option and returns the
+// object the API server would have created. The typed client does not accept
+// CreateOptions, so the request is built with the REST client instead.
+func dryRunCreate(clientset kubernetes.Interface, namespace string, pvc *v1.PersistentVolumeClaim) (*v1.PersistentVolumeClaim, error) {
+	result := &v1.PersistentVolumeClaim{}
+	err := clientset.CoreV1().RESTClient().Post().
+		Namespace(namespace).
+		Resource("persistentvolumeclaims").
+		VersionedParams(&metav1.CreateOptions{DryRun: []string{metav1.DryRunAll}}, scheme.ParameterCodec).
+		Body(pvc).
+		Do().
+		Into(result)
+
+	return result, err
+}
+
+// newPersistentVolumeClaim builds the PVC described by storageSpec. A "dynamic"
+// PVC is provisioned by its StorageClass, or by the default StorageClass when
+// none is named. Any other PVC may bind to an existing PV that carries the
+// MatchLabels of storageSpec.
+func newPersistentVolumeClaim(name, clusterName string, storageSpec *crv1.PgStorageSpec) (*v1.PersistentVolumeClaim, error) {
+	size, err := storageSize(name, storageSpec)
+	if err != nil {
+		return nil, err
+	}
+
+	accessModes, err := storageAccessModes(storageSpec)
+	if err != nil {
+		return nil, err
+	}
+
+	volumeMode, err := storageVolumeMode(storageSpec)
+	if err != nil {
+		return nil, err
+	}
 
-	pvcFields := TemplateFields{
-		Name:         name,
-		AccessMode:   storageSpec.AccessMode,
-		StorageClass: storageSpec.StorageClass,
-		ClusterName:  clusterName,
-		Size:         storageSpec.Size,
-		MatchLabels:  storageSpec.MatchLabels,
+	resources := v1.ResourceRequirements{
+		Requests: v1.ResourceList{v1.ResourceStorage: size},
+	}
+
+	if storageSpec.SizeLimit != "" {
+		limit, err := resource.ParseQuantity(storageSpec.SizeLimit)
+		if err != nil {
+			return nil, fmt.Errorf("storage size limit %q is invalid: %w", storageSpec.SizeLimit, err)
+		}
+		if limit.Cmp(size) < 0 {
+			return nil, fmt.Errorf("storage size limit %q is less than the requested size %q",
+				storageSpec.SizeLimit, storageSpec.Size)
+		}
+		resources.Limits = v1.ResourceList{v1.ResourceStorage: limit}
+	}
+
+	pvc := &v1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   name,
+			Labels: managedLabels(clusterName),
+		},
+		Spec: v1.PersistentVolumeClaimSpec{
+			AccessModes: accessModes,
+			Resources:   resources,
+			VolumeMode:  volumeMode,
+		},
+	}
+
+	if storageSpec.DataSource != "" {
+		apiGroup := snapshotAPIGroup
+		pvc.Spec.DataSource = &v1.TypedLocalObjectReference{
+			APIGroup: &apiGroup,
+			Kind:     "VolumeSnapshot",
+			Name:     storageSpec.DataSource,
+		}
+	}
+
+	mergeMetadata(&pvc.ObjectMeta, storageSpec)
+
+	if storageSpec.RetainOnDelete {
+		if pvc.Annotations == nil {
+			pvc.Annotations = map[string]string{}
+		}
+		pvc.Annotations[config.ANNOTATION_PVC_RETAIN_ON_DELETE] = "true"
 	}
 
 	if storageSpec.StorageType == "dynamic" {
-		log.Debug("using dynamic PVC template")
-		err = config.PVCStorageClassTemplate.Execute(&doc2, pvcFields)
-		if operator.CRUNCHY_DEBUG {
-			config.PVCStorageClassTemplate.Execute(os.Stdout, pvcFields)
+		log.Debug("using dynamic PVC")
+		if storageSpec.StorageClass != "" {
+			pvc.Spec.StorageClassName = &storageSpec.StorageClass
 		}
 	} else {
 		log.Debugf("matchlabels from spec is [%s]", storageSpec.MatchLabels)
-		if storageSpec.MatchLabels != "" {
-			arr := strings.Split(storageSpec.MatchLabels, "=")
-			if len(arr) != 2 {
-				log.Errorf("%s MatchLabels is not formatted correctly", storageSpec.MatchLabels)
-				return errors.New("match labels is not formatted correctly")
-			}
-			pvcFields.MatchLabels = getMatchLabels(arr[0], arr[1])
-			log.Debugf("matchlabels constructed is %s", pvcFields.MatchLabels)
+		pvc.Spec.Selector, err = storageSelector(storageSpec)
+		if err != nil {
+			return nil, err
 		}
+	}
 
-		err = config.PVCTemplate.Execute(&doc2, pvcFields)
-		if operator.CRUNCHY_DEBUG {
-			config.PVCTemplate.Execute(os.Stdout, pvcFields)
-		}
+	return pvc, nil
+}
+
+// managedLabels returns the labels of a PVC that the Operator manages for
+// clusterName. They are how the PVC is listed and removed with the cluster.
+func managedLabels(clusterName string) map[string]string {
+	return map[string]string{
+		config.LABEL_VENDOR:     config.LABEL_CRUNCHY,
+		config.LABEL_PGREMOVE:   "true",
+		config.LABEL_PG_CLUSTER: clusterName,
 	}
+}
+
+// logFields returns a log entry that identifies the PVC name in namespace
+func logFields(name, namespace string) *log.Entry {
+	return log.WithFields(log.Fields{"pvc": name, "namespace": namespace})
+}
+
+// storageSize parses the Size of storageSpec, which must be greater than zero.
+// An empty or zero size would otherwise be rejected by the API server with a
+// message that does not mention the storage spec.
+func storageSize(name string, storageSpec *crv1.PgStorageSpec) (resource.Quantity, error) {
+	size, err := resource.ParseQuantity(storageSpec.Size)
 	if err != nil {
-		log.Error("error in pvc create exec" + err.Error())
+		return size, fmt.Errorf("storage size %q is invalid for pvc %s: %w", storageSpec.Size, name, err)
+	}
+	if size.Sign() <= 0 {
+		return size, fmt.Errorf("storage size %q is invalid for pvc %s: must be greater than zero",
+			storageSpec.Size, name)
+	}
+	return size, nil
+}
+
+// NormalizeSize parses size and returns it with the largest binary suffix that
+// represents it exactly, so that "1024Mi" and "1Gi" are both "1Gi". A size
+// that is not a whole number of kibibytes, such as "1G", is returned in bytes.
+// It returns an error when size is not a quantity greater than zero.
+func NormalizeSize(size string) (string, error) {
+	quantity, err := resource.ParseQuantity(size)
+	if err != nil {
+		return "", fmt.Errorf("size %q is invalid: %w", size, err)
+	}
+	if quantity.Sign() <= 0 {
+		return "", fmt.Errorf("size %q is invalid: must be greater than zero", size)
+	}
+
+	return resource.NewQuantity(quantity.Value(), resource.BinarySI).String(), nil
+}
+
+// checkWALStorage returns an error when walSpec names a StorageClass that does
+// not exist. WAL is often given faster storage than data, so it is logged when
+// the two share a StorageClass. An empty walSpec is not checked.
+func checkWALStorage(clientset kubernetes.Interface, dataSpec, walSpec *crv1.PgStorageSpec) error {
+	if walSpec.StorageType == "" {
+		return nil
+	}
+
+	if err := checkStorageClass(clientset, walSpec); err != nil {
 		return err
 	}
 
-	newpvc := v1.PersistentVolumeClaim{}
-	err = json.Unmarshal(doc2.Bytes(), &newpvc)
+	if walSpec.StorageType == "dynamic" && dataSpec.StorageType == "dynamic" &&
+		walSpec.StorageClass == dataSpec.StorageClass {
+		class := "the default storage class"
+		if walSpec.StorageClass != "" {
+			class = fmt.Sprintf("storage class %q", walSpec.StorageClass)
+		}
+		log.Infof("wal and data volumes share %s", class)
+	}
+
+	return nil
+}
+
+// checkStorageClass returns an error when storageSpec is "dynamic" and names a
+// StorageClass that does not exist. Such a PVC would otherwise remain Pending
+// forever. A "dynamic" PVC without a StorageClass uses the default class and is
+// not checked.
+func checkStorageClass(clientset kubernetes.Interface, storageSpec *crv1.PgStorageSpec) error {
+	if storageSpec.StorageType != "dynamic" || storageSpec.StorageClass == "" {
+		return nil
+	}
+
+	_, err := clientset.StorageV1().StorageClasses().Get(storageSpec.StorageClass, metav1.GetOptions{})
+	if kubeapi.IsNotFound(err) {
+		return fmt.Errorf("storage class %q does not exist", storageSpec.StorageClass)
+	}
+	if err != nil {
+		return fmt.Errorf("unable to get storage class %s: %w", storageSpec.StorageClass, err)
+	}
+
+	return nil
+}
+
+// storageAccessModes returns the access modes requested by storageSpec, or
+// ReadWriteOnce when none is requested. Its AccessMode is one mode or several
+// separated by commas, e.g. "ReadWriteOnce,ReadOnlyMany".
+func storageAccessModes(storageSpec *crv1.PgStorageSpec) ([]v1.PersistentVolumeAccessMode, error) {
+	if strings.TrimSpace(storageSpec.AccessMode) == "" {
+		return []v1.PersistentVolumeAccessMode{v1.ReadWriteOnce}, nil
+	}
+
+	modes := []v1.PersistentVolumeAccessMode{}
+	for _, value := range strings.Split(storageSpec.AccessMode, ",") {
+		mode := v1.PersistentVolumeAccessMode(strings.TrimSpace(value))
+
+		switch mode {
+		case v1.ReadWriteOnce, v1.ReadOnlyMany, v1.ReadWriteMany:
+		default:
+			return nil, fmt.Errorf("access mode %q is invalid; must be %q, %q, or %q",
+				mode, v1.ReadWriteOnce, v1.ReadOnlyMany, v1.ReadWriteMany)
+		}
+
+		if hasAccessMode(modes, mode) {
+			return nil, fmt.Errorf("access mode %q is listed more than once", mode)
+		}
+		modes = append(modes, mode)
+	}
+
+	return modes, nil
+}
+
+// hasAccessMode returns whether mode is one of modes
+func hasAccessMode(modes []v1.PersistentVolumeAccessMode, mode v1.PersistentVolumeAccessMode) bool {
+	for _, m := range modes {
+		if m == mode {
+			return true
+		}
+	}
+	return false
+}
+
+// joinAccessModes returns modes separated by commas, the way they are written
+// in a storage specification
+func joinAccessModes(modes []v1.PersistentVolumeAccessMode) string {
+	values := make([]string, len(modes))
+	for i, mode := range modes {
+		values[i] = string(mode)
+	}
+	return strings.Join(values, ",")
+}
+
+// storageVolumeMode returns the VolumeMode requested by storageSpec, or nil
+// when none is requested.
+func storageVolumeMode(storageSpec *crv1.PgStorageSpec) (*v1.PersistentVolumeMode, error) {
+	mode := v1.PersistentVolumeMode(storageSpec.VolumeMode)
+
+	switch mode {
+	case "":
+		return nil, nil
+	case v1.PersistentVolumeFilesystem, v1.PersistentVolumeBlock:
+		return &mode, nil
+	}
+
+	return nil, fmt.Errorf("volume mode %q is invalid; must be %q or %q",
+		storageSpec.VolumeMode, v1.PersistentVolumeFilesystem, v1.PersistentVolumeBlock)
+}
+
+// setOwner makes owner the controller of pvc when storageSpec asks for it. Only
+// PVCs that the Operator is allowed to remove are ever owned.
+func setOwner(pvc *v1.PersistentVolumeClaim, storageSpec *crv1.PgStorageSpec, owner *crv1.Pgcluster) {
+	if owner == nil || !storageSpec.OwnedByCluster || pvc.Labels[config.LABEL_PGREMOVE] != "true" {
+		return
+	}
+
+	pvc.OwnerReferences = append(pvc.OwnerReferences,
+		*metav1.NewControllerRef(owner, crv1.SchemeGroupVersion.WithKind("Pgcluster")))
+}
+
+// mergeMetadata adds the Annotations and Labels of storageSpec to meta. Labels
+// already present on meta are managed by the Operator and are kept.
+func mergeMetadata(meta *metav1.ObjectMeta, storageSpec *crv1.PgStorageSpec) {
+	for key, value := range storageSpec.Annotations {
+		if meta.Annotations == nil {
+			meta.Annotations = map[string]string{}
+		}
+		meta.Annotations[key] = value
+	}
+
+	for key, value := range storageSpec.Labels {
+		if current, ok := meta.Labels[key]; ok {
+			if current != value {
+				log.Warnf("ignoring label %s=%s on pvc %s; the label is managed by the operator",
+					key, value, meta.Name)
+			}
+			continue
+		}
+		if meta.Labels == nil {
+			meta.Labels = map[string]string{}
+		}
+		meta.Labels[key] = value
+	}
+}
+
+// storageSelector combines the MatchLabels and Selector of storageSpec into a
+// single LabelSelector. It returns nil when neither of them selects anything.
+func storageSelector(storageSpec *crv1.PgStorageSpec) (*metav1.LabelSelector, error) {
+	matchLabels, err := parseMatchLabels(storageSpec.MatchLabels)
 	if err != nil {
-		log.Error("error unmarshalling json into PVC " + err.Error())
+		log.Errorf("%s MatchLabels is not formatted correctly", storageSpec.MatchLabels)
+		return nil, err
+	}
+
+	selector := &metav1.LabelSelector{}
+	if storageSpec.Selector != nil {
+		selector = storageSpec.Selector.DeepCopy()
+	}
+
+	for key, value := range matchLabels {
+		if selector.MatchLabels == nil {
+			selector.MatchLabels = map[string]string{}
+		}
+		selector.MatchLabels[key] = value
+	}
+
+	if len(selector.MatchLabels) == 0 && len(selector.MatchExpressions) == 0 {
+		return nil, nil
+	}
+
+	// ensure the operators and values of any expressions are valid
+	if _, err := metav1.LabelSelectorAsSelector(selector); err != nil {
+		return nil, fmt.Errorf("storage selector is invalid: %w", err)
+	}
+
+	return selector, nil
+}
+
+// parseMatchLabels converts a comma-separated list of key=value pairs, e.g.
+// "tier=gold,zone=us-east-1a", into a map. Empty segments are ignored. Every
+// key and value must be a valid label key and value.
+func parseMatchLabels(matchLabels string) (map[string]string, error) {
+	labels := map[string]string{}
+
+	for _, segment := range strings.Split(matchLabels, ",") {
+		segment = strings.TrimSpace(segment)
+		if segment == "" {
+			continue
+		}
+
+		pair := strings.Split(segment, "=")
+		if len(pair) != 2 || strings.TrimSpace(pair[0]) == "" {
+			return nil, fmt.Errorf("match labels segment %q is not formatted as key=value", segment)
+		}
+
+		key, value := strings.TrimSpace(pair[0]), strings.TrimSpace(pair[1])
+		if errs := validation.IsQualifiedName(key); len(errs) > 0 {
+			return nil, fmt.Errorf("match labels key %q is invalid: %s", key, strings.Join(errs, "; "))
+		}
+		if errs := validation.IsValidLabelValue(value); len(errs) > 0 {
+			return nil, fmt.Errorf("match labels value %q of key %q is invalid: %s",
+				value, key, strings.Join(errs, "; "))
+		}
+
+		labels[key] = value
+	}
+
+	return labels, nil
+}
+
+// Delete a pvc. See DeleteOptions for how opts is used. A PVC created from a
+// storage spec with RetainOnDelete is not deleted, and neither is one of
+// another cluster when opts.ClusterName is set.
+func DeleteIfExists(ctx context.Context, clientset kubernetes.Interface, name string, namespace string, opts DeleteOptions) error {
+	_, err := deleteIfExists(ctx, clientset, name, namespace, opts)
+	return err
+}
+
+// DeleteIfExistsAndWait deletes a pvc like DeleteIfExists, then blocks until
+// the PVC is fully removed. It returns an error when the PVC is still present
+// after timeout. A PVC that the Operator is not allowed to remove is left alone
+// and not waited for.
+func DeleteIfExistsAndWait(ctx context.Context, clientset kubernetes.Interface, name, namespace string, opts DeleteOptions, timeout time.Duration) error {
+	deleted, err := deleteIfExists(ctx, clientset, name, namespace, opts)
+	if err != nil || !deleted {
 		return err
 	}
 
-	_, err = clientset.CoreV1().PersistentVolumeClaims(namespace).Create(&newpvc)
+	return WaitForDeleted(ctx, clientset, name, namespace, timeout)
+}
+
+// WaitForDeleted blocks until the PVC name no longer exists, e.g. after it was
+// deleted along with its owner. It does not delete the PVC itself. Errors other
+// than NotFound are treated as the PVC still being present, and an error is
+// returned when it is still present after timeout.
+func WaitForDeleted(ctx context.Context, clientset kubernetes.Interface, name, namespace string, timeout time.Duration) error {
+	err := poll(ctx, timeout, func() (bool, error) {
+		_, err := Get(ctx, clientset, name, namespace)
+		return kerrors.IsNotFound(err), nil
+	})
+	if err == errPollTimeout {
+		return fmt.Errorf("timed out waiting for pvc %s to be deleted", name)
+	}
 	return err
 }
 
-// Delete a pvc
-func DeleteIfExists(clientset *kubernetes.Clientset, name string, namespace string) error {
+// DeleteAll deletes every PVC of clusterName like DeleteIfExists, so a PVC that
+// the Operator is not allowed to remove is left alone. A failure to delete one
+// PVC does not stop the others from being deleted. It returns the names of the
+// PVCs that were deleted and an error that names each PVC that was not.
+func DeleteAll(ctx context.Context, clientset kubernetes.Interface, clusterName, namespace string) ([]string, error) {
+	pvcs, err := List(ctx, clientset, clusterName, namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	deleted := []string{}
+	errs := []error{}
+	for _, pvc := range pvcs {
+		ok, err := deleteIfExists(ctx, clientset, pvc.Name, namespace, DeleteOptions{ClusterName: clusterName})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("unable to delete pvc %s: %w", pvc.Name, err))
+		} else if ok {
+			deleted = append(deleted, pvc.Name)
+		}
+	}
+
+	return deleted, utilerrors.NewAggregate(errs)
+}
+
+// deleteIfExists deletes the PVC name when it exists and carries the
+// LABEL_PGREMOVE label, unless it was created to be retained or belongs to
+// another cluster than opts.ClusterName. It reports whether a delete was issued.
+func deleteIfExists(ctx context.Context, clientset kubernetes.Interface, name string, namespace string, opts DeleteOptions) (deleted bool, err error) {
+	defer func() { deleteTotal.WithLabelValues(deleteResult(deleted, err)).Inc() }()
+
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+
 	pvc, err := kubeapi.GetPVCIfExists(clientset, name, namespace)
 	if pvc == nil {
 		// nothing to delete. return any other error.
-		return err
+		return false, err
 	}
 
-	log.Debugf("PVC %s is found", pvc.Name)
+	logger := logFields(name, namespace)
+	logger.Debug("pvc is found")
+
+	if pvc.ObjectMeta.Labels[config.LABEL_PGREMOVE] != "true" {
+		return false, nil
+	}
 
-	if pvc.ObjectMeta.Labels[config.LABEL_PGREMOVE] == "true" {
-		log.Debugf("delete PVC %s in namespace %s", name, namespace)
-		err = kubeapi.DeletePVC(clientset, name, namespace)
+	if opts.ClusterName != "" && pvc.ObjectMeta.Labels[config.LABEL_PG_CLUSTER] != opts.ClusterName {
+		logger.WithField("cluster", pvc.ObjectMeta.Labels[config.LABEL_PG_CLUSTER]).
+			WithField("expectedCluster", opts.ClusterName).Warn("not deleting pvc of another cluster")
+		return false, fmt.Errorf("%w: pvc %s has %s=%q, expected %q", ErrClusterMismatch,
+			name, config.LABEL_PG_CLUSTER, pvc.ObjectMeta.Labels[config.LABEL_PG_CLUSTER], opts.ClusterName)
+	}
+
+	if pvc.ObjectMeta.Annotations[config.ANNOTATION_PVC_RETAIN_ON_DELETE] == "true" {
+		logger.Info("retaining pvc")
+		return false, nil
+	}
+
+	logger.Debug("deleting pvc")
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+
+	// the PVC may have been removed by someone else since it was found
+	err = kubeapi.DeletePVCWithOptions(clientset, name, namespace, opts.deleteOptions())
+	if kubeapi.IsNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		logger.WithError(err).Error("unable to delete pvc")
+		return false, err
+	}
+
+	logger.Info("deleted pvc")
+	return true, nil
+}
+
+// deleteOptions converts opts into the DeleteOptions of the API.
+func (opts DeleteOptions) deleteOptions() *metav1.DeleteOptions {
+	policy := opts.PropagationPolicy
+	if policy == "" {
+		policy = metav1.DeletePropagationForeground
+	}
+
+	return &metav1.DeleteOptions{
+		PropagationPolicy:  &policy,
+		GracePeriodSeconds: opts.GracePeriodSeconds,
+	}
+}
+
+// Exists test to see if pvc exists. Any error other than NotFound is logged
+// and treated as the PVC not existing; use Get to tell the two apart.
+func Exists(ctx context.Context, clientset kubernetes.Interface, name string, namespace string) bool {
+	_, err := Get(ctx, clientset, name, namespace)
+	if err != nil && !kerrors.IsNotFound(err) {
+		logFields(name, namespace).WithError(err).Error("unable to determine whether pvc exists")
+	}
+	return err == nil
+}
+
+// Get returns the PVC name. When it does not exist, the error is NotFound so
+// that it can be told apart from any other failure with kerrors.IsNotFound.
+func Get(ctx context.Context, clientset kubernetes.Interface, name, namespace string) (*v1.PersistentVolumeClaim, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	pvc, err := kubeapi.GetPVCIfExists(clientset, name, namespace)
+	if err == nil && pvc == nil {
+		err = kerrors.NewNotFound(v1.Resource("persistentvolumeclaims"), name)
+	}
+	return pvc, err
+}
+
+// PVCStatus is the state of a PVC as observed by Status
+type PVCStatus struct {
+	// Exists is false when the PVC was not found. The other fields are only
+	// set when it is true.
+	Exists bool
+
+	// Phase is one of Pending, Bound, or Lost.
+	Phase v1.PersistentVolumeClaimPhase
+
+	// Capacity is the storage of the volume bound to the PVC. It is zero until
+	// the PVC is Bound.
+	Capacity resource.Quantity
+}
+
+// Status returns the state of the PVC name. A PVC that does not exist is
+// reported through PVCStatus.Exists, while any other error is returned.
+func Status(ctx context.Context, clientset kubernetes.Interface, name, namespace string) (*PVCStatus, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	pvc, err := kubeapi.GetPVCIfExists(clientset, name, namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	status := &PVCStatus{}
+	if pvc != nil {
+		status.Exists = true
+		status.Phase = pvc.Status.Phase
+		status.Capacity = pvc.Status.Capacity[v1.ResourceStorage]
+	}
+	return status, nil
+}
+
+// WaitForBound blocks until the PVC name is Bound. A PVC whose StorageClass
+// waits for its first consumer stays Pending until a pod that uses it is
+// scheduled, so WaitForBound returns as soon as it sees such a PVC without a
+// selected node. It returns an error that includes the last observed phase
+// when the PVC is still not Bound after timeout, and immediately when the PVC
+// is Lost.
+func WaitForBound(ctx context.Context, clientset kubernetes.Interface, name, namespace string, timeout time.Duration) error {
+	phase := "not found"
+	err := poll(ctx, timeout, func() (bool, error) {
+		pvc, err := kubeapi.GetPVCIfExists(clientset, name, namespace)
+		if err != nil || pvc == nil {
+			return false, err
+		}
+
+		phase = string(pvc.Status.Phase)
+
+		switch pvc.Status.Phase {
+		case v1.ClaimBound:
+			return true, nil
+		case v1.ClaimLost:
+			return false, fmt.Errorf("pvc %s lost its volume", name)
+		case v1.ClaimPending:
+			if pvc.Annotations[annotationSelectedNode] == "" {
+				waiting, err := waitsForFirstConsumer(clientset, pvc)
+				if waiting {
+					logFields(name, namespace).Debug("pvc waits for its first consumer")
+				}
+				return waiting, err
+			}
+		}
+		return false, nil
+	})
+	if err == errPollTimeout {
+		return fmt.Errorf("timed out waiting for pvc %s to be bound; last phase was %s", name, phase)
 	}
 	return err
 }
 
-// Exists test to see if pvc exists
-func Exists(clientset *kubernetes.Clientset, name string, namespace string) bool {
-	pvc, _ := kubeapi.GetPVCIfExists(clientset, name, namespace)
-	return pvc != nil
+// waitsForFirstConsumer returns whether the StorageClass of pvc delays binding
+// until a pod that uses it is scheduled. A PVC without a StorageClass name uses
+// the default StorageClass, if there is one.
+func waitsForFirstConsumer(clientset kubernetes.Interface, pvc *v1.PersistentVolumeClaim) (bool, error) {
+	var class *storagev1.StorageClass
+
+	if pvc.Spec.StorageClassName == nil {
+		classes, err := clientset.StorageV1().StorageClasses().List(metav1.ListOptions{})
+		if err != nil {
+			return false, err
+		}
+		for i := range classes.Items {
+			if classes.Items[i].Annotations[annotationDefaultStorageClass] == "true" {
+				class = &classes.Items[i]
+			}
+		}
+	} else if *pvc.Spec.StorageClassName != "" {
+		found, err := clientset.StorageV1().StorageClasses().Get(*pvc.Spec.StorageClassName, metav1.GetOptions{})
+		if err != nil && !kerrors.IsNotFound(err) {
+			return false, err
+		}
+		if err == nil {
+			class = found
+		}
+	}
+
+	return class != nil && class.VolumeBindingMode != nil &&
+		*class.VolumeBindingMode == storagev1.VolumeBindingWaitForFirstConsumer, nil
 }
 
-func getMatchLabels(key, value string) string {
+// List returns every PVC in namespace that carries the pg-cluster label of
+// clusterName. This includes the data, WAL, and tablespace volumes of the
+// cluster, as well as any other claim the operator has labeled for it.
+func List(ctx context.Context, clientset kubernetes.Interface, clusterName, namespace string) ([]v1.PersistentVolumeClaim, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	selector := config.LABEL_PG_CLUSTER + "=" + clusterName
+	list, err := clientset.CoreV1().PersistentVolumeClaims(namespace).List(
+		metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return nil, err
+	}
 
-	matchLabelsTemplateFields := matchLabelsTemplateFields{}
-	matchLabelsTemplateFields.Key = key
-	matchLabelsTemplateFields.Value = value
+	return list.Items, nil
+}
 
-	var doc bytes.Buffer
-	err := config.PVCMatchLabelsTemplate.Execute(&doc, matchLabelsTemplateFields)
+// TotalRequestedStorage sums the storage of every PVC returned by List for
+// clusterName. A bound claim counts the capacity it was given; a claim that is
+// still pending has no capacity yet and counts the amount it requested.
+func TotalRequestedStorage(ctx context.Context, clientset kubernetes.Interface, clusterName, namespace string) (resource.Quantity, error) {
+	var total resource.Quantity
+
+	pvcs, err := List(ctx, clientset, clusterName, namespace)
 	if err != nil {
-		log.Error(err.Error())
-		return ""
+		return total, err
 	}
 
-	return doc.String()
+	for i := range pvcs {
+		if capacity, ok := pvcs[i].Status.Capacity[v1.ResourceStorage]; ok {
+			total.Add(capacity)
+		} else {
+			total.Add(pvcs[i].Spec.Resources.Requests[v1.ResourceStorage])
+		}
+	}
 
+	return total, nil
 }
@@ -0,0 +1,2914 @@
+package pvc
+
+/*
+ Copyright 2020 Crunchy Data Solutions, Inc.
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/crunchydata/postgres-operator/internal/config"
+	"github.com/crunchydata/postgres-operator/internal/operator"
+	crv1 "github.com/crunchydata/postgres-operator/pkg/apis/crunchydata.com/v1"
+	log "github.com/sirupsen/logrus"
+	v1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+	corev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/rest"
+	k8stesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/record"
+)
+
+func TestCreate(t *testing.T) {
+	for _, storageType := range []string{"create", "dynamic"} {
+		t.Run(storageType, func(t *testing.T) {
+			clientset := fake.NewSimpleClientset(newTestStorageClass("standard", false))
+			spec := crv1.PgStorageSpec{
+				AccessMode:   "ReadWriteOnce",
+				Size:         "1G",
+				StorageClass: "standard",
+				StorageType:  storageType,
+			}
+
+			created, err := Create(context.Background(), clientset, "some-pvc", "some-cluster", "ns", CreateOptions{Spec: &spec})
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+
+			stored, err := clientset.CoreV1().PersistentVolumeClaims("ns").Get("some-pvc", metav1.GetOptions{})
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if !reflect.DeepEqual(created, stored) {
+				t.Errorf("expected %v, got %v", stored, created)
+			}
+
+			if created.Name != "some-pvc" {
+				t.Errorf("expected name %q, got %q", "some-pvc", created.Name)
+			}
+			if created.Labels[config.LABEL_PG_CLUSTER] != "some-cluster" {
+				t.Errorf("expected cluster label, got %v", created.Labels)
+			}
+			if q := created.Spec.Resources.Requests[v1.ResourceStorage]; q.String() != "1G" {
+				t.Errorf("expected size %q, got %q", "1G", q.String())
+			}
+		})
+	}
+}
+
+func TestCreateStorageClass(t *testing.T) {
+	create := func(clientset *fake.Clientset, storageClass string) error {
+		spec := crv1.PgStorageSpec{
+			AccessMode:   "ReadWriteOnce",
+			Size:         "1G",
+			StorageClass: storageClass,
+			StorageType:  "dynamic",
+		}
+		_, err := Create(context.Background(), clientset, "some-pvc", "some-cluster", "ns", CreateOptions{Spec: &spec})
+		return err
+	}
+
+	t.Run("existing class", func(t *testing.T) {
+		clientset := fake.NewSimpleClientset(newTestStorageClass("standard", false))
+		if err := create(clientset, "standard"); err != nil {
+			t.Errorf("expected no error, got %v", err)
+		}
+	})
+
+	t.Run("missing class", func(t *testing.T) {
+		clientset := fake.NewSimpleClientset(newTestStorageClass("standard", false))
+		err := create(clientset, "standrad")
+		if err == nil || !strings.Contains(err.Error(), `"standrad"`) {
+			t.Fatalf("expected the error to name the class, got %v", err)
+		}
+		if _, err := clientset.CoreV1().PersistentVolumeClaims("ns").Get("some-pvc", metav1.GetOptions{}); !kerrors.IsNotFound(err) {
+			t.Errorf("expected no pvc to be created, got %v", err)
+		}
+	})
+
+	t.Run("default class", func(t *testing.T) {
+		clientset := fake.NewSimpleClientset()
+		if err := create(clientset, ""); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		for _, action := range clientset.Actions() {
+			if action.GetResource().Resource == "storageclasses" {
+				t.Errorf("expected the default class not to be checked, got %v", action)
+			}
+		}
+	})
+}
+
+func TestNewPersistentVolumeClaim(t *testing.T) {
+	labels := map[string]string{
+		config.LABEL_VENDOR:     config.LABEL_CRUNCHY,
+		config.LABEL_PGREMOVE:   "true",
+		config.LABEL_PG_CLUSTER: "some-cluster",
+	}
+	standard := "standard"
+
+	for _, tt := range []struct {
+		name     string
+		spec     crv1.PgStorageSpec
+		expected v1.PersistentVolumeClaimSpec
+	}{
+		{
+			name: "create",
+			spec: crv1.PgStorageSpec{
+				AccessMode: "ReadWriteOnce", Size: "1G", StorageType: "create",
+				StorageClass: "ignored",
+			},
+			expected: v1.PersistentVolumeClaimSpec{
+				AccessModes: []v1.PersistentVolumeAccessMode{v1.ReadWriteOnce},
+				Resources: v1.ResourceRequirements{
+					Requests: v1.ResourceList{v1.ResourceStorage: resource.MustParse("1G")},
+				},
+			},
+		},
+		{
+			name: "create with match labels",
+			spec: crv1.PgStorageSpec{
+				AccessMode: "ReadWriteMany", Size: "5Gi", StorageType: "create",
+				MatchLabels: "tier=gold",
+			},
+			expected: v1.PersistentVolumeClaimSpec{
+				AccessModes: []v1.PersistentVolumeAccessMode{v1.ReadWriteMany},
+				Resources: v1.ResourceRequirements{
+					Requests: v1.ResourceList{v1.ResourceStorage: resource.MustParse("5Gi")},
+				},
+				Selector: &metav1.LabelSelector{
+					MatchLabels: map[string]string{"tier": "gold"},
+				},
+			},
+		},
+		{
+			name: "dynamic",
+			spec: crv1.PgStorageSpec{
+				AccessMode: "ReadWriteOnce", Size: "1G", StorageType: "dynamic",
+				StorageClass: "standard", MatchLabels: "tier=gold",
+			},
+			expected: v1.PersistentVolumeClaimSpec{
+				AccessModes: []v1.PersistentVolumeAccessMode{v1.ReadWriteOnce},
+				Resources: v1.ResourceRequirements{
+					Requests: v1.ResourceList{v1.ResourceStorage: resource.MustParse("1G")},
+				},
+				StorageClassName: &standard,
+			},
+		},
+		{
+			name: "dynamic with default class",
+			spec: crv1.PgStorageSpec{
+				AccessMode: "ReadWriteOnce", Size: "1G", StorageType: "dynamic",
+			},
+			expected: v1.PersistentVolumeClaimSpec{
+				AccessModes: []v1.PersistentVolumeAccessMode{v1.ReadWriteOnce},
+				Resources: v1.ResourceRequirements{
+					Requests: v1.ResourceList{v1.ResourceStorage: resource.MustParse("1G")},
+				},
+			},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			pvc, err := newPersistentVolumeClaim("some-pvc", "some-cluster", &tt.spec)
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+
+			if pvc.Name != "some-pvc" {
+				t.Errorf("expected name %q, got %q", "some-pvc", pvc.Name)
+			}
+			if !reflect.DeepEqual(labels, pvc.Labels) {
+				t.Errorf("expected labels %v, got %v", labels, pvc.Labels)
+			}
+			if !reflect.DeepEqual(tt.expected.AccessModes, pvc.Spec.AccessModes) {
+				t.Errorf("expected access modes %v, got %v", tt.expected.AccessModes, pvc.Spec.AccessModes)
+			}
+			if !reflect.DeepEqual(tt.expected.Resources, pvc.Spec.Resources) {
+				t.Errorf("expected resources %v, got %v", tt.expected.Resources, pvc.Spec.Resources)
+			}
+			if !reflect.DeepEqual(tt.expected.StorageClassName, pvc.Spec.StorageClassName) {
+				t.Errorf("expected storage class %v, got %v", tt.expected.StorageClassName, pvc.Spec.StorageClassName)
+			}
+			if !reflect.DeepEqual(tt.expected.Selector, pvc.Spec.Selector) {
+				t.Errorf("expected selector %v, got %v", tt.expected.Selector, pvc.Spec.Selector)
+			}
+		})
+	}
+
+	t.Run("invalid size", func(t *testing.T) {
+		spec := crv1.PgStorageSpec{AccessMode: "ReadWriteOnce", Size: "10 GB", StorageType: "create"}
+		if _, err := newPersistentVolumeClaim("some-pvc", "some-cluster", &spec); err == nil {
+			t.Error("expected an error")
+		}
+	})
+
+	t.Run("malformed match labels", func(t *testing.T) {
+		spec := crv1.PgStorageSpec{AccessMode: "ReadWriteOnce", Size: "1G", StorageType: "create", MatchLabels: "tier"}
+		if _, err := newPersistentVolumeClaim("some-pvc", "some-cluster", &spec); err == nil {
+			t.Error("expected an error")
+		}
+	})
+}
+
+func TestCreateIfNotExists(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+	spec := crv1.PgStorageSpec{
+		AccessMode:  "ReadWriteOnce",
+		Size:        "1G",
+		StorageType: "create",
+	}
+
+	result, err := CreateIfNotExists(context.Background(), clientset, spec, "some-pvc", "some-cluster", "ns", nil)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if result.Claim == nil || result.Claim.Name != "some-pvc" {
+		t.Errorf("expected the created claim, got %v", result.Claim)
+	}
+
+	// the claim is only returned when it was created
+	result, err = CreateIfNotExists(context.Background(), clientset, spec, "some-pvc", "some-cluster", "ns", nil)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if result.Claim != nil {
+		t.Errorf("expected no claim, got %v", result.Claim)
+	}
+	if result.PersistentVolumeClaimName != "some-pvc" {
+		t.Errorf("expected %q, got %q", "some-pvc", result.PersistentVolumeClaimName)
+	}
+}
+
+func TestCreateMissingPostgreSQLVolumesServerError(t *testing.T) {
+	defer func(backoff wait.Backoff) { DefaultCreateBackoff = backoff }(DefaultCreateBackoff)
+	DefaultCreateBackoff = wait.Backoff{Steps: 2, Duration: time.Millisecond}
+
+	clientset := fake.NewSimpleClientset()
+	clientset.PrependReactor("create", "persistentvolumeclaims",
+		func(action k8stesting.Action) (bool, runtime.Object, error) {
+			return true, nil, kerrors.NewInternalError(errors.New("etcd is unavailable"))
+		})
+
+	storage := crv1.PgStorageSpec{AccessMode: "ReadWriteOnce", Size: "1G", StorageType: "create"}
+	cluster := &crv1.Pgcluster{Spec: crv1.PgclusterSpec{Name: "hippo"}}
+
+	_, _, _, _, err := CreateMissingPostgreSQLVolumes(context.Background(), clientset, cluster, "ns", "hippo", storage)
+
+	var volumeErr *VolumeCreateError
+	if !errors.As(err, &volumeErr) || !kerrors.IsInternalError(volumeErr.Err) {
+		t.Errorf("expected an internal error, got %v", err)
+	}
+}
+
+func TestCreateMissingPostgreSQLVolumesFailure(t *testing.T) {
+	storage := crv1.PgStorageSpec{AccessMode: "ReadWriteOnce", Size: "1G", StorageType: "create"}
+	cluster := &crv1.Pgcluster{
+		Spec: crv1.PgclusterSpec{
+			Name:       "hippo",
+			WALStorage: storage,
+			TablespaceMounts: map[string]crv1.PgStorageSpec{
+				"lake": storage, "ts_reporting": storage, "zoo": storage,
+			},
+		},
+	}
+
+	// failOn rejects the PVC named name as invalid
+	failOn := func(name string) *fake.Clientset {
+		clientset := fake.NewSimpleClientset()
+		clientset.PrependReactor("create", "persistentvolumeclaims",
+			func(action k8stesting.Action) (bool, runtime.Object, error) {
+				pvc := action.(k8stesting.CreateAction).GetObject().(*v1.PersistentVolumeClaim)
+				if pvc.Name == name {
+					return true, nil, kerrors.NewBadRequest("pvc is invalid")
+				}
+				return false, nil, nil
+			})
+		return clientset
+	}
+
+	for _, tt := range []struct {
+		pvcName, role, name string
+		tablespaces         []string
+	}{
+		{"hippo", "data", "hippo", nil},
+		{"hippo-wal", "wal", "hippo-wal", nil},
+		{"hippo-tablespace-ts_reporting", "tablespace", "ts_reporting", []string{"lake"}},
+	} {
+		t.Run(tt.role, func(t *testing.T) {
+			clientset := failOn(tt.pvcName)
+
+			data, wal, tablespaces, _, err := CreateMissingPostgreSQLVolumes(context.Background(), clientset,
+				cluster, "ns", "hippo", storage)
+
+			var volumeErr *VolumeCreateError
+			if !errors.As(err, &volumeErr) {
+				t.Fatalf("expected a VolumeCreateError, got %v", err)
+			}
+			if volumeErr.Role != tt.role || volumeErr.Name != tt.name {
+				t.Errorf("expected %s %s, got %s %s", tt.role, tt.name, volumeErr.Role, volumeErr.Name)
+			}
+			if !kerrors.IsBadRequest(volumeErr.Err) {
+				t.Errorf("expected the cause to be kept, got %v", volumeErr.Err)
+			}
+
+			if (data.Claim != nil) != (tt.role != "data") {
+				t.Errorf("expected the data volume only when it was created, got %v", data.Claim)
+			}
+			if (wal.Claim != nil) != (tt.role == "tablespace") {
+				t.Errorf("expected the wal volume only when it was created, got %v", wal.Claim)
+			}
+
+			var names []string
+			for name := range tablespaces {
+				names = append(names, name)
+			}
+			if !reflect.DeepEqual(names, tt.tablespaces) {
+				t.Errorf("expected tablespaces %v, got %v", tt.tablespaces, names)
+			}
+		})
+	}
+}
+
+func TestCreateMissingPostgreSQLVolumesTablespaceStorage(t *testing.T) {
+	storage := crv1.PgStorageSpec{AccessMode: "ReadWriteOnce", Size: "1G", StorageType: "create"}
+	cluster := &crv1.Pgcluster{
+		Spec: crv1.PgclusterSpec{
+			Name:       "hippo",
+			WALStorage: storage,
+			TablespaceMounts: map[string]crv1.PgStorageSpec{
+				"fast":    {AccessMode: "ReadWriteOnce", Size: "1G", StorageType: "dynamic", StorageClass: "ssd"},
+				"lake":    {AccessMode: "ReadWriteMany", Size: "1G", StorageType: "create"},
+				"scratch": {StorageType: "emptydir"},
+				"shared":  {Size: "1G", StorageType: "dynamic"},
+				"mine":    {Name: "mine", StorageType: "existing"},
+			},
+		},
+	}
+
+	clientset := fake.NewSimpleClientset(newTestStorageClass("ssd", false))
+	_, _, tablespaces, tablespaceStorage, err := CreateMissingPostgreSQLVolumes(context.Background(), clientset,
+		cluster, "ns", "hippo", storage)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(tablespaces) != 5 {
+		t.Errorf("expected five tablespace volumes, got %v", tablespaces)
+	}
+
+	expected := map[string]TablespaceStorage{
+		"fast":    {StorageType: "dynamic", StorageClass: "ssd", AccessModes: []v1.PersistentVolumeAccessMode{v1.ReadWriteOnce}},
+		"lake":    {StorageType: "create", AccessModes: []v1.PersistentVolumeAccessMode{v1.ReadWriteMany}},
+		"scratch": {StorageType: "emptydir"},
+		"shared":  {StorageType: "dynamic", AccessModes: []v1.PersistentVolumeAccessMode{v1.ReadWriteOnce}},
+		"mine":    {StorageType: "existing"},
+	}
+	if !reflect.DeepEqual(expected, tablespaceStorage) {
+		t.Errorf("expected %v, got %v", expected, tablespaceStorage)
+	}
+
+	err = RequireTablespaceAccessMode(tablespaceStorage, v1.ReadWriteOnce)
+	if err == nil || !strings.Contains(err.Error(), "lake is ReadWriteMany") {
+		t.Errorf("expected lake to be rejected, got %v", err)
+	}
+	if err != nil && strings.Contains(err.Error(), "fast") {
+		t.Errorf("expected only lake to be rejected, got %v", err)
+	}
+
+	if err := RequireTablespaceAccessMode(tablespaceStorage, v1.ReadWriteMany); err == nil ||
+		!strings.Contains(err.Error(), "fast is ReadWriteOnce, shared is ReadWriteOnce") {
+		t.Errorf("expected fast and shared to be rejected, got %v", err)
+	}
+
+	t.Run("invalid access mode", func(t *testing.T) {
+		invalid := cluster.DeepCopy()
+		invalid.Spec.TablespaceMounts["lake"] = crv1.PgStorageSpec{AccessMode: "ReadSometimes", Size: "1G", StorageType: "create"}
+
+		clientset := fake.NewSimpleClientset(newTestStorageClass("ssd", false))
+		_, _, _, _, err := CreateMissingPostgreSQLVolumes(context.Background(), clientset,
+			invalid, "ns", "hippo", storage)
+
+		var volumeErr *VolumeCreateError
+		if !errors.As(err, &volumeErr) || volumeErr.Name != "lake" {
+			t.Fatalf("expected lake to fail, got %v", err)
+		}
+		if actions := clientset.Actions(); len(actions) != 0 {
+			t.Errorf("expected nothing to be created, got %v", actions)
+		}
+	})
+}
+
+func TestCreateMissingPostgreSQLVolumesWAL(t *testing.T) {
+	data := crv1.PgStorageSpec{AccessMode: "ReadWriteOnce", Size: "1G", StorageType: "dynamic", StorageClass: "standard"}
+	cluster := func(wal crv1.PgStorageSpec) *crv1.Pgcluster {
+		return &crv1.Pgcluster{Spec: crv1.PgclusterSpec{Name: "hippo", WALStorage: wal}}
+	}
+	created := func(clientset *fake.Clientset) []string {
+		names := []string{}
+		for _, action := range clientset.Actions() {
+			if create, ok := action.(k8stesting.CreateAction); ok {
+				names = append(names, create.GetObject().(*v1.PersistentVolumeClaim).Name)
+			}
+		}
+		return names
+	}
+
+	t.Run("separate class", func(t *testing.T) {
+		clientset := fake.NewSimpleClientset(newTestStorageClass("standard", false), newTestStorageClass("ssd", false))
+		wal := crv1.PgStorageSpec{AccessMode: "ReadWriteOnce", Size: "1G", StorageType: "dynamic", StorageClass: "ssd"}
+
+		_, walVolume, _, _, err := CreateMissingPostgreSQLVolumes(context.Background(), clientset,
+			cluster(wal), "ns", "hippo", data)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if walVolume.Claim == nil || *walVolume.Claim.Spec.StorageClassName != "ssd" {
+			t.Errorf("expected a wal volume of class ssd, got %v", walVolume.Claim)
+		}
+		if names := created(clientset); !reflect.DeepEqual(names, []string{"hippo", "hippo-wal"}) {
+			t.Errorf("expected data and wal volumes, got %v", names)
+		}
+	})
+
+	t.Run("shared class", func(t *testing.T) {
+		clientset := fake.NewSimpleClientset(newTestStorageClass("standard", false))
+
+		_, walVolume, _, _, err := CreateMissingPostgreSQLVolumes(context.Background(), clientset,
+			cluster(data), "ns", "hippo", data)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if walVolume.PersistentVolumeClaimName != "hippo-wal" {
+			t.Errorf("expected a wal volume, got %v", walVolume)
+		}
+	})
+
+	t.Run("missing class", func(t *testing.T) {
+		clientset := fake.NewSimpleClientset(newTestStorageClass("standard", false))
+		wal := crv1.PgStorageSpec{AccessMode: "ReadWriteOnce", Size: "1G", StorageType: "dynamic", StorageClass: "ssd"}
+
+		_, _, _, _, err := CreateMissingPostgreSQLVolumes(context.Background(), clientset,
+			cluster(wal), "ns", "hippo", data)
+
+		var volumeErr *VolumeCreateError
+		if !errors.As(err, &volumeErr) || volumeErr.Role != "wal" {
+			t.Fatalf("expected the wal volume to fail, got %v", err)
+		}
+		if !strings.Contains(err.Error(), `"ssd" does not exist`) {
+			t.Errorf("expected the class to be named, got %v", err)
+		}
+		if names := created(clientset); len(names) != 0 {
+			t.Errorf("expected no volumes to be created, got %v", names)
+		}
+	})
+
+	t.Run("empty", func(t *testing.T) {
+		clientset := fake.NewSimpleClientset(newTestStorageClass("standard", false))
+
+		dataVolume, walVolume, _, _, err := CreateMissingPostgreSQLVolumes(context.Background(), clientset,
+			cluster(crv1.PgStorageSpec{}), "ns", "hippo", data)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if dataVolume.PersistentVolumeClaimName != "hippo" {
+			t.Errorf("expected a data volume, got %v", dataVolume)
+		}
+		if !reflect.DeepEqual(walVolume, operator.StorageResult{}) {
+			t.Errorf("expected no wal volume, got %v", walVolume)
+		}
+		if names := created(clientset); !reflect.DeepEqual(names, []string{"hippo"}) {
+			t.Errorf("expected only the data volume, got %v", names)
+		}
+	})
+}
+
+func TestCreateClusterVolumes(t *testing.T) {
+	data := crv1.PgStorageSpec{AccessMode: "ReadWriteOnce", Size: "1G", StorageType: "dynamic", StorageClass: "standard"}
+	repo := crv1.PgStorageSpec{AccessMode: "ReadWriteOnce", Size: "2G", StorageType: "dynamic", StorageClass: "standard"}
+	cluster := func(backrestStorageType string) *crv1.Pgcluster {
+		return &crv1.Pgcluster{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:   "hippo",
+				Labels: map[string]string{config.LABEL_BACKREST: "true"},
+			},
+			Spec: crv1.PgclusterSpec{
+				Name:            "hippo",
+				BackrestStorage: repo,
+				UserLabels:      map[string]string{config.LABEL_BACKREST_STORAGE_TYPE: backrestStorageType},
+			},
+		}
+	}
+	created := func(clientset *fake.Clientset) []string {
+		names := []string{}
+		for _, action := range clientset.Actions() {
+			if create, ok := action.(k8stesting.CreateAction); ok {
+				names = append(names, create.GetObject().(*v1.PersistentVolumeClaim).Name)
+			}
+		}
+		return names
+	}
+
+	// the repo Deployment mounts the volume even when backups are only in s3
+	for _, storageType := range []string{"", "local", "local,s3", "s3"} {
+		t.Run("repo "+storageType, func(t *testing.T) {
+			clientset := fake.NewSimpleClientset(newTestStorageClass("standard", false))
+
+			volumes, err := CreateClusterVolumes(context.Background(), clientset,
+				cluster(storageType), "ns", "hippo", data)
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if volumes.Data.PersistentVolumeClaimName != "hippo" {
+				t.Errorf("expected a data volume, got %v", volumes.Data)
+			}
+			if volumes.BackrestRepo.PersistentVolumeClaimName != "hippo-pgbr-repo" || volumes.BackrestRepo.Claim == nil {
+				t.Errorf("expected a repo volume to be created, got %v", volumes.BackrestRepo)
+			}
+			if names := created(clientset); !reflect.DeepEqual(names, []string{"hippo", "hippo-pgbr-repo"}) {
+				t.Errorf("expected data and repo volumes, got %v", names)
+			}
+
+			// a second call finds everything in place
+			clientset.ClearActions()
+			volumes, err = CreateClusterVolumes(context.Background(), clientset,
+				cluster(storageType), "ns", "hippo", data)
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if volumes.BackrestRepo.PersistentVolumeClaimName != "hippo-pgbr-repo" || volumes.BackrestRepo.Claim != nil {
+				t.Errorf("expected the existing repo volume, got %v", volumes.BackrestRepo)
+			}
+			if volumes.Data.Created || volumes.BackrestRepo.Created {
+				t.Errorf("expected nothing to be created, got %v and %v", volumes.Data, volumes.BackrestRepo)
+			}
+		})
+	}
+
+	t.Run("pgbackrest disabled", func(t *testing.T) {
+		clientset := fake.NewSimpleClientset(newTestStorageClass("standard", false))
+
+		disabled := cluster("")
+		disabled.Labels[config.LABEL_BACKREST] = "false"
+
+		volumes, err := CreateClusterVolumes(context.Background(), clientset,
+			disabled, "ns", "hippo", data)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if !reflect.DeepEqual(volumes.BackrestRepo, operator.StorageResult{}) {
+			t.Errorf("expected no repo volume, got %v", volumes.BackrestRepo)
+		}
+		if names := created(clientset); !reflect.DeepEqual(names, []string{"hippo"}) {
+			t.Errorf("expected only the data volume, got %v", names)
+		}
+	})
+
+	t.Run("repo failure", func(t *testing.T) {
+		clientset := fake.NewSimpleClientset(newTestStorageClass("standard", false))
+
+		failing := cluster("local")
+		failing.Spec.BackrestStorage.Size = "2 GB"
+
+		volumes, err := CreateClusterVolumes(context.Background(), clientset, failing, "ns", "hippo", data)
+
+		var volumeErr *VolumeCreateError
+		if !errors.As(err, &volumeErr) || volumeErr.Role != "repo" || volumeErr.Name != "hippo-pgbr-repo" {
+			t.Fatalf("expected the repo volume to fail, got %v", err)
+		}
+		if volumes.Data.PersistentVolumeClaimName != "hippo" {
+			t.Errorf("expected the data volume to be returned, got %v", volumes.Data)
+		}
+	})
+}
+
+func TestReconcilePostgreSQLVolumes(t *testing.T) {
+	spec := crv1.PgStorageSpec{AccessMode: "ReadWriteOnce", Size: "1G", StorageType: "create"}
+	cluster := &crv1.Pgcluster{Spec: crv1.PgclusterSpec{
+		Name:             "hippo",
+		WALStorage:       spec,
+		TablespaceMounts: map[string]crv1.PgStorageSpec{"ts1": spec},
+	}}
+	tablespace := tablespacePVCName("hippo", "ts1")
+
+	clientset := fake.NewSimpleClientset()
+
+	// the first pass creates every volume
+	volumes, created, err := ReconcilePostgreSQLVolumes(context.Background(), clientset,
+		cluster, "ns", "hippo", spec, nil)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if expected := []string{"hippo", "hippo-wal", tablespace}; !reflect.DeepEqual(created, expected) {
+		t.Errorf("expected %v, got %v", expected, created)
+	}
+	for _, name := range []string{"hippo", "hippo-wal", tablespace} {
+		if volumes[name].PersistentVolumeClaimName != name {
+			t.Errorf("expected volume %s, got %v", name, volumes[name])
+		}
+	}
+
+	t.Run("unchanged", func(t *testing.T) {
+		clientset.ClearActions()
+
+		again, created, err := ReconcilePostgreSQLVolumes(context.Background(), clientset,
+			cluster, "ns", "hippo", spec, volumes)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if len(created) != 0 {
+			t.Errorf("expected no volumes to be created, got %v", created)
+		}
+		if actions := clientset.Actions(); len(actions) != 0 {
+			t.Errorf("expected no calls to the API server, got %v", actions)
+		}
+		for name, volume := range again {
+			if volume.Claim != nil || volume.PersistentVolumeClaimName != name {
+				t.Errorf("expected volume %s without a claim, got %v", name, volume)
+			}
+		}
+	})
+
+	t.Run("missing from prior", func(t *testing.T) {
+		clientset := fake.NewSimpleClientset()
+		prior := map[string]operator.StorageResult{
+			"hippo":    volumes["hippo"],
+			tablespace: volumes[tablespace],
+		}
+
+		_, created, err := ReconcilePostgreSQLVolumes(context.Background(), clientset,
+			cluster, "ns", "hippo", spec, prior)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if expected := []string{"hippo-wal"}; !reflect.DeepEqual(created, expected) {
+			t.Errorf("expected %v, got %v", expected, created)
+		}
+	})
+
+	t.Run("changed type", func(t *testing.T) {
+		clientset := fake.NewSimpleClientset()
+		emptydir := *cluster
+		emptydir.Spec.WALStorage = crv1.PgStorageSpec{StorageType: "emptydir"}
+
+		again, created, err := ReconcilePostgreSQLVolumes(context.Background(), clientset,
+			&emptydir, "ns", "hippo", spec, volumes)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if len(created) != 0 {
+			t.Errorf("expected no volumes to be created, got %v", created)
+		}
+		if again["hippo-wal"].PersistentVolumeClaimName != "" {
+			t.Errorf("expected an emptydir wal volume, got %v", again["hippo-wal"])
+		}
+	})
+
+	t.Run("changed size", func(t *testing.T) {
+		clientset := fake.NewSimpleClientset(newTestStorageClass("fast", true))
+		dynamic := crv1.PgStorageSpec{AccessMode: "ReadWriteOnce", Size: "1Gi", StorageType: "dynamic", StorageClass: "fast"}
+		cluster := &crv1.Pgcluster{Spec: crv1.PgclusterSpec{Name: "hippo"}}
+
+		volumes, _, err := ReconcilePostgreSQLVolumes(context.Background(), clientset,
+			cluster, "ns", "hippo", dynamic, nil)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		dynamic.Size = "2Gi"
+		again, _, err := ReconcilePostgreSQLVolumes(context.Background(), clientset,
+			cluster, "ns", "hippo", dynamic, volumes)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if size := again["hippo"].Size; size == nil || size.String() != "2Gi" {
+			t.Errorf("expected the new size, got %v", size)
+		}
+
+		pvc, _ := clientset.CoreV1().PersistentVolumeClaims("ns").Get("hippo", metav1.GetOptions{})
+		if q := pvc.Spec.Resources.Requests[v1.ResourceStorage]; q.String() != "2Gi" {
+			t.Errorf("expected the pvc to be grown to 2Gi, got %q", q.String())
+		}
+	})
+
+	t.Run("failure", func(t *testing.T) {
+		clientset := fake.NewSimpleClientset()
+		clientset.PrependReactor("create", "persistentvolumeclaims", func(action k8stesting.Action) (bool, runtime.Object, error) {
+			if action.(k8stesting.CreateAction).GetObject().(*v1.PersistentVolumeClaim).Name == "hippo-wal" {
+				return true, nil, kerrors.NewForbidden(v1.Resource("persistentvolumeclaims"), "hippo-wal", errors.New("quota"))
+			}
+			return false, nil, nil
+		})
+
+		volumes, created, err := ReconcilePostgreSQLVolumes(context.Background(), clientset,
+			cluster, "ns", "hippo", spec, nil)
+		if err == nil {
+			t.Fatal("expected an error")
+		}
+		if _, ok := volumes["hippo"]; !ok || len(volumes) != 1 {
+			t.Errorf("expected only the data volume, got %v", volumes)
+		}
+		if expected := []string{"hippo"}; !reflect.DeepEqual(created, expected) {
+			t.Errorf("expected %v, got %v", expected, created)
+		}
+
+		// nothing is recorded when the specifications are invalid
+		invalid := *cluster
+		invalid.Spec.TablespaceMounts = map[string]crv1.PgStorageSpec{"ts1": {StorageType: "create", AccessMode: "sideways"}}
+		volumes, _, err = ReconcilePostgreSQLVolumes(context.Background(), fake.NewSimpleClientset(),
+			&invalid, "ns", "hippo", spec, nil)
+		if err == nil {
+			t.Fatal("expected an error")
+		}
+		if len(volumes) != 0 {
+			t.Errorf("expected no volumes, got %v", volumes)
+		}
+	})
+}
+
+func TestMatchesPrior(t *testing.T) {
+	fsGroup, otherGroup := int64(26), int64(27)
+	size := resource.MustParse("1Gi")
+	spec := crv1.PgStorageSpec{AccessMode: "ReadWriteOnce", Size: "1Gi", StorageType: "dynamic", StorageClass: "fast", FSGroup: &fsGroup}
+	volume := operator.StorageResult{
+		PersistentVolumeClaimName: "hippo",
+		SupplementalGroups:        SupplementalGroupsFor(spec),
+		FSGroup:                   &fsGroup,
+		Size:                      &size,
+		StorageClass:              "fast",
+	}
+
+	if !matchesPrior(spec, "hippo", volume) {
+		t.Errorf("expected %v to match %v", volume, spec)
+	}
+
+	for name, change := range map[string]func(*crv1.PgStorageSpec){
+		"size":          func(s *crv1.PgStorageSpec) { s.Size = "2Gi" },
+		"storage class": func(s *crv1.PgStorageSpec) { s.StorageClass = "slow" },
+		"fs group":      func(s *crv1.PgStorageSpec) { s.FSGroup = &otherGroup },
+		"no fs group":   func(s *crv1.PgStorageSpec) { s.FSGroup = nil },
+		"groups":        func(s *crv1.PgStorageSpec) { s.SupplementalGroups = "65534" },
+		"type":          func(s *crv1.PgStorageSpec) { s.StorageType = "emptydir" },
+	} {
+		changed := spec
+		change(&changed)
+		if matchesPrior(changed, "hippo", volume) {
+			t.Errorf("expected a changed %s not to match", name)
+		}
+	}
+
+	existing := crv1.PgStorageSpec{StorageType: "existing", Name: "mine", ReadOnly: true}
+	if matchesPrior(existing, "hippo", operator.StorageResult{PersistentVolumeClaimName: "mine"}) {
+		t.Error("expected a change to read-only not to match")
+	}
+	if !matchesPrior(existing, "hippo", operator.StorageResult{PersistentVolumeClaimName: "mine", ReadOnly: true}) {
+		t.Error("expected the same existing claim to match")
+	}
+}
+
+func TestCreateRetry(t *testing.T) {
+	spec := crv1.PgStorageSpec{AccessMode: "ReadWriteOnce", Size: "1G", StorageType: "create"}
+	opts := CreateOptions{Spec: &spec, Backoff: &wait.Backoff{Steps: 3, Duration: time.Millisecond}}
+
+	// failing makes the first count attempts to create a PVC return err
+	failing := func(count int, err error) (*fake.Clientset, *int) {
+		clientset := fake.NewSimpleClientset()
+		attempts := 0
+		clientset.PrependReactor("create", "persistentvolumeclaims",
+			func(action k8stesting.Action) (bool, runtime.Object, error) {
+				attempts++
+				if attempts <= count {
+					return true, nil, err
+				}
+				return false, nil, nil
+			})
+		return clientset, &attempts
+	}
+
+	t.Run("transient", func(t *testing.T) {
+		clientset, attempts := failing(2, kerrors.NewInternalError(errors.New("etcd is unavailable")))
+
+		created, err := Create(context.Background(), clientset, "some-pvc", "some-cluster", "ns", opts)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if created == nil || created.Name != "some-pvc" {
+			t.Errorf("expected the created claim, got %v", created)
+		}
+		if *attempts != 3 {
+			t.Errorf("expected 3 attempts, got %d", *attempts)
+		}
+	})
+
+	t.Run("exhausted", func(t *testing.T) {
+		clientset, attempts := failing(5, kerrors.NewServerTimeout(v1.Resource("persistentvolumeclaims"), "create", 1))
+
+		_, err := Create(context.Background(), clientset, "some-pvc", "some-cluster", "ns", opts)
+		if !kerrors.IsServerTimeout(err) {
+			t.Errorf("expected the last error, got %v", err)
+		}
+		if *attempts != 3 {
+			t.Errorf("expected 3 attempts, got %d", *attempts)
+		}
+	})
+
+	t.Run("permanent", func(t *testing.T) {
+		for _, err := range []error{
+			kerrors.NewAlreadyExists(v1.Resource("persistentvolumeclaims"), "some-pvc"),
+			kerrors.NewBadRequest("spec is invalid"),
+		} {
+			clientset, attempts := failing(1, err)
+
+			if _, actual := Create(context.Background(), clientset, "some-pvc", "some-cluster", "ns", opts); actual == nil {
+				t.Errorf("expected %v, got nil", err)
+			}
+			if *attempts != 1 {
+				t.Errorf("expected %v not to be retried, got %d attempts", err, *attempts)
+			}
+		}
+	})
+}
+
+func TestCreateMissingPostgreSQLVolumesTablespaceConflict(t *testing.T) {
+	// the generated names do not truncate today, so substitute a function that
+	// truncates them to the length of a label value
+	defer func(f func(string, string) string) { tablespacePVCName = f }(tablespacePVCName)
+	tablespacePVCName = func(prefix, tablespace string) string {
+		name := prefix + "-tablespace-" + tablespace
+		if len(name) > 63 {
+			name = name[:63]
+		}
+		return name
+	}
+
+	storage := crv1.PgStorageSpec{AccessMode: "ReadWriteOnce", Size: "1G", StorageType: "create"}
+	long := strings.Repeat("a", 60)
+	cluster := &crv1.Pgcluster{
+		Spec: crv1.PgclusterSpec{
+			Name: "hippo",
+			TablespaceMounts: map[string]crv1.PgStorageSpec{
+				long + "_reporting": storage, long + "_archive": storage, "lake": storage,
+			},
+		},
+	}
+
+	clientset := fake.NewSimpleClientset()
+	_, _, _, _, err := CreateMissingPostgreSQLVolumes(context.Background(), clientset, cluster, "ns", "hippo", storage)
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	if !strings.Contains(err.Error(), long+"_archive, "+long+"_reporting") {
+		t.Errorf("expected the error to list the conflicting tablespaces, got %v", err)
+	}
+	if strings.Contains(err.Error(), "lake") {
+		t.Errorf("expected only the conflicting tablespaces, got %v", err)
+	}
+	if actions := clientset.Actions(); len(actions) != 0 {
+		t.Errorf("expected nothing to be created, got %v", actions)
+	}
+}
+
+func TestCreateIfNotExistsMismatch(t *testing.T) {
+	spec := func(size, storageClass string) crv1.PgStorageSpec {
+		return crv1.PgStorageSpec{
+			AccessMode: "ReadWriteOnce", Size: size, StorageClass: storageClass, StorageType: "dynamic",
+		}
+	}
+	requested := func(t *testing.T, clientset *fake.Clientset) string {
+		pvc, err := clientset.CoreV1().PersistentVolumeClaims("ns").Get("some-pvc", metav1.GetOptions{})
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		q := pvc.Spec.Resources.Requests[v1.ResourceStorage]
+		return q.String()
+	}
+
+	t.Run("identical", func(t *testing.T) {
+		clientset := fake.NewSimpleClientset(
+			newTestStorageClass("standard", true), newTestPVC("some-pvc", "ns", "1Gi", "standard"))
+
+		result, err := CreateIfNotExists(context.Background(), clientset, spec("1Gi", "standard"), "some-pvc", "some-cluster", "ns", nil)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if result.Claim != nil {
+			t.Errorf("expected no claim, got %v", result.Claim)
+		}
+		if size := requested(t, clientset); size != "1Gi" {
+			t.Errorf("expected 1Gi, got %s", size)
+		}
+	})
+
+	t.Run("larger requested", func(t *testing.T) {
+		clientset := fake.NewSimpleClientset(
+			newTestStorageClass("standard", true), newTestPVC("some-pvc", "ns", "1Gi", "standard"))
+
+		if _, err := CreateIfNotExists(context.Background(), clientset, spec("2Gi", "standard"), "some-pvc", "some-cluster", "ns", nil); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if size := requested(t, clientset); size != "2Gi" {
+			t.Errorf("expected the pvc to be resized to 2Gi, got %s", size)
+		}
+	})
+
+	t.Run("larger requested of non-expandable class", func(t *testing.T) {
+		clientset := fake.NewSimpleClientset(
+			newTestStorageClass("standard", false), newTestPVC("some-pvc", "ns", "1Gi", "standard"))
+
+		_, err := CreateIfNotExists(context.Background(), clientset, spec("2Gi", "standard"), "some-pvc", "some-cluster", "ns", nil)
+		if !errors.Is(err, ErrStorageMismatch) {
+			t.Fatalf("expected %v, got %v", ErrStorageMismatch, err)
+		}
+		if !strings.Contains(err.Error(), "1Gi") || !strings.Contains(err.Error(), "2Gi") {
+			t.Errorf("expected the error to name both sizes, got %v", err)
+		}
+		if size := requested(t, clientset); size != "1Gi" {
+			t.Errorf("expected the pvc to be unchanged, got %s", size)
+		}
+	})
+
+	t.Run("different class", func(t *testing.T) {
+		clientset := fake.NewSimpleClientset(
+			newTestStorageClass("standard", true), newTestStorageClass("fast", true),
+			newTestPVC("some-pvc", "ns", "1Gi", "standard"))
+
+		_, err := CreateIfNotExists(context.Background(), clientset, spec("2Gi", "fast"), "some-pvc", "some-cluster", "ns", nil)
+		if !errors.Is(err, ErrStorageMismatch) {
+			t.Fatalf("expected %v, got %v", ErrStorageMismatch, err)
+		}
+		if !strings.Contains(err.Error(), `"standard"`) || !strings.Contains(err.Error(), `"fast"`) {
+			t.Errorf("expected the error to name both classes, got %v", err)
+		}
+		if size := requested(t, clientset); size != "1Gi" {
+			t.Errorf("expected the pvc to be unchanged, got %s", size)
+		}
+	})
+}
+
+func TestCreateCanceled(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+	spec := crv1.PgStorageSpec{
+		AccessMode:  "ReadWriteOnce",
+		Size:        "1G",
+		StorageType: "create",
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := Create(ctx, clientset, "some-pvc", "some-cluster", "ns", CreateOptions{Spec: &spec}); err != context.Canceled {
+		t.Errorf("expected %v, got %v", context.Canceled, err)
+	}
+	if _, err := CreateIfNotExists(ctx, clientset, spec, "some-pvc", "some-cluster", "ns", nil); err != context.Canceled {
+		t.Errorf("expected %v, got %v", context.Canceled, err)
+	}
+	if actions := clientset.Actions(); len(actions) != 0 {
+		t.Errorf("expected no API calls, got %v", actions)
+	}
+}
+
+func TestParseMatchLabels(t *testing.T) {
+	for _, tt := range []struct {
+		value    string
+		expected map[string]string
+	}{
+		{"", map[string]string{}},
+		{"tier=gold", map[string]string{"tier": "gold"}},
+		{"tier=gold,zone=us-east-1a", map[string]string{"tier": "gold", "zone": "us-east-1a"}},
+		{"tier=gold, zone=us-east-1a,", map[string]string{"tier": "gold", "zone": "us-east-1a"}},
+		{"tier=", map[string]string{"tier": ""}},
+	} {
+		actual, err := parseMatchLabels(tt.value)
+		if err != nil {
+			t.Errorf("expected no error for %q, got %v", tt.value, err)
+		}
+		if !reflect.DeepEqual(tt.expected, actual) {
+			t.Errorf("expected %v for %q, got %v", tt.expected, tt.value, actual)
+		}
+	}
+
+	for _, value := range []string{"tier", "tier=gold,zone", "=gold", "a=b=c"} {
+		_, err := parseMatchLabels(value)
+		if err == nil {
+			t.Errorf("expected an error for %q", value)
+		}
+	}
+
+	if _, err := parseMatchLabels("tier=gold,zone"); err == nil || !strings.Contains(err.Error(), `"zone"`) {
+		t.Errorf("expected the error to name the segment, got %v", err)
+	}
+
+	t.Run("label syntax", func(t *testing.T) {
+		if actual, err := parseMatchLabels("example.com/tier=gold_1"); err != nil {
+			t.Errorf("expected no error, got %v", err)
+		} else if actual["example.com/tier"] != "gold_1" {
+			t.Errorf("expected the label, got %v", actual)
+		}
+
+		for value, token := range map[string]string{
+			"bad key=gold":        `"bad key"`,
+			"a/b/c=gold":          `"a/b/c"`,
+			"tier=gold,zone=us/e": `"us/e"`,
+			"tier=not gold":       `"not gold"`,
+			"tier=-gold":          `"-gold"`,
+		} {
+			_, err := parseMatchLabels(value)
+			if err == nil || !strings.Contains(err.Error(), token) {
+				t.Errorf("expected an error naming %s for %q, got %v", token, value, err)
+			}
+		}
+	})
+}
+
+func TestStorageSelector(t *testing.T) {
+	t.Run("empty", func(t *testing.T) {
+		for _, spec := range []crv1.PgStorageSpec{
+			{},
+			{Selector: &metav1.LabelSelector{}},
+			{MatchLabels: ","},
+		} {
+			selector, err := storageSelector(&spec)
+			if err != nil {
+				t.Errorf("expected no error, got %v", err)
+			}
+			if selector != nil {
+				t.Errorf("expected nil, got %v", selector)
+			}
+		}
+	})
+
+	t.Run("expressions", func(t *testing.T) {
+		spec := crv1.PgStorageSpec{
+			MatchLabels: "tier=gold",
+			Selector: &metav1.LabelSelector{
+				MatchExpressions: []metav1.LabelSelectorRequirement{
+					{Key: "zone", Operator: metav1.LabelSelectorOpIn, Values: []string{"a", "b"}},
+					{Key: "ssd", Operator: metav1.LabelSelectorOpExists},
+				},
+			},
+		}
+
+		selector, err := storageSelector(&spec)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		expected := &metav1.LabelSelector{
+			MatchLabels:      map[string]string{"tier": "gold"},
+			MatchExpressions: spec.Selector.MatchExpressions,
+		}
+		if !reflect.DeepEqual(expected, selector) {
+			t.Errorf("expected %v, got %v", expected, selector)
+		}
+		if spec.Selector.MatchLabels != nil {
+			t.Errorf("expected the spec to be unchanged, got %v", spec.Selector)
+		}
+	})
+
+	t.Run("invalid operator", func(t *testing.T) {
+		spec := crv1.PgStorageSpec{
+			Selector: &metav1.LabelSelector{
+				MatchExpressions: []metav1.LabelSelectorRequirement{
+					{Key: "zone", Operator: "Near", Values: []string{"a"}},
+				},
+			},
+		}
+		if _, err := storageSelector(&spec); err == nil {
+			t.Error("expected an error")
+		}
+	})
+}
+
+func TestMergeMetadata(t *testing.T) {
+	spec := crv1.PgStorageSpec{
+		AccessMode:  "ReadWriteOnce",
+		Size:        "1G",
+		StorageType: "create",
+		Annotations: map[string]string{"backup.example.com/policy": "daily"},
+		Labels: map[string]string{
+			"cost-center":           "db",
+			config.LABEL_PG_CLUSTER: "other-cluster",
+			config.LABEL_PGREMOVE:   "false",
+		},
+	}
+
+	pvc, err := newPersistentVolumeClaim("some-pvc", "some-cluster", &spec)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	expectedLabels := map[string]string{
+		config.LABEL_VENDOR:     config.LABEL_CRUNCHY,
+		config.LABEL_PGREMOVE:   "true",
+		config.LABEL_PG_CLUSTER: "some-cluster",
+		"cost-center":           "db",
+	}
+	if !reflect.DeepEqual(expectedLabels, pvc.Labels) {
+		t.Errorf("expected labels %v, got %v", expectedLabels, pvc.Labels)
+	}
+	if !reflect.DeepEqual(spec.Annotations, pvc.Annotations) {
+		t.Errorf("expected annotations %v, got %v", spec.Annotations, pvc.Annotations)
+	}
+
+	// the spec should not be modified
+	if len(spec.Labels) != 3 {
+		t.Errorf("expected spec labels to be unchanged, got %v", spec.Labels)
+	}
+}
+
+func TestCreateOwner(t *testing.T) {
+	cluster := &crv1.Pgcluster{
+		ObjectMeta: metav1.ObjectMeta{Name: "some-cluster", UID: "some-uid"},
+	}
+
+	ownerOf := func(t *testing.T, spec crv1.PgStorageSpec) []metav1.OwnerReference {
+		clientset := fake.NewSimpleClientset()
+		result, err := CreateIfNotExists(context.Background(), clientset, spec, "some-pvc", "some-cluster", "ns", cluster)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		pvc, err := clientset.CoreV1().PersistentVolumeClaims("ns").Get(result.PersistentVolumeClaimName, metav1.GetOptions{})
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		return pvc.OwnerReferences
+	}
+
+	t.Run("owned", func(t *testing.T) {
+		refs := ownerOf(t, crv1.PgStorageSpec{
+			AccessMode: "ReadWriteOnce", Size: "1G", StorageType: "dynamic", OwnedByCluster: true,
+		})
+		if len(refs) != 1 {
+			t.Fatalf("expected one owner, got %v", refs)
+		}
+		if refs[0].Kind != "Pgcluster" || refs[0].Name != "some-cluster" || refs[0].UID != "some-uid" {
+			t.Errorf("expected the cluster to own the pvc, got %v", refs[0])
+		}
+		if refs[0].APIVersion != crv1.SchemeGroupVersion.String() {
+			t.Errorf("expected %q, got %q", crv1.SchemeGroupVersion.String(), refs[0].APIVersion)
+		}
+	})
+
+	t.Run("not opted in", func(t *testing.T) {
+		refs := ownerOf(t, crv1.PgStorageSpec{
+			AccessMode: "ReadWriteOnce", Size: "1G", StorageType: "dynamic",
+		})
+		if len(refs) != 0 {
+			t.Errorf("expected no owner, got %v", refs)
+		}
+	})
+
+	t.Run("existing", func(t *testing.T) {
+		clientset := fake.NewSimpleClientset()
+		spec := crv1.PgStorageSpec{Name: "mine", StorageType: "existing", OwnedByCluster: true}
+
+		if _, err := CreateIfNotExists(context.Background(), clientset, spec, "some-pvc", "some-cluster", "ns", cluster); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if actions := clientset.Actions(); len(actions) != 0 {
+			t.Errorf("expected existing volumes to be left alone, got %v", actions)
+		}
+	})
+}
+
+func TestCreateEvents(t *testing.T) {
+	cluster := &crv1.Pgcluster{
+		ObjectMeta: metav1.ObjectMeta{Name: "some-cluster", Namespace: "ns", UID: "some-uid"},
+	}
+	spec := crv1.PgStorageSpec{AccessMode: "ReadWriteOnce", Size: "1G", StorageType: "dynamic"}
+
+	t.Run("failure", func(t *testing.T) {
+		clientset := fake.NewSimpleClientset()
+		clientset.PrependReactor("create", "persistentvolumeclaims",
+			func(k8stesting.Action) (bool, runtime.Object, error) {
+				return true, nil, kerrors.NewForbidden(v1.Resource("persistentvolumeclaims"), "some-pvc",
+					errors.New("exceeded quota"))
+			})
+
+		recorder := record.NewFakeRecorder(10)
+		if _, err := Create(context.Background(), clientset, "some-pvc", "some-cluster", "ns",
+			CreateOptions{Spec: &spec, Owner: cluster, Recorder: recorder}); err == nil {
+			t.Fatal("expected an error")
+		}
+
+		select {
+		case event := <-recorder.Events:
+			if !strings.HasPrefix(event, "Warning PVCCreateFailed ") ||
+				!strings.Contains(event, "some-pvc") || !strings.Contains(event, "exceeded quota") {
+				t.Errorf("expected a warning about the quota, got %q", event)
+			}
+		default:
+			t.Error("expected an event")
+		}
+	})
+
+	t.Run("success", func(t *testing.T) {
+		recorder := record.NewFakeRecorder(10)
+		if _, err := Create(context.Background(), fake.NewSimpleClientset(), "some-pvc", "some-cluster", "ns",
+			CreateOptions{Spec: &spec, Owner: cluster, Recorder: recorder}); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		select {
+		case event := <-recorder.Events:
+			if expected := "Normal PVCCreated created pvc some-pvc"; event != expected {
+				t.Errorf("expected %q, got %q", expected, event)
+			}
+		default:
+			t.Error("expected an event")
+		}
+	})
+
+	t.Run("no owner", func(t *testing.T) {
+		recorder := record.NewFakeRecorder(10)
+		if _, err := Create(context.Background(), fake.NewSimpleClientset(), "some-pvc", "some-cluster", "ns",
+			CreateOptions{Spec: &spec, Recorder: recorder}); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if len(recorder.Events) != 0 {
+			t.Errorf("expected no events, got %q", <-recorder.Events)
+		}
+	})
+}
+
+func TestCreateIfNotExistsWithOptions(t *testing.T) {
+	cluster := &crv1.Pgcluster{
+		ObjectMeta: metav1.ObjectMeta{Name: "some-cluster", Namespace: "ns", UID: "some-uid"},
+	}
+	spec := crv1.PgStorageSpec{
+		AccessMode: "ReadWriteOnce", Size: "1G", StorageType: "dynamic", OwnedByCluster: true,
+	}
+
+	t.Run("all options", func(t *testing.T) {
+		attempts := 0
+		clientset := fake.NewSimpleClientset()
+		clientset.PrependReactor("create", "persistentvolumeclaims",
+			func(k8stesting.Action) (bool, runtime.Object, error) {
+				if attempts++; attempts == 1 {
+					return true, nil, kerrors.NewInternalError(errors.New("etcd is unavailable"))
+				}
+				return false, nil, nil
+			})
+
+		recorder := record.NewFakeRecorder(10)
+		result, err := CreateIfNotExistsWithOptions(context.Background(), clientset, "some-pvc", "some-cluster", "ns",
+			CreateOptions{
+				Spec:     &spec,
+				Owner:    cluster,
+				Backoff:  &wait.Backoff{Steps: 2, Duration: time.Millisecond},
+				Recorder: recorder,
+			})
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if attempts != 2 {
+			t.Errorf("expected 2 attempts, got %d", attempts)
+		}
+
+		pvc, err := clientset.CoreV1().PersistentVolumeClaims("ns").Get(result.PersistentVolumeClaimName, metav1.GetOptions{})
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if refs := pvc.OwnerReferences; len(refs) != 1 || refs[0].UID != "some-uid" {
+			t.Errorf("expected the cluster to own the pvc, got %v", refs)
+		}
+		if len(recorder.Events) != 1 {
+			t.Errorf("expected one event, got %d", len(recorder.Events))
+		}
+	})
+
+	t.Run("dry run", func(t *testing.T) {
+		clientset, server, _ := newDryRunClientset(t)
+		defer server.Close()
+		recorder := record.NewFakeRecorder(10)
+
+		if _, err := CreateIfNotExistsWithOptions(context.Background(), clientset, "some-pvc", "some-cluster", "ns",
+			CreateOptions{Spec: &spec, Owner: cluster, Recorder: recorder, DryRun: true}); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if len(recorder.Events) != 0 {
+			t.Errorf("expected no events, got %q", <-recorder.Events)
+		}
+	})
+
+	t.Run("no spec", func(t *testing.T) {
+		clientset := fake.NewSimpleClientset()
+
+		if _, err := CreateIfNotExistsWithOptions(context.Background(), clientset, "some-pvc", "some-cluster", "ns",
+			CreateOptions{Owner: cluster}); err != errSpecRequired {
+			t.Errorf("expected %v, got %v", errSpecRequired, err)
+		}
+		if _, err := Create(context.Background(), clientset, "some-pvc", "some-cluster", "ns",
+			CreateOptions{}); err != errSpecRequired {
+			t.Errorf("expected %v, got %v", errSpecRequired, err)
+		}
+		if actions := clientset.Actions(); len(actions) != 0 {
+			t.Errorf("expected nothing to be submitted, got %v", actions)
+		}
+	})
+}
+
+func TestStorageVolumeMode(t *testing.T) {
+	for _, mode := range []v1.PersistentVolumeMode{v1.PersistentVolumeFilesystem, v1.PersistentVolumeBlock} {
+		spec := crv1.PgStorageSpec{
+			AccessMode: "ReadWriteOnce", Size: "1G", StorageType: "dynamic", VolumeMode: string(mode),
+		}
+		pvc, err := newPersistentVolumeClaim("some-pvc", "some-cluster", &spec)
+		if err != nil {
+			t.Fatalf("expected no error for %q, got %v", mode, err)
+		}
+		if pvc.Spec.VolumeMode == nil || *pvc.Spec.VolumeMode != mode {
+			t.Errorf("expected %q, got %v", mode, pvc.Spec.VolumeMode)
+		}
+	}
+
+	{
+		spec := crv1.PgStorageSpec{AccessMode: "ReadWriteOnce", Size: "1G", StorageType: "dynamic"}
+		pvc, err := newPersistentVolumeClaim("some-pvc", "some-cluster", &spec)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if pvc.Spec.VolumeMode != nil {
+			t.Errorf("expected the default mode, got %v", *pvc.Spec.VolumeMode)
+		}
+	}
+
+	{
+		spec := crv1.PgStorageSpec{VolumeMode: "block"}
+		if _, err := storageVolumeMode(&spec); err == nil {
+			t.Error("expected an error")
+		}
+	}
+}
+
+func TestSupplementalGroupsFor(t *testing.T) {
+	for _, tt := range []struct {
+		groups   string
+		expected []int64
+	}{
+		{"", []int64{}},
+		{"65534", []int64{65534}},
+		{"7, 8,9", []int64{7, 8, 9}},
+		{"9,7,9,8,7", []int64{9, 7, 8}},
+	} {
+		actual := SupplementalGroupsFor(crv1.PgStorageSpec{SupplementalGroups: tt.groups})
+		if !reflect.DeepEqual(tt.expected, actual) {
+			t.Errorf("expected %v for %q, got %v", tt.expected, tt.groups, actual)
+		}
+	}
+
+	result, err := CreateIfNotExists(context.Background(), fake.NewSimpleClientset(),
+		crv1.PgStorageSpec{StorageType: "emptydir", SupplementalGroups: "99,99"}, "hippo", "hippo", "ns", nil)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if expected := []int64{99}; !reflect.DeepEqual(expected, result.SupplementalGroups) {
+		t.Errorf("expected %v, got %v", expected, result.SupplementalGroups)
+	}
+}
+
+func TestCreateIfNotExistsFSGroup(t *testing.T) {
+	for _, storageType := range []string{"", "emptydir", "existing", "create"} {
+		spec := crv1.PgStorageSpec{
+			AccessMode: "ReadWriteOnce", Name: "some-pvc", Size: "1G", StorageType: storageType,
+		}
+
+		result, err := CreateIfNotExists(context.Background(), fake.NewSimpleClientset(), spec, "some-pvc", "some-cluster", "ns", nil)
+		if err != nil {
+			t.Fatalf("expected no error for %q, got %v", storageType, err)
+		}
+		if result.FSGroup != nil {
+			t.Errorf("expected no fsGroup for %q, got %d", storageType, *result.FSGroup)
+		}
+
+		fsGroup := int64(2000)
+		spec.FSGroup = &fsGroup
+
+		result, err = CreateIfNotExists(context.Background(), fake.NewSimpleClientset(), spec, "some-pvc", "some-cluster", "ns", nil)
+		if err != nil {
+			t.Fatalf("expected no error for %q, got %v", storageType, err)
+		}
+		if result.FSGroup == nil || *result.FSGroup != 2000 {
+			t.Errorf("expected fsGroup 2000 for %q, got %v", storageType, result.FSGroup)
+		}
+		if result.FSGroup == spec.FSGroup {
+			t.Errorf("expected a copy of the fsGroup for %q", storageType)
+		}
+	}
+}
+
+func TestStorageSize(t *testing.T) {
+	for _, size := range []string{"1", "1G", "512Mi", "2Ti", "10Gi", "500Mi", "1T"} {
+		actual, err := storageSize("some-pvc", &crv1.PgStorageSpec{Size: size})
+		if err != nil {
+			t.Errorf("expected no error for %q, got %v", size, err)
+		}
+		if expected := resource.MustParse(size); actual.Cmp(expected) != 0 {
+			t.Errorf("expected %v, got %v", expected.String(), actual.String())
+		}
+	}
+
+	for _, size := range []string{"", "0", "0Gi", "-1G", "abc", "10 GB", "1TB", "10gi"} {
+		_, err := storageSize("some-pvc", &crv1.PgStorageSpec{Size: size})
+		if err == nil {
+			t.Errorf("expected an error for %q", size)
+			continue
+		}
+		if expected := fmt.Sprintf("storage size %q is invalid for pvc some-pvc", size); !strings.HasPrefix(err.Error(), expected) {
+			t.Errorf("expected %q, got %q", expected, err.Error())
+		}
+	}
+
+	t.Run("create", func(t *testing.T) {
+		clientset := fake.NewSimpleClientset()
+		spec := crv1.PgStorageSpec{AccessMode: "ReadWriteOnce", Size: "0", StorageType: "create"}
+
+		if _, err := Create(context.Background(), clientset, "some-pvc", "some-cluster", "ns", CreateOptions{Spec: &spec}); err == nil {
+			t.Fatal("expected an error")
+		}
+		if actions := clientset.Actions(); len(actions) != 0 {
+			t.Errorf("expected no requests, got %v", actions)
+		}
+	})
+
+	t.Run("result", func(t *testing.T) {
+		existing := newTestPVC("existing-pvc", "ns", "1Gi", "standard")
+		clientset := fake.NewSimpleClientset(existing)
+
+		for name, size := range map[string]string{"some-pvc": "10Gi", "existing-pvc": "1Gi"} {
+			spec := crv1.PgStorageSpec{AccessMode: "ReadWriteOnce", Size: size, StorageType: "create"}
+			result, err := CreateIfNotExists(context.Background(), clientset, spec, name, "some-cluster", "ns", nil)
+			if err != nil {
+				t.Fatalf("expected no error for %s, got %v", name, err)
+			}
+			if expected := resource.MustParse(size); result.Size == nil || result.Size.Cmp(expected) != 0 {
+				t.Errorf("expected size %v for %s, got %v", expected.String(), name, result.Size)
+			}
+		}
+
+		result, err := CreateIfNotExists(context.Background(), clientset,
+			crv1.PgStorageSpec{StorageType: "emptydir", Size: "1Gi"}, "hippo", "some-cluster", "ns", nil)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if result.Size != nil {
+			t.Errorf("expected no size for an emptydir, got %v", result.Size)
+		}
+	})
+
+	t.Run("invalid before existing", func(t *testing.T) {
+		clientset := fake.NewSimpleClientset(newTestPVC("some-pvc", "ns", "1Gi", "standard"))
+		spec := crv1.PgStorageSpec{AccessMode: "ReadWriteOnce", Size: "10 GB", StorageType: "create"}
+
+		_, err := CreateIfNotExists(context.Background(), clientset, spec, "some-pvc", "some-cluster", "ns", nil)
+		if err == nil || !strings.Contains(err.Error(), `"10 GB"`) {
+			t.Errorf("expected an error naming the size, got %v", err)
+		}
+		if actions := clientset.Actions(); len(actions) != 0 {
+			t.Errorf("expected no requests, got %v", actions)
+		}
+	})
+}
+
+func TestStorageAccessMode(t *testing.T) {
+	for _, tt := range []struct {
+		value    string
+		expected v1.PersistentVolumeAccessMode
+	}{
+		{"ReadWriteOnce", v1.ReadWriteOnce},
+		{"ReadOnlyMany", v1.ReadOnlyMany},
+		{"ReadWriteMany", v1.ReadWriteMany},
+		{"", v1.ReadWriteOnce},
+	} {
+		spec := crv1.PgStorageSpec{AccessMode: tt.value, Size: "1G", StorageType: "create"}
+		pvc, err := newPersistentVolumeClaim("some-pvc", "some-cluster", &spec)
+		if err != nil {
+			t.Fatalf("expected no error for %q, got %v", tt.value, err)
+		}
+		expected := []v1.PersistentVolumeAccessMode{tt.expected}
+		if !reflect.DeepEqual(expected, pvc.Spec.AccessModes) {
+			t.Errorf("expected %v for %q, got %v", expected, tt.value, pvc.Spec.AccessModes)
+		}
+	}
+
+	for _, value := range []string{"ReadWrite", "readwriteonce", "RWO"} {
+		spec := crv1.PgStorageSpec{AccessMode: value, Size: "1G", StorageType: "create"}
+		_, err := newPersistentVolumeClaim("some-pvc", "some-cluster", &spec)
+		if err == nil || !strings.Contains(err.Error(), `"`+value+`"`) {
+			t.Errorf("expected the error to name %q, got %v", value, err)
+		}
+	}
+
+	t.Run("multiple", func(t *testing.T) {
+		for value, expected := range map[string][]v1.PersistentVolumeAccessMode{
+			"ReadWriteOnce,ReadOnlyMany":   {v1.ReadWriteOnce, v1.ReadOnlyMany},
+			"ReadWriteMany, ReadOnlyMany ": {v1.ReadWriteMany, v1.ReadOnlyMany},
+		} {
+			spec := crv1.PgStorageSpec{AccessMode: value, Size: "1G", StorageType: "create"}
+			pvc, err := newPersistentVolumeClaim("some-pvc", "some-cluster", &spec)
+			if err != nil {
+				t.Fatalf("expected no error for %q, got %v", value, err)
+			}
+			if !reflect.DeepEqual(expected, pvc.Spec.AccessModes) {
+				t.Errorf("expected %v for %q, got %v", expected, value, pvc.Spec.AccessModes)
+			}
+		}
+	})
+
+	t.Run("invalid entries", func(t *testing.T) {
+		for value, invalid := range map[string]string{
+			"ReadWriteOnce,RWX":           `"RWX"`,
+			"ReadWriteOnce,":              `""`,
+			"ReadOnlyMany,ReadOnlyMany":   "more than once",
+			"ReadWriteOnce;ReadWriteMany": `"ReadWriteOnce;ReadWriteMany"`,
+		} {
+			spec := crv1.PgStorageSpec{AccessMode: value, Size: "1G", StorageType: "create"}
+			_, err := newPersistentVolumeClaim("some-pvc", "some-cluster", &spec)
+			if err == nil || !strings.Contains(err.Error(), invalid) {
+				t.Errorf("expected an error containing %s for %q, got %v", invalid, value, err)
+			}
+		}
+	})
+
+	t.Run("tablespaces", func(t *testing.T) {
+		modes := []v1.PersistentVolumeAccessMode{v1.ReadWriteOnce, v1.ReadOnlyMany}
+		tablespaceStorage := map[string]TablespaceStorage{"both": {StorageType: "create", AccessModes: modes}}
+
+		if err := RequireTablespaceAccessMode(tablespaceStorage, v1.ReadOnlyMany); err != nil {
+			t.Errorf("expected no error, got %v", err)
+		}
+		if err := RequireTablespaceAccessMode(tablespaceStorage, v1.ReadWriteMany); err == nil ||
+			!strings.Contains(err.Error(), "both is ReadWriteOnce,ReadOnlyMany") {
+			t.Errorf("expected both to be rejected, got %v", err)
+		}
+	})
+}
+
+func TestCreateDataSource(t *testing.T) {
+	t.Run("snapshot", func(t *testing.T) {
+		for _, storageType := range []string{"create", "dynamic"} {
+			spec := crv1.PgStorageSpec{
+				AccessMode: "ReadWriteOnce", Size: "1G", StorageType: storageType,
+				DataSource: "nightly",
+			}
+			pvc, err := newPersistentVolumeClaim("some-pvc", "some-cluster", &spec)
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+
+			group := "snapshot.storage.k8s.io"
+			expected := &v1.TypedLocalObjectReference{APIGroup: &group, Kind: "VolumeSnapshot", Name: "nightly"}
+			if !reflect.DeepEqual(expected, pvc.Spec.DataSource) {
+				t.Errorf("expected %v for %q, got %v", expected, storageType, pvc.Spec.DataSource)
+			}
+		}
+	})
+
+	t.Run("omitted", func(t *testing.T) {
+		spec := crv1.PgStorageSpec{AccessMode: "ReadWriteOnce", Size: "1G", StorageType: "create"}
+		pvc, err := newPersistentVolumeClaim("some-pvc", "some-cluster", &spec)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if pvc.Spec.DataSource != nil {
+			t.Errorf("expected no data source, got %v", pvc.Spec.DataSource)
+		}
+	})
+
+	t.Run("existing", func(t *testing.T) {
+		clientset := fake.NewSimpleClientset()
+		spec := crv1.PgStorageSpec{Name: "mine", StorageType: "existing", DataSource: "nightly"}
+		if _, err := CreateIfNotExists(context.Background(), clientset, spec, "some-pvc", "some-cluster", "ns", nil); err == nil {
+			t.Error("expected an error")
+		}
+	})
+}
+
+func TestNormalizeSize(t *testing.T) {
+	for _, tt := range []struct{ size, expected string }{
+		{"1024Mi", "1Gi"},
+		{"1Gi", "1Gi"},
+		{"1048576Ki", "1Gi"},
+		{"1073741824", "1Gi"},
+		{"1536Mi", "1536Mi"},
+		{"2048Gi", "2Ti"},
+		{"1G", "1000000000"},
+	} {
+		actual, err := NormalizeSize(tt.size)
+		if err != nil {
+			t.Errorf("expected no error for %q, got %v", tt.size, err)
+		}
+		if actual != tt.expected {
+			t.Errorf("expected %q for %q, got %q", tt.expected, tt.size, actual)
+		}
+	}
+
+	for _, size := range []string{"", "0", "0Gi", "-1Gi", "abc", "10 GB", "10gi"} {
+		if actual, err := NormalizeSize(size); err == nil {
+			t.Errorf("expected an error for %q, got %q", size, actual)
+		}
+	}
+}
+
+func TestStorageSizeLimit(t *testing.T) {
+	t.Run("request only", func(t *testing.T) {
+		spec := crv1.PgStorageSpec{AccessMode: "ReadWriteOnce", Size: "1Gi", StorageType: "dynamic"}
+		pvc, err := newPersistentVolumeClaim("some-pvc", "some-cluster", &spec)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if pvc.Spec.Resources.Limits != nil {
+			t.Errorf("expected no limits, got %v", pvc.Spec.Resources.Limits)
+		}
+	})
+
+	t.Run("request and limit", func(t *testing.T) {
+		spec := crv1.PgStorageSpec{AccessMode: "ReadWriteOnce", Size: "1Gi", SizeLimit: "5Gi", StorageType: "dynamic"}
+		pvc, err := newPersistentVolumeClaim("some-pvc", "some-cluster", &spec)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		expected := v1.ResourceRequirements{
+			Requests: v1.ResourceList{v1.ResourceStorage: resource.MustParse("1Gi")},
+			Limits:   v1.ResourceList{v1.ResourceStorage: resource.MustParse("5Gi")},
+		}
+		if !reflect.DeepEqual(expected, pvc.Spec.Resources) {
+			t.Errorf("expected %v, got %v", expected, pvc.Spec.Resources)
+		}
+	})
+
+	t.Run("limit less than request", func(t *testing.T) {
+		spec := crv1.PgStorageSpec{AccessMode: "ReadWriteOnce", Size: "1Gi", SizeLimit: "512Mi", StorageType: "dynamic"}
+		if _, err := newPersistentVolumeClaim("some-pvc", "some-cluster", &spec); err == nil {
+			t.Error("expected an error")
+		}
+	})
+}
+
+func TestCreatePVC(t *testing.T) {
+	t.Run("existing", func(t *testing.T) {
+		clientset := fake.NewSimpleClientset(newTestPVC("mine", "ns", "1Gi", "standard"))
+		spec := crv1.PgStorageSpec{Name: "mine", StorageType: "existing", SupplementalGroups: "65534"}
+
+		result, err := CreatePVC(context.Background(), clientset, &spec, "some-pvc", "some-cluster", "ns")
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if result.PersistentVolumeClaimName != "mine" {
+			t.Errorf("expected the name of the spec, got %q", result.PersistentVolumeClaimName)
+		}
+		if !reflect.DeepEqual(result.SupplementalGroups, []int64{65534}) {
+			t.Errorf("expected the supplemental groups of the spec, got %v", result.SupplementalGroups)
+		}
+	})
+
+	t.Run("dynamic", func(t *testing.T) {
+		clientset := fake.NewSimpleClientset(newTestStorageClass("standard", false))
+		spec := crv1.PgStorageSpec{AccessMode: "ReadWriteOnce", Size: "1Gi", StorageType: "dynamic", StorageClass: "standard"}
+
+		result, err := CreatePVC(context.Background(), clientset, &spec, "some-pvc", "some-cluster", "ns")
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if result.PersistentVolumeClaimName != "some-pvc" || result.Claim == nil {
+			t.Errorf("expected some-pvc to be created, got %v", result)
+		}
+		if result.Size == nil || result.Size.String() != "1Gi" {
+			t.Errorf("expected the size of the spec, got %v", result.Size)
+		}
+
+		// like CreateIfNotExists, a PVC that already exists is not an error
+		result, err = CreatePVC(context.Background(), clientset, &spec, "some-pvc", "some-cluster", "ns")
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if result.PersistentVolumeClaimName != "some-pvc" || result.Claim != nil {
+			t.Errorf("expected the existing some-pvc, got %v", result)
+		}
+	})
+
+	t.Run("emptydir", func(t *testing.T) {
+		clientset := fake.NewSimpleClientset()
+		spec := crv1.PgStorageSpec{StorageType: "emptydir"}
+
+		result, err := CreatePVC(context.Background(), clientset, &spec, "some-pvc", "some-cluster", "ns")
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if result.PersistentVolumeClaimName != "" {
+			t.Errorf("expected no pvc, got %q", result.PersistentVolumeClaimName)
+		}
+		if actions := clientset.Actions(); len(actions) != 0 {
+			t.Errorf("expected no API calls, got %v", actions)
+		}
+	})
+}
+
+func TestCreateIfNotExistsCreated(t *testing.T) {
+	clientset := fake.NewSimpleClientset(newTestStorageClass("standard", false), newTestPVC("mine", "ns", "1Gi", "standard"))
+	spec := crv1.PgStorageSpec{AccessMode: "ReadWriteOnce", Size: "1Gi", StorageType: "dynamic", StorageClass: "standard"}
+
+	t.Run("create", func(t *testing.T) {
+		result, err := CreateIfNotExists(context.Background(), clientset, spec, "hippo", "hippo", "ns", nil)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if !result.Created {
+			t.Error("expected the pvc to be created")
+		}
+	})
+
+	t.Run("already exists", func(t *testing.T) {
+		result, err := CreateIfNotExists(context.Background(), clientset, spec, "hippo", "hippo", "ns", nil)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if result.Created || result.PersistentVolumeClaimName != "hippo" {
+			t.Errorf("expected the existing pvc, got %+v", result)
+		}
+	})
+
+	t.Run("dry run", func(t *testing.T) {
+		clientset, server, _ := newDryRunClientset(t)
+		defer server.Close()
+
+		spec := spec
+		spec.StorageClass = ""
+		result, err := CreateIfNotExistsWithOptions(context.Background(), clientset, "hippo-dry", "hippo", "ns",
+			CreateOptions{Spec: &spec, DryRun: true})
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if result.Created || result.Claim == nil {
+			t.Errorf("expected a claim that was not created, got %+v", result)
+		}
+	})
+
+	for _, spec := range []crv1.PgStorageSpec{
+		{StorageType: "emptydir"},
+		{StorageType: "existing", Name: "mine"},
+		{},
+	} {
+		result, err := CreateIfNotExists(context.Background(), clientset, spec, "hippo-other", "hippo", "ns", nil)
+		if err != nil {
+			t.Fatalf("expected no error for %q, got %v", spec.StorageType, err)
+		}
+		if result.Created {
+			t.Errorf("expected nothing to be created for %q", spec.StorageType)
+		}
+	}
+}
+
+func TestCreateIfNotExistsEmptyDir(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+
+	result, err := CreateIfNotExists(context.Background(), clientset,
+		crv1.PgStorageSpec{StorageType: "emptydir"}, "some-pvc", "some-cluster", "ns", nil)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if result.SizeLimit != nil {
+		t.Errorf("expected no limit, got %v", result.SizeLimit)
+	}
+
+	result, err = CreateIfNotExists(context.Background(), clientset,
+		crv1.PgStorageSpec{StorageType: "emptydir", Size: "2Gi"}, "some-pvc", "some-cluster", "ns", nil)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if result.SizeLimit == nil || result.SizeLimit.String() != "2Gi" {
+		t.Errorf("expected 2Gi, got %v", result.SizeLimit)
+	}
+	if result.PersistentVolumeClaimName != "" {
+		t.Errorf("expected no pvc, got %q", result.PersistentVolumeClaimName)
+	}
+	if source := result.VolumeSource(); source.EmptyDir == nil || source.EmptyDir.SizeLimit == nil {
+		t.Errorf("expected an emptyDir with a size limit, got %v", source)
+	}
+	if actions := clientset.Actions(); len(actions) != 0 {
+		t.Errorf("expected no API calls, got %v", actions)
+	}
+}
+
+func TestCreateIfNotExistsReadOnly(t *testing.T) {
+	clientset := fake.NewSimpleClientset(newTestPVC("restored", "ns", "1Gi", "standard"))
+
+	spec := crv1.PgStorageSpec{Name: "restored", StorageType: "existing", ReadOnly: true}
+	result, err := CreateIfNotExists(context.Background(), clientset, spec, "hippo", "hippo", "ns", nil)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if !result.ReadOnly {
+		t.Error("expected the existing pvc to be read-only")
+	}
+	if source := result.VolumeSource(); source.PersistentVolumeClaim == nil || !source.PersistentVolumeClaim.ReadOnly {
+		t.Errorf("expected a read-only persistentVolumeClaim, got %v", source)
+	}
+
+	for _, storageType := range []string{"create", "dynamic"} {
+		spec := crv1.PgStorageSpec{AccessMode: "ReadWriteOnce", Size: "1Gi", StorageType: storageType, ReadOnly: true}
+		result, err := CreateIfNotExists(context.Background(), clientset, spec, "hippo-"+storageType, "hippo", "ns", nil)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if result.ReadOnly {
+			t.Errorf("expected ReadOnly to be ignored for %q", storageType)
+		}
+	}
+}
+
+func TestCreateIfNotExistsExistingByLabel(t *testing.T) {
+	labeled := func(name string, labels map[string]string) *v1.PersistentVolumeClaim {
+		pvc := newTestPVC(name, "ns", "1Gi", "")
+		pvc.Labels = labels
+		return pvc
+	}
+	spec := crv1.PgStorageSpec{StorageType: "existing", MatchLabels: "tier=gold"}
+
+	t.Run("exactly one", func(t *testing.T) {
+		lost := labeled("gold-lost", map[string]string{"tier": "gold"})
+		lost.Status.Phase = v1.ClaimLost
+
+		clientset := fake.NewSimpleClientset(
+			labeled("gold-1", map[string]string{"tier": "gold", "zone": "a"}),
+			labeled("silver-1", map[string]string{"tier": "silver"}),
+			lost)
+
+		result, err := CreateIfNotExists(context.Background(), clientset, spec, "hippo", "hippo", "ns", nil)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if result.PersistentVolumeClaimName != "gold-1" {
+			t.Errorf("expected gold-1, got %q", result.PersistentVolumeClaimName)
+		}
+		for _, action := range clientset.Actions() {
+			if action.GetVerb() == "create" {
+				t.Errorf("expected nothing to be created, got %v", action)
+			}
+		}
+	})
+
+	t.Run("selector", func(t *testing.T) {
+		clientset := fake.NewSimpleClientset(
+			labeled("gold-a", map[string]string{"tier": "gold", "zone": "a"}),
+			labeled("gold-b", map[string]string{"tier": "gold", "zone": "b"}))
+
+		spec := spec
+		spec.Selector = &metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{
+			{Key: "zone", Operator: metav1.LabelSelectorOpIn, Values: []string{"b"}},
+		}}
+
+		result, err := CreateIfNotExists(context.Background(), clientset, spec, "hippo", "hippo", "ns", nil)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if result.PersistentVolumeClaimName != "gold-b" {
+			t.Errorf("expected gold-b, got %q", result.PersistentVolumeClaimName)
+		}
+	})
+
+	t.Run("none", func(t *testing.T) {
+		clientset := fake.NewSimpleClientset(labeled("silver-1", map[string]string{"tier": "silver"}))
+
+		_, err := CreateIfNotExists(context.Background(), clientset, spec, "hippo", "hippo", "ns", nil)
+		if err == nil || !strings.Contains(err.Error(), "no existing pvc matches") {
+			t.Errorf("expected no match, got %v", err)
+		}
+	})
+
+	t.Run("multiple", func(t *testing.T) {
+		clientset := fake.NewSimpleClientset(
+			labeled("gold-2", map[string]string{"tier": "gold"}),
+			labeled("gold-1", map[string]string{"tier": "gold"}))
+
+		_, err := CreateIfNotExists(context.Background(), clientset, spec, "hippo", "hippo", "ns", nil)
+		if err == nil || !strings.Contains(err.Error(), "gold-1, gold-2 all match") {
+			t.Errorf("expected both matches to be named, got %v", err)
+		}
+	})
+
+	t.Run("neither name nor labels", func(t *testing.T) {
+		_, err := CreateIfNotExists(context.Background(), fake.NewSimpleClientset(),
+			crv1.PgStorageSpec{StorageType: "existing"}, "hippo", "hippo", "ns", nil)
+		if err == nil {
+			t.Error("expected an error")
+		}
+	})
+}
+
+func TestGet(t *testing.T) {
+	present := newTestPVC("present", "ns", "1Gi", "standard")
+	present.Annotations = map[string]string{"some": "annotation"}
+
+	t.Run("present", func(t *testing.T) {
+		pvc, err := Get(context.Background(), fake.NewSimpleClientset(present), "present", "ns")
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if pvc == nil || pvc.Name != "present" || pvc.Annotations["some"] != "annotation" {
+			t.Errorf("expected the whole pvc, got %v", pvc)
+		}
+	})
+
+	t.Run("absent", func(t *testing.T) {
+		pvc, err := Get(context.Background(), fake.NewSimpleClientset(present), "absent", "ns")
+		if !kerrors.IsNotFound(err) {
+			t.Errorf("expected NotFound, got %v", err)
+		}
+		if pvc != nil {
+			t.Errorf("expected no pvc, got %v", pvc)
+		}
+	})
+
+	t.Run("error", func(t *testing.T) {
+		clientset := fake.NewSimpleClientset(present)
+		clientset.PrependReactor("get", "persistentvolumeclaims", func(k8stesting.Action) (bool, runtime.Object, error) {
+			return true, nil, kerrors.NewForbidden(v1.Resource("persistentvolumeclaims"), "present", errors.New("rbac"))
+		})
+
+		_, err := Get(context.Background(), clientset, "present", "ns")
+		if !kerrors.IsForbidden(err) {
+			t.Errorf("expected the error of the API server, got %v", err)
+		}
+		if Exists(context.Background(), clientset, "present", "ns") {
+			t.Error("expected an error to be treated as the pvc not existing")
+		}
+	})
+
+	t.Run("canceled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		if _, err := Get(ctx, fake.NewSimpleClientset(present), "present", "ns"); err != context.Canceled {
+			t.Errorf("expected the context to be canceled, got %v", err)
+		}
+	})
+}
+
+func TestStatus(t *testing.T) {
+	bound := newTestPVC("bound", "ns", "1Gi", "standard")
+	bound.Status = v1.PersistentVolumeClaimStatus{
+		Phase:    v1.ClaimBound,
+		Capacity: v1.ResourceList{v1.ResourceStorage: resource.MustParse("2Gi")},
+	}
+	pending := newTestPVC("pending", "ns", "1Gi", "standard")
+	pending.Status.Phase = v1.ClaimPending
+
+	clientset := fake.NewSimpleClientset(bound, pending)
+
+	t.Run("bound", func(t *testing.T) {
+		status, err := Status(context.Background(), clientset, "bound", "ns")
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if !status.Exists || status.Phase != v1.ClaimBound {
+			t.Errorf("expected a bound pvc, got %+v", status)
+		}
+		if expected := resource.MustParse("2Gi"); status.Capacity.Cmp(expected) != 0 {
+			t.Errorf("expected capacity %v, got %v", expected.String(), status.Capacity.String())
+		}
+		if !Exists(context.Background(), clientset, "bound", "ns") {
+			t.Error("expected the pvc to exist")
+		}
+	})
+
+	t.Run("pending", func(t *testing.T) {
+		status, err := Status(context.Background(), clientset, "pending", "ns")
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if !status.Exists || status.Phase != v1.ClaimPending || !status.Capacity.IsZero() {
+			t.Errorf("expected a pending pvc without capacity, got %+v", status)
+		}
+	})
+
+	t.Run("missing", func(t *testing.T) {
+		status, err := Status(context.Background(), clientset, "missing", "ns")
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if status.Exists || status.Phase != "" {
+			t.Errorf("expected no pvc, got %+v", status)
+		}
+		if Exists(context.Background(), clientset, "missing", "ns") {
+			t.Error("expected the pvc not to exist")
+		}
+	})
+
+	t.Run("error", func(t *testing.T) {
+		clientset := fake.NewSimpleClientset(bound)
+		clientset.PrependReactor("get", "persistentvolumeclaims",
+			func(k8stesting.Action) (bool, runtime.Object, error) {
+				return true, nil, kerrors.NewInternalError(errors.New("etcd is down"))
+			})
+
+		if _, err := Status(context.Background(), clientset, "bound", "ns"); !kerrors.IsInternalError(err) {
+			t.Errorf("expected the error to be returned, got %v", err)
+		}
+		if Exists(context.Background(), clientset, "bound", "ns") {
+			t.Error("expected an error to be reported as not existing")
+		}
+	})
+}
+
+func TestList(t *testing.T) {
+	labeled := func(name, namespace, cluster string) *v1.PersistentVolumeClaim {
+		pvc := &v1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace}}
+		if cluster != "" {
+			pvc.Labels = map[string]string{config.LABEL_PG_CLUSTER: cluster}
+		}
+		return pvc
+	}
+
+	clientset := fake.NewSimpleClientset(
+		labeled("hippo", "ns", "hippo"),
+		labeled("hippo-wal", "ns", "hippo"),
+		labeled("hippo-tablespace-lake", "ns", "hippo"),
+		labeled("rhino", "ns", "rhino"),
+		labeled("hippo-elsewhere", "other", "hippo"),
+		labeled("unlabeled", "ns", ""),
+	)
+
+	pvcs, err := List(context.Background(), clientset, "hippo", "ns")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	names := map[string]bool{}
+	for _, pvc := range pvcs {
+		names[pvc.Name] = true
+	}
+
+	expected := map[string]bool{"hippo": true, "hippo-wal": true, "hippo-tablespace-lake": true}
+	if !reflect.DeepEqual(names, expected) {
+		t.Errorf("expected %v, got %v", expected, names)
+	}
+}
+
+func TestTotalRequestedStorage(t *testing.T) {
+	claim := func(name, cluster, requested, capacity string) *v1.PersistentVolumeClaim {
+		pvc := &v1.PersistentVolumeClaim{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: name, Namespace: "ns",
+				Labels: map[string]string{config.LABEL_PG_CLUSTER: cluster},
+			},
+			Spec: v1.PersistentVolumeClaimSpec{
+				Resources: v1.ResourceRequirements{
+					Requests: v1.ResourceList{v1.ResourceStorage: resource.MustParse(requested)},
+				},
+			},
+		}
+		if capacity != "" {
+			pvc.Status.Phase = v1.ClaimBound
+			pvc.Status.Capacity = v1.ResourceList{v1.ResourceStorage: resource.MustParse(capacity)}
+		}
+		return pvc
+	}
+
+	t.Run("mixed units", func(t *testing.T) {
+		clientset := fake.NewSimpleClientset(
+			claim("hippo", "hippo", "1Gi", "1Gi"),
+			claim("hippo-wal", "hippo", "512Mi", ""),
+			claim("hippo-tablespace-lake", "hippo", "256Mi", "512Mi"),
+			claim("rhino", "rhino", "10Gi", "10Gi"),
+		)
+
+		total, err := TotalRequestedStorage(context.Background(), clientset, "hippo", "ns")
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if expected := resource.MustParse("2Gi"); total.Cmp(expected) != 0 {
+			t.Errorf("expected %v, got %v", expected.String(), total.String())
+		}
+	})
+
+	t.Run("no claims", func(t *testing.T) {
+		total, err := TotalRequestedStorage(context.Background(), fake.NewSimpleClientset(), "hippo", "ns")
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if !total.IsZero() {
+			t.Errorf("expected zero, got %v", total.String())
+		}
+	})
+}
+
+// dryRunClientset is a fake clientset whose core REST client talks to an HTTP
+// server. The fake clientset has no REST client of its own.
+type dryRunClientset struct {
+	*fake.Clientset
+	rest rest.Interface
+}
+
+func (c dryRunClientset) CoreV1() corev1.CoreV1Interface {
+	return dryRunCoreV1{CoreV1Interface: c.Clientset.CoreV1(), rest: c.rest}
+}
+
+type dryRunCoreV1 struct {
+	corev1.CoreV1Interface
+	rest rest.Interface
+}
+
+func (c dryRunCoreV1) RESTClient() rest.Interface { return c.rest }
+
+// newDryRunClientset returns a dryRunClientset and the dryRun parameters of
+// every PVC submitted to its REST client. The server echoes each PVC back and
+// must be closed by the caller.
+func newDryRunClientset(t *testing.T) (dryRunClientset, *httptest.Server, *[][]string) {
+	var dryRuns [][]string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		dryRuns = append(dryRuns, r.URL.Query()["dryRun"])
+
+		var pvc v1.PersistentVolumeClaim
+		if err := json.NewDecoder(r.Body).Decode(&pvc); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(pvc)
+	}))
+
+	client, err := kubernetes.NewForConfig(&rest.Config{Host: server.URL})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	return dryRunClientset{Clientset: fake.NewSimpleClientset(), rest: client.CoreV1().RESTClient()}, server, &dryRuns
+}
+
+func TestCreateDryRun(t *testing.T) {
+	clientset, server, dryRuns := newDryRunClientset(t)
+	defer server.Close()
+
+	spec := crv1.PgStorageSpec{
+		AccessMode:  "ReadWriteOnce",
+		Size:        "1G",
+		StorageType: "dynamic",
+	}
+
+	created, err := Create(context.Background(), clientset, "some-pvc", "some-cluster", "ns",
+		CreateOptions{Spec: &spec, DryRun: true})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if created.Name != "some-pvc" {
+		t.Errorf("expected name %q, got %q", "some-pvc", created.Name)
+	}
+
+	expected := [][]string{{metav1.DryRunAll}}
+	if !reflect.DeepEqual(expected, *dryRuns) {
+		t.Errorf("expected %v, got %v", expected, *dryRuns)
+	}
+
+	if _, err := clientset.CoreV1().PersistentVolumeClaims("ns").Get("some-pvc", metav1.GetOptions{}); !kerrors.IsNotFound(err) {
+		t.Errorf("expected the pvc not to be persisted, got %v", err)
+	}
+}
+
+func TestDryRunMissingPostgreSQLVolumes(t *testing.T) {
+	clientset, server, dryRuns := newDryRunClientset(t)
+	defer server.Close()
+
+	storage := crv1.PgStorageSpec{AccessMode: "ReadWriteOnce", Size: "1G", StorageType: "dynamic"}
+	cluster := &crv1.Pgcluster{
+		Spec: crv1.PgclusterSpec{
+			Name:             "hippo",
+			WALStorage:       storage,
+			TablespaceMounts: map[string]crv1.PgStorageSpec{"lake": storage},
+		},
+	}
+
+	data, wal, tablespaces, _, err := DryRunMissingPostgreSQLVolumes(context.Background(), clientset,
+		cluster, "ns", "hippo", storage)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if data.Claim == nil || wal.Claim == nil || tablespaces["lake"].Claim == nil {
+		t.Fatalf("expected would-be claims, got %v, %v, %v", data.Claim, wal.Claim, tablespaces)
+	}
+	if wal.PersistentVolumeClaimName != "hippo-wal" {
+		t.Errorf("expected %q, got %q", "hippo-wal", wal.PersistentVolumeClaimName)
+	}
+	if len(*dryRuns) != 3 {
+		t.Errorf("expected three dry-run requests, got %v", *dryRuns)
+	}
+
+	list, err := clientset.CoreV1().PersistentVolumeClaims("ns").List(metav1.ListOptions{})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(list.Items) != 0 {
+		t.Errorf("expected nothing to be persisted, got %v", list.Items)
+	}
+}
+
+func TestDeleteIfExistsAndWait(t *testing.T) {
+	gvr := v1.SchemeGroupVersion.WithResource("persistentvolumeclaims")
+	claim := func(removable string) *v1.PersistentVolumeClaim {
+		return &v1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{
+			Name: "some-pvc", Namespace: "ns",
+			Labels: map[string]string{config.LABEL_PGREMOVE: removable},
+		}}
+	}
+
+	// terminating leaves deleted PVCs in the tracker, as though they were held
+	// by a finalizer, and removes them from the tracker after delay
+	terminating := func(clientset *fake.Clientset, delay time.Duration) {
+		clientset.PrependReactor("delete", "persistentvolumeclaims",
+			func(action k8stesting.Action) (bool, runtime.Object, error) {
+				if delay > 0 {
+					name := action.(k8stesting.DeleteAction).GetName()
+					time.AfterFunc(delay, func() {
+						_ = clientset.Tracker().Delete(gvr, action.GetNamespace(), name)
+					})
+				}
+				return true, nil, nil
+			})
+	}
+
+	t.Run("delayed", func(t *testing.T) {
+		clientset := fake.NewSimpleClientset(claim("true"))
+		terminating(clientset, time.Second)
+
+		if err := DeleteIfExistsAndWait(context.Background(), clientset, "some-pvc", "ns", DeleteOptions{}, 10*time.Second); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if _, err := clientset.CoreV1().PersistentVolumeClaims("ns").Get("some-pvc", metav1.GetOptions{}); !kerrors.IsNotFound(err) {
+			t.Errorf("expected the pvc to be gone, got %v", err)
+		}
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		clientset := fake.NewSimpleClientset(claim("true"))
+		terminating(clientset, 0)
+
+		err := DeleteIfExistsAndWait(context.Background(), clientset, "some-pvc", "ns", DeleteOptions{}, time.Second)
+		if err == nil || !strings.Contains(err.Error(), "timed out") {
+			t.Errorf("expected a timeout, got %v", err)
+		}
+	})
+
+	t.Run("not removable", func(t *testing.T) {
+		clientset := fake.NewSimpleClientset(claim("false"))
+
+		if err := DeleteIfExistsAndWait(context.Background(), clientset, "some-pvc", "ns", DeleteOptions{}, time.Second); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if _, err := clientset.CoreV1().PersistentVolumeClaims("ns").Get("some-pvc", metav1.GetOptions{}); err != nil {
+			t.Errorf("expected the pvc to be kept, got %v", err)
+		}
+	})
+
+	t.Run("missing", func(t *testing.T) {
+		clientset := fake.NewSimpleClientset()
+		if err := DeleteIfExistsAndWait(context.Background(), clientset, "some-pvc", "ns", DeleteOptions{}, time.Second); err != nil {
+			t.Errorf("expected no error, got %v", err)
+		}
+	})
+}
+
+func TestWaitForDeleted(t *testing.T) {
+	gvr := v1.SchemeGroupVersion.WithResource("persistentvolumeclaims")
+
+	t.Run("deleted then gone", func(t *testing.T) {
+		clientset := fake.NewSimpleClientset(newTestPVC("some-pvc", "ns", "1Gi", "standard"))
+		time.AfterFunc(time.Second, func() {
+			_ = clientset.Tracker().Delete(gvr, "ns", "some-pvc")
+		})
+
+		if err := WaitForDeleted(context.Background(), clientset, "some-pvc", "ns", 10*time.Second); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		for _, action := range clientset.Actions() {
+			if action.GetVerb() == "delete" {
+				t.Errorf("expected no delete, got %v", action)
+			}
+		}
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		clientset := fake.NewSimpleClientset(newTestPVC("some-pvc", "ns", "1Gi", "standard"))
+
+		err := WaitForDeleted(context.Background(), clientset, "some-pvc", "ns", time.Second)
+		if err == nil || !strings.Contains(err.Error(), "timed out") {
+			t.Errorf("expected a timeout, got %v", err)
+		}
+	})
+
+	t.Run("missing", func(t *testing.T) {
+		if err := WaitForDeleted(context.Background(), fake.NewSimpleClientset(), "some-pvc", "ns", time.Second); err != nil {
+			t.Errorf("expected no error, got %v", err)
+		}
+	})
+}
+
+func TestPoll(t *testing.T) {
+	defer func(options PollOptions) { DefaultPollOptions = options }(DefaultPollOptions)
+	DefaultPollOptions = PollOptions{Interval: 10 * time.Millisecond, JitterFactor: 1.0}
+
+	t.Run("converges", func(t *testing.T) {
+		calls := 0
+		start := time.Now()
+
+		err := poll(context.Background(), 10*time.Second, func() (bool, error) {
+			calls++
+			return calls == 5, nil
+		})
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if calls != 5 {
+			t.Errorf("expected 5 calls, got %d", calls)
+		}
+
+		// four waits of at least the interval and at most twice the interval
+		if elapsed := time.Since(start); elapsed < 40*time.Millisecond || elapsed > 5*time.Second {
+			t.Errorf("expected the waits to be jittered from the interval, took %s", elapsed)
+		}
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		start := time.Now()
+
+		err := poll(context.Background(), 100*time.Millisecond, func() (bool, error) { return false, nil })
+		if err != errPollTimeout {
+			t.Fatalf("expected a timeout, got %v", err)
+		}
+		if elapsed := time.Since(start); elapsed < 100*time.Millisecond || elapsed > 5*time.Second {
+			t.Errorf("expected to wait for the timeout, took %s", elapsed)
+		}
+	})
+
+	t.Run("error", func(t *testing.T) {
+		failure := errors.New("etcd is unavailable")
+
+		if err := poll(context.Background(), 10*time.Second, func() (bool, error) { return false, failure }); err != failure {
+			t.Errorf("expected the error of the condition, got %v", err)
+		}
+	})
+
+	t.Run("canceled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		time.AfterFunc(50*time.Millisecond, cancel)
+
+		if err := poll(ctx, 10*time.Second, func() (bool, error) { return false, nil }); err != context.Canceled {
+			t.Errorf("expected the context to be canceled, got %v", err)
+		}
+	})
+}
+
+func TestWaitForBound(t *testing.T) {
+	gvr := v1.SchemeGroupVersion.WithResource("persistentvolumeclaims")
+	pending := func(storageClass string) *v1.PersistentVolumeClaim {
+		pvc := newTestPVC("some-pvc", "ns", "1Gi", storageClass)
+		pvc.Status.Phase = v1.ClaimPending
+		return pvc
+	}
+	withBinding := func(name string, mode storagev1.VolumeBindingMode) *storagev1.StorageClass {
+		class := newTestStorageClass(name, false)
+		class.VolumeBindingMode = &mode
+		return class
+	}
+
+	t.Run("bound after delay", func(t *testing.T) {
+		pvc := pending("standard")
+		clientset := fake.NewSimpleClientset(pvc, withBinding("standard", storagev1.VolumeBindingImmediate))
+
+		bound := pvc.DeepCopy()
+		bound.Status.Phase = v1.ClaimBound
+		time.AfterFunc(time.Second, func() {
+			_ = clientset.Tracker().Update(gvr, bound, "ns")
+		})
+
+		if err := WaitForBound(context.Background(), clientset, "some-pvc", "ns", 10*time.Second); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		clientset := fake.NewSimpleClientset(pending("standard"),
+			withBinding("standard", storagev1.VolumeBindingImmediate))
+
+		err := WaitForBound(context.Background(), clientset, "some-pvc", "ns", time.Second)
+		if err == nil || !strings.Contains(err.Error(), "timed out") || !strings.Contains(err.Error(), "Pending") {
+			t.Errorf("expected a timeout naming the phase, got %v", err)
+		}
+	})
+
+	t.Run("wait for first consumer", func(t *testing.T) {
+		clientset := fake.NewSimpleClientset(pending("local"),
+			withBinding("local", storagev1.VolumeBindingWaitForFirstConsumer))
+
+		if err := WaitForBound(context.Background(), clientset, "some-pvc", "ns", time.Second); err != nil {
+			t.Errorf("expected no error, got %v", err)
+		}
+	})
+
+	t.Run("default class waits for first consumer", func(t *testing.T) {
+		pvc := pending("")
+		pvc.Spec.StorageClassName = nil
+		class := withBinding("local", storagev1.VolumeBindingWaitForFirstConsumer)
+		class.Annotations = map[string]string{annotationDefaultStorageClass: "true"}
+		clientset := fake.NewSimpleClientset(pvc, class)
+
+		if err := WaitForBound(context.Background(), clientset, "some-pvc", "ns", time.Second); err != nil {
+			t.Errorf("expected no error, got %v", err)
+		}
+	})
+
+	t.Run("node selected", func(t *testing.T) {
+		pvc := pending("local")
+		pvc.Annotations = map[string]string{annotationSelectedNode: "node-1"}
+		clientset := fake.NewSimpleClientset(pvc,
+			withBinding("local", storagev1.VolumeBindingWaitForFirstConsumer))
+
+		if err := WaitForBound(context.Background(), clientset, "some-pvc", "ns", time.Second); err == nil {
+			t.Error("expected a timeout once provisioning has started")
+		}
+	})
+
+	t.Run("lost", func(t *testing.T) {
+		pvc := pending("standard")
+		pvc.Status.Phase = v1.ClaimLost
+		clientset := fake.NewSimpleClientset(pvc)
+
+		if err := WaitForBound(context.Background(), clientset, "some-pvc", "ns", 10*time.Second); err == nil ||
+			strings.Contains(err.Error(), "timed out") {
+			t.Errorf("expected an immediate error, got %v", err)
+		}
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		err := WaitForBound(context.Background(), fake.NewSimpleClientset(), "some-pvc", "ns", time.Second)
+		if err == nil || !strings.Contains(err.Error(), "not found") {
+			t.Errorf("expected a timeout naming the missing pvc, got %v", err)
+		}
+	})
+}
+
+func TestDeleteIfExistsRetainOnDelete(t *testing.T) {
+	for _, tt := range []struct {
+		retain  bool
+		deleted bool
+	}{
+		{retain: true, deleted: false},
+		{retain: false, deleted: true},
+	} {
+		clientset := fake.NewSimpleClientset()
+		spec := crv1.PgStorageSpec{
+			AccessMode: "ReadWriteOnce", Size: "1G", StorageType: "dynamic", RetainOnDelete: tt.retain,
+		}
+
+		created, err := Create(context.Background(), clientset, "some-pvc", "some-cluster", "ns", CreateOptions{Spec: &spec})
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if actual := created.Annotations[config.ANNOTATION_PVC_RETAIN_ON_DELETE] == "true"; actual != tt.retain {
+			t.Errorf("expected retain annotation %v, got %v", tt.retain, created.Annotations)
+		}
+
+		if err := DeleteIfExists(context.Background(), clientset, "some-pvc", "ns", DeleteOptions{}); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if exists := Exists(context.Background(), clientset, "some-pvc", "ns"); exists == tt.deleted {
+			t.Errorf("expected deleted to be %v when retain is %v", tt.deleted, tt.retain)
+		}
+	}
+}
+
+func TestDeleteIfExistsErrors(t *testing.T) {
+	removable := newTestPVC("some-pvc", "ns", "1G", "")
+	removable.Labels = map[string]string{config.LABEL_PGREMOVE: "true"}
+
+	t.Run("not found", func(t *testing.T) {
+		if err := DeleteIfExists(context.Background(), fake.NewSimpleClientset(), "some-pvc", "ns", DeleteOptions{}); err != nil {
+			t.Errorf("expected no error, got %v", err)
+		}
+	})
+
+	t.Run("forbidden", func(t *testing.T) {
+		clientset := fake.NewSimpleClientset(removable)
+		clientset.PrependReactor("get", "persistentvolumeclaims",
+			func(k8stesting.Action) (bool, runtime.Object, error) {
+				return true, nil, kerrors.NewForbidden(v1.Resource("persistentvolumeclaims"), "some-pvc", nil)
+			})
+
+		if err := DeleteIfExists(context.Background(), clientset, "some-pvc", "ns", DeleteOptions{}); !kerrors.IsForbidden(err) {
+			t.Errorf("expected Forbidden, got %v", err)
+		}
+		for _, action := range clientset.Actions() {
+			if action.GetVerb() == "delete" {
+				t.Errorf("expected no delete, got %v", action)
+			}
+		}
+		if Exists(context.Background(), clientset, "some-pvc", "ns") {
+			t.Error("expected Forbidden to be reported as not existing")
+		}
+	})
+
+	t.Run("removed concurrently", func(t *testing.T) {
+		clientset := fake.NewSimpleClientset(removable)
+		clientset.PrependReactor("delete", "persistentvolumeclaims",
+			func(k8stesting.Action) (bool, runtime.Object, error) {
+				return true, nil, kerrors.NewNotFound(v1.Resource("persistentvolumeclaims"), "some-pvc")
+			})
+
+		deleted, err := deleteIfExists(context.Background(), clientset, "some-pvc", "ns", DeleteOptions{})
+		if err != nil || deleted {
+			t.Errorf("expected nothing to be deleted, got %v and %v", deleted, err)
+		}
+	})
+}
+
+func TestDeleteAll(t *testing.T) {
+	// newClusterPVC returns a PVC of the hippo cluster that may be removed
+	newClusterPVC := func(name string) *v1.PersistentVolumeClaim {
+		pvc := newTestPVC(name, "ns", "1Gi", "standard")
+		pvc.Labels = map[string]string{config.LABEL_PG_CLUSTER: "hippo", config.LABEL_PGREMOVE: "true"}
+		return pvc
+	}
+
+	kept := newClusterPVC("hippo-keep")
+	kept.Labels[config.LABEL_PGREMOVE] = "false"
+	other := newTestPVC("rhino", "ns", "1Gi", "standard")
+	other.Labels = map[string]string{config.LABEL_PG_CLUSTER: "rhino", config.LABEL_PGREMOVE: "true"}
+
+	clientset := fake.NewSimpleClientset(
+		newClusterPVC("hippo"), newClusterPVC("hippo-wal"), newClusterPVC("hippo-tablespace-ts1"),
+		kept, other)
+
+	// the delete of the WAL volume fails
+	clientset.PrependReactor("delete", "persistentvolumeclaims", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if action.(k8stesting.DeleteAction).GetName() == "hippo-wal" {
+			return true, nil, kerrors.NewInternalError(errors.New("etcd is unavailable"))
+		}
+		return false, nil, nil
+	})
+
+	deleted, err := DeleteAll(context.Background(), clientset, "hippo", "ns")
+	if err == nil || !strings.Contains(err.Error(), "hippo-wal") {
+		t.Errorf("expected an error naming hippo-wal, got %v", err)
+	}
+	if err != nil && strings.Contains(err.Error(), "hippo-tablespace-ts1") {
+		t.Errorf("expected an error naming only hippo-wal, got %v", err)
+	}
+
+	sort.Strings(deleted)
+	if expected := []string{"hippo", "hippo-tablespace-ts1"}; !reflect.DeepEqual(deleted, expected) {
+		t.Errorf("expected %v, got %v", expected, deleted)
+	}
+
+	for name, exists := range map[string]bool{
+		"hippo": false, "hippo-tablespace-ts1": false, "hippo-wal": true, "hippo-keep": true, "rhino": true,
+	} {
+		if _, err := clientset.CoreV1().PersistentVolumeClaims("ns").Get(name, metav1.GetOptions{}); kerrors.IsNotFound(err) == exists {
+			t.Errorf("expected pvc %s to exist: %t, got %v", name, exists, err)
+		}
+	}
+}
+
+func TestDeleteIfExistsOptions(t *testing.T) {
+	// the fake clientset drops DeleteOptions, so the claim is deleted through a
+	// clientset that talks to an HTTP server
+	deleteWith := func(t *testing.T, opts DeleteOptions) metav1.DeleteOptions {
+		var received metav1.DeleteOptions
+
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+
+			switch r.Method {
+			case http.MethodGet:
+				_ = json.NewEncoder(w).Encode(v1.PersistentVolumeClaim{
+					TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "PersistentVolumeClaim"},
+					ObjectMeta: metav1.ObjectMeta{
+						Name: "some-pvc", Namespace: "ns",
+						Labels: map[string]string{config.LABEL_PGREMOVE: "true"},
+					},
+				})
+			case http.MethodDelete:
+				if err := json.NewDecoder(r.Body).Decode(&received); err != nil {
+					http.Error(w, err.Error(), http.StatusBadRequest)
+					return
+				}
+				_ = json.NewEncoder(w).Encode(metav1.Status{
+					TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "Status"},
+					Status:   metav1.StatusSuccess,
+				})
+			default:
+				http.Error(w, r.Method, http.StatusMethodNotAllowed)
+			}
+		}))
+		defer server.Close()
+
+		clientset, err := kubernetes.NewForConfig(&rest.Config{Host: server.URL})
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if err := DeleteIfExists(context.Background(), clientset, "some-pvc", "ns", opts); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		return received
+	}
+
+	t.Run("default", func(t *testing.T) {
+		received := deleteWith(t, DeleteOptions{})
+		if received.PropagationPolicy == nil || *received.PropagationPolicy != metav1.DeletePropagationForeground {
+			t.Errorf("expected %q, got %v", metav1.DeletePropagationForeground, received.PropagationPolicy)
+		}
+		if received.GracePeriodSeconds != nil {
+			t.Errorf("expected the default grace period, got %v", *received.GracePeriodSeconds)
+		}
+	})
+
+	for _, policy := range []metav1.DeletionPropagation{
+		metav1.DeletePropagationForeground,
+		metav1.DeletePropagationBackground,
+		metav1.DeletePropagationOrphan,
+	} {
+		t.Run(string(policy), func(t *testing.T) {
+			zero := int64(0)
+			received := deleteWith(t, DeleteOptions{PropagationPolicy: policy, GracePeriodSeconds: &zero})
+			if received.PropagationPolicy == nil || *received.PropagationPolicy != policy {
+				t.Errorf("expected %q, got %v", policy, received.PropagationPolicy)
+			}
+			if received.GracePeriodSeconds == nil || *received.GracePeriodSeconds != 0 {
+				t.Errorf("expected a zero grace period, got %v", received.GracePeriodSeconds)
+			}
+		})
+	}
+}
+
+func TestDeleteIfExistsClusterName(t *testing.T) {
+	claim := func(labels map[string]string) *v1.PersistentVolumeClaim {
+		pvc := newTestPVC("some-pvc", "ns", "1Gi", "standard")
+		pvc.Labels = labels
+		return pvc
+	}
+	exists := func(t *testing.T, clientset *fake.Clientset) bool {
+		_, err := clientset.CoreV1().PersistentVolumeClaims("ns").Get("some-pvc", metav1.GetOptions{})
+		if err != nil && !kerrors.IsNotFound(err) {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return err == nil
+	}
+	opts := DeleteOptions{ClusterName: "hippo"}
+
+	t.Run("matching label", func(t *testing.T) {
+		clientset := fake.NewSimpleClientset(claim(map[string]string{
+			config.LABEL_PGREMOVE: "true", config.LABEL_PG_CLUSTER: "hippo",
+		}))
+
+		if err := DeleteIfExists(context.Background(), clientset, "some-pvc", "ns", opts); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if exists(t, clientset) {
+			t.Error("expected the pvc to be deleted")
+		}
+	})
+
+	t.Run("mismatching label", func(t *testing.T) {
+		clientset := fake.NewSimpleClientset(claim(map[string]string{
+			config.LABEL_PGREMOVE: "true", config.LABEL_PG_CLUSTER: "rhino",
+		}))
+
+		err := DeleteIfExists(context.Background(), clientset, "some-pvc", "ns", opts)
+		if !errors.Is(err, ErrClusterMismatch) || !strings.Contains(err.Error(), "rhino") {
+			t.Errorf("expected a mismatch naming the other cluster, got %v", err)
+		}
+		if !exists(t, clientset) {
+			t.Error("expected the pvc to be kept")
+		}
+	})
+
+	t.Run("missing label", func(t *testing.T) {
+		clientset := fake.NewSimpleClientset(claim(map[string]string{config.LABEL_PGREMOVE: "true"}))
+
+		if err := DeleteIfExists(context.Background(), clientset, "some-pvc", "ns", opts); !errors.Is(err, ErrClusterMismatch) {
+			t.Errorf("expected a mismatch, got %v", err)
+		}
+		if !exists(t, clientset) {
+			t.Error("expected the pvc to be kept")
+		}
+	})
+
+	t.Run("not set", func(t *testing.T) {
+		clientset := fake.NewSimpleClientset(claim(map[string]string{
+			config.LABEL_PGREMOVE: "true", config.LABEL_PG_CLUSTER: "rhino",
+		}))
+
+		if err := DeleteIfExists(context.Background(), clientset, "some-pvc", "ns", DeleteOptions{}); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if exists(t, clientset) {
+			t.Error("expected the pvc to be deleted")
+		}
+	})
+}
+
+// entryHook is a logrus hook that keeps every entry it is fired with
+type entryHook struct{ entries []*log.Entry }
+
+func (h *entryHook) Levels() []log.Level { return log.AllLevels }
+
+func (h *entryHook) Fire(entry *log.Entry) error {
+	h.entries = append(h.entries, entry)
+	return nil
+}
+
+// find returns the first entry with message, or nil
+func (h *entryHook) find(message string) *log.Entry {
+	for _, entry := range h.entries {
+		if entry.Message == message {
+			return entry
+		}
+	}
+	return nil
+}
+
+func TestLogFields(t *testing.T) {
+	hook := &entryHook{}
+	previous := log.StandardLogger().ReplaceHooks(log.LevelHooks{})
+	defer log.StandardLogger().ReplaceHooks(previous)
+	log.AddHook(hook)
+
+	// expectFields checks that the entry with message carries fields
+	expectFields := func(t *testing.T, message string, fields log.Fields) {
+		t.Helper()
+		entry := hook.find(message)
+		if entry == nil {
+			t.Fatalf("expected an entry %q", message)
+		}
+		for key, expected := range fields {
+			if actual := entry.Data[key]; actual != expected {
+				t.Errorf("expected %s=%v on %q, got %v", key, expected, message, actual)
+			}
+		}
+	}
+
+	spec := crv1.PgStorageSpec{AccessMode: "ReadWriteOnce", Size: "1G", StorageType: "create"}
+
+	t.Run("create", func(t *testing.T) {
+		clientset := fake.NewSimpleClientset()
+		if _, err := CreateIfNotExists(context.Background(), clientset, spec, "hippo", "hippo", "ns", nil); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		expectFields(t, "created pvc", log.Fields{"pvc": "hippo", "namespace": "ns", "storageType": "create", "size": "1000000000"})
+	})
+
+	t.Run("create failure", func(t *testing.T) {
+		clientset := fake.NewSimpleClientset()
+		clientset.PrependReactor("create", "persistentvolumeclaims", func(k8stesting.Action) (bool, runtime.Object, error) {
+			return true, nil, kerrors.NewForbidden(v1.Resource("persistentvolumeclaims"), "hippo", errors.New("quota"))
+		})
+
+		if _, err := CreateIfNotExists(context.Background(), clientset, spec, "hippo", "hippo", "ns", nil); err == nil {
+			t.Fatal("expected an error")
+		}
+
+		expectFields(t, "unable to create pvc", log.Fields{"pvc": "hippo", "namespace": "ns", "storageType": "create"})
+		if entry := hook.find("unable to create pvc"); entry.Data[log.ErrorKey] == nil {
+			t.Errorf("expected the error on the entry, got %v", entry.Data)
+		}
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		existing := newTestPVC("rhino", "ns", "1Gi", "standard")
+		existing.Labels = map[string]string{config.LABEL_PGREMOVE: "true"}
+		clientset := fake.NewSimpleClientset(existing)
+
+		if err := DeleteIfExists(context.Background(), clientset, "rhino", "ns", DeleteOptions{}); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		expectFields(t, "deleted pvc", log.Fields{"pvc": "rhino", "namespace": "ns"})
+	})
+}
+
+func TestCreateWithoutTemplates(t *testing.T) {
+	// PVCs are built in Go rather than from templates of the configuration, so
+	// every type of PVC can be created without any configuration being loaded
+	clientset := fake.NewSimpleClientset(newTestStorageClass("standard", false))
+
+	for name, spec := range map[string]crv1.PgStorageSpec{
+		"hippo-create":  {AccessMode: "ReadWriteOnce", Size: "1Gi", StorageType: "create"},
+		"hippo-labeled": {AccessMode: "ReadWriteOnce", Size: "1Gi", StorageType: "create", MatchLabels: "tier=gold"},
+		"hippo-dynamic": {AccessMode: "ReadWriteOnce", Size: "1Gi", StorageType: "dynamic", StorageClass: "standard"},
+	} {
+		spec := spec
+		if _, err := Create(context.Background(), clientset, name, "hippo", "ns", CreateOptions{Spec: &spec}); err != nil {
+			t.Errorf("expected no error for %s, got %v", name, err)
+		}
+	}
+
+	labeled, err := clientset.CoreV1().PersistentVolumeClaims("ns").Get("hippo-labeled", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if selector := labeled.Spec.Selector; selector == nil || selector.MatchLabels["tier"] != "gold" {
+		t.Errorf("expected a selector for tier=gold, got %v", selector)
+	}
+
+	dynamic, err := clientset.CoreV1().PersistentVolumeClaims("ns").Get("hippo-dynamic", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if class := dynamic.Spec.StorageClassName; class == nil || *class != "standard" {
+		t.Errorf("expected storage class standard, got %v", class)
+	}
+}
+
+func TestCreateDebugDocument(t *testing.T) {
+	hook := &entryHook{}
+	previous := log.StandardLogger().ReplaceHooks(log.LevelHooks{})
+	defer log.StandardLogger().ReplaceHooks(previous)
+	log.AddHook(hook)
+
+	defer func(level log.Level, debug bool) {
+		log.SetLevel(level)
+		operator.CRUNCHY_DEBUG = debug
+	}(log.GetLevel(), operator.CRUNCHY_DEBUG)
+
+	spec := crv1.PgStorageSpec{AccessMode: "ReadWriteOnce", Size: "1G", StorageType: "create"}
+
+	// documents returns the rendered documents that were logged
+	documents := func() []*log.Entry {
+		entries := []*log.Entry{}
+		for _, entry := range hook.entries {
+			if entry.Message == "rendered pvc" {
+				entries = append(entries, entry)
+			}
+		}
+		return entries
+	}
+
+	t.Run("enabled", func(t *testing.T) {
+		hook.entries = nil
+		log.SetLevel(log.DebugLevel)
+		operator.CRUNCHY_DEBUG = true
+
+		if _, err := Create(context.Background(), fake.NewSimpleClientset(), "hippo", "hippo", "ns",
+			CreateOptions{Spec: &spec}); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		entries := documents()
+		if len(entries) != 1 {
+			t.Fatalf("expected the pvc to be logged once, got %d", len(entries))
+		}
+		if entries[0].Level != log.DebugLevel {
+			t.Errorf("expected debug level, got %v", entries[0].Level)
+		}
+
+		var logged v1.PersistentVolumeClaim
+		if err := json.Unmarshal([]byte(entries[0].Data["document"].(string)), &logged); err != nil {
+			t.Fatalf("expected the pvc as JSON, got %v", err)
+		}
+		if logged.Name != "hippo" {
+			t.Errorf("expected the rendered pvc, got %+v", logged)
+		}
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		hook.entries = nil
+		log.SetLevel(log.DebugLevel)
+		operator.CRUNCHY_DEBUG = false
+
+		if _, err := Create(context.Background(), fake.NewSimpleClientset(), "hippo", "hippo", "ns",
+			CreateOptions{Spec: &spec}); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if entries := documents(); len(entries) != 0 {
+			t.Errorf("expected nothing to be logged, got %d entries", len(entries))
+		}
+	})
+}
@@ -0,0 +1,100 @@
+package pvc
+
+/*
+ Copyright 2020 Crunchy Data Solutions, Inc.
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/kubernetes"
+)
+
+// RelabelClusterPVCs adds the labels of add to every PVC of clusterName and
+// removes the labels of remove, e.g. when the keys of labels change between
+// versions of the Operator. A label in remove is only removed when it has the
+// same value on the PVC, unless the value in remove is empty. Each PVC is
+// changed with a single patch, and a failure to relabel one PVC does not stop
+// the others from being relabeled. The error names each PVC that was not.
+func RelabelClusterPVCs(ctx context.Context, clientset kubernetes.Interface, clusterName, namespace string, add, remove map[string]string) error {
+	for key, value := range add {
+		if errs := validation.IsQualifiedName(key); len(errs) > 0 {
+			return fmt.Errorf("label key %q is invalid: %s", key, strings.Join(errs, "; "))
+		}
+		if errs := validation.IsValidLabelValue(value); len(errs) > 0 {
+			return fmt.Errorf("label value %q of key %q is invalid: %s", value, key, strings.Join(errs, "; "))
+		}
+	}
+
+	pvcs, err := List(ctx, clientset, clusterName, namespace)
+	if err != nil {
+		return err
+	}
+
+	errs := []error{}
+	for i := range pvcs {
+		if err := relabel(ctx, clientset, &pvcs[i], add, remove); err != nil {
+			errs = append(errs, fmt.Errorf("unable to relabel pvc %s: %w", pvcs[i].Name, err))
+		}
+	}
+
+	return utilerrors.NewAggregate(errs)
+}
+
+// relabel merge-patches the labels of pvc as described by RelabelClusterPVCs.
+// A PVC that already has the labels it should is not patched.
+func relabel(ctx context.Context, clientset kubernetes.Interface, pvc *v1.PersistentVolumeClaim, add, remove map[string]string) error {
+	labels := map[string]interface{}{}
+	for key, value := range remove {
+		if current, ok := pvc.Labels[key]; ok && (value == "" || value == current) {
+			labels[key] = nil
+		}
+	}
+	for key, value := range add {
+		if current, ok := pvc.Labels[key]; !ok || current != value {
+			labels[key] = value
+		}
+	}
+
+	if len(labels) == 0 {
+		return nil
+	}
+
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{"labels": labels},
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if _, err := clientset.CoreV1().PersistentVolumeClaims(pvc.Namespace).Patch(pvc.Name,
+		types.MergePatchType, patch); err != nil {
+		return err
+	}
+
+	logFields(pvc.Name, pvc.Namespace).Info("relabeled pvc")
+
+	return nil
+}
@@ -0,0 +1,120 @@
+package pvc
+
+/*
+ Copyright 2020 Crunchy Data Solutions, Inc.
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/crunchydata/postgres-operator/internal/config"
+	v1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestRelabelClusterPVCs(t *testing.T) {
+	// newClusterPVC returns a PVC of the hippo cluster with the labels of an
+	// older version of the Operator
+	newClusterPVC := func(name string) *v1.PersistentVolumeClaim {
+		pvc := newTestPVC(name, "ns", "1Gi", "standard")
+		pvc.Labels = map[string]string{config.LABEL_PG_CLUSTER: "hippo", "vendor": "crunchydata", "old-role": "data"}
+		return pvc
+	}
+	labelsOf := func(t *testing.T, clientset *fake.Clientset, name string) map[string]string {
+		pvc, err := clientset.CoreV1().PersistentVolumeClaims("ns").Get(name, metav1.GetOptions{})
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		return pvc.Labels
+	}
+
+	other := newTestPVC("rhino", "ns", "1Gi", "standard")
+	other.Labels = map[string]string{config.LABEL_PG_CLUSTER: "rhino", "old-role": "data"}
+
+	add := map[string]string{"role": "data"}
+	remove := map[string]string{"old-role": "", "vendor": "someone-else"}
+
+	t.Run("added and removed", func(t *testing.T) {
+		clientset := fake.NewSimpleClientset(newClusterPVC("hippo"), newClusterPVC("hippo-wal"), other.DeepCopy())
+
+		if err := RelabelClusterPVCs(context.Background(), clientset, "hippo", "ns", add, remove); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		expected := map[string]string{config.LABEL_PG_CLUSTER: "hippo", "vendor": "crunchydata", "role": "data"}
+		for _, name := range []string{"hippo", "hippo-wal"} {
+			if actual := labelsOf(t, clientset, name); !reflect.DeepEqual(expected, actual) {
+				t.Errorf("expected %v on %s, got %v", expected, name, actual)
+			}
+		}
+		if actual := labelsOf(t, clientset, "rhino"); !reflect.DeepEqual(other.Labels, actual) {
+			t.Errorf("expected the other cluster to be left alone, got %v", actual)
+		}
+
+		// a second pass has nothing to change
+		clientset.ClearActions()
+		if err := RelabelClusterPVCs(context.Background(), clientset, "hippo", "ns", add, remove); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		for _, action := range clientset.Actions() {
+			if action.GetVerb() == "patch" {
+				t.Errorf("expected no patches, got %v", action)
+			}
+		}
+	})
+
+	t.Run("partial failure", func(t *testing.T) {
+		clientset := fake.NewSimpleClientset(newClusterPVC("hippo"), newClusterPVC("hippo-wal"), newClusterPVC("hippo-ts1"))
+		clientset.PrependReactor("patch", "persistentvolumeclaims", func(action k8stesting.Action) (bool, runtime.Object, error) {
+			if action.(k8stesting.PatchAction).GetName() == "hippo-wal" {
+				return true, nil, kerrors.NewInternalError(errors.New("etcd is unavailable"))
+			}
+			return false, nil, nil
+		})
+
+		err := RelabelClusterPVCs(context.Background(), clientset, "hippo", "ns", add, remove)
+		if err == nil || !strings.Contains(err.Error(), "hippo-wal") {
+			t.Errorf("expected an error naming hippo-wal, got %v", err)
+		}
+		if err != nil && (strings.Contains(err.Error(), "hippo-ts1") || strings.Contains(err.Error(), "hippo ")) {
+			t.Errorf("expected an error naming only hippo-wal, got %v", err)
+		}
+
+		for name, relabeled := range map[string]bool{"hippo": true, "hippo-wal": false, "hippo-ts1": true} {
+			if _, ok := labelsOf(t, clientset, name)["role"]; ok != relabeled {
+				t.Errorf("expected pvc %s to be relabeled: %t", name, relabeled)
+			}
+		}
+	})
+
+	t.Run("invalid label", func(t *testing.T) {
+		clientset := fake.NewSimpleClientset(newClusterPVC("hippo"))
+
+		if err := RelabelClusterPVCs(context.Background(), clientset, "hippo", "ns",
+			map[string]string{"bad key": "data"}, nil); err == nil {
+			t.Error("expected an error")
+		}
+		if actions := clientset.Actions(); len(actions) != 0 {
+			t.Errorf("expected no requests, got %v", actions)
+		}
+	})
+}
@@ -0,0 +1,284 @@
+package pvc
+
+/*
+ Copyright 2020 Crunchy Data Solutions, Inc.
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/crunchydata/postgres-operator/internal/config"
+	"github.com/crunchydata/postgres-operator/internal/util"
+	crv1 "github.com/crunchydata/postgres-operator/pkg/apis/crunchydata.com/v1"
+	log "github.com/sirupsen/logrus"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Resize grows the storage request of an existing PVC to newSize. Requests to
+// shrink a PVC are rejected, and a request equal to the current size is a
+// no-op. The StorageClass of the PVC must allow volume expansion.
+func Resize(ctx context.Context, clientset kubernetes.Interface, name, namespace, newSize string) error {
+	size, err := resource.ParseQuantity(newSize)
+	if err != nil {
+		return fmt.Errorf("invalid size %q for pvc %s: %w", newSize, name, err)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	pvc, err := clientset.CoreV1().PersistentVolumeClaims(namespace).Get(name, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+
+	return resizeClaim(ctx, clientset, pvc, size)
+}
+
+// resizeClaim is Resize for the PVC pvc, which was already fetched from the API
+// server.
+func resizeClaim(ctx context.Context, clientset kubernetes.Interface, pvc *v1.PersistentVolumeClaim, size resource.Quantity) error {
+	current := pvc.Spec.Resources.Requests[v1.ResourceStorage]
+
+	switch size.Cmp(current) {
+	case 0:
+		logFields(pvc.Name, pvc.Namespace).WithField("size", current.String()).
+			Debug("pvc is already the requested size, nothing to resize")
+		return nil
+	case -1:
+		return fmt.Errorf("cannot shrink pvc %s from %s to %s",
+			pvc.Name, current.String(), size.String())
+	}
+
+	if err := checkVolumeExpansion(clientset, pvc); err != nil {
+		return err
+	}
+
+	patch, err := json.Marshal([]util.JSONPatchOperation{{
+		Op:    "replace",
+		Path:  "/spec/resources/requests/storage",
+		Value: size.String(),
+	}})
+	if err != nil {
+		return err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if _, err := clientset.CoreV1().PersistentVolumeClaims(pvc.Namespace).Patch(pvc.Name,
+		types.JSONPatchType, patch); err != nil {
+		return err
+	}
+
+	logFields(pvc.Name, pvc.Namespace).WithFields(log.Fields{"from": current.String(), "to": size.String()}).
+		Info("resized pvc")
+
+	return nil
+}
+
+// errNotExpandable is returned when the storage of a PVC cannot be grown
+var errNotExpandable = errors.New("volume expansion is not allowed")
+
+// checkVolumeExpansion returns an error unless the StorageClass of pvc allows
+// volume expansion. The error wraps errNotExpandable when it does not, or when
+// pvc has no StorageClass.
+func checkVolumeExpansion(clientset kubernetes.Interface, pvc *v1.PersistentVolumeClaim) error {
+	if pvc.Spec.StorageClassName == nil || *pvc.Spec.StorageClassName == "" {
+		return fmt.Errorf("%w: pvc %s has no storage class to verify that it can be expanded",
+			errNotExpandable, pvc.Name)
+	}
+
+	className := *pvc.Spec.StorageClassName
+	sc, err := clientset.StorageV1().StorageClasses().Get(className, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("unable to get storage class %s for pvc %s: %w", className, pvc.Name, err)
+	}
+
+	if sc.AllowVolumeExpansion == nil || !*sc.AllowVolumeExpansion {
+		return fmt.Errorf("%w by storage class %s of pvc %s",
+			errNotExpandable, className, pvc.Name)
+	}
+
+	return nil
+}
+
+// resizeIfLarger grows the PVC pvc to size if, and only if, size is larger
+// than what the PVC currently requests. A size that is empty or smaller than
+// the current request is ignored.
+func resizeIfLarger(ctx context.Context, clientset kubernetes.Interface, pvc *v1.PersistentVolumeClaim, size string) error {
+	if size == "" {
+		return nil
+	}
+
+	requested, err := resource.ParseQuantity(size)
+	if err != nil {
+		return fmt.Errorf("invalid size %q for pvc %s: %w", size, pvc.Name, err)
+	}
+
+	if current := pvc.Spec.Resources.Requests[v1.ResourceStorage]; requested.Cmp(current) <= 0 {
+		return nil
+	}
+
+	return resizeClaim(ctx, clientset, pvc, requested)
+}
+
+// VolumeResize reports what ResizeCluster did with one volume of a cluster.
+type VolumeResize struct {
+	// Role is one of "data", "wal", or "tablespace".
+	Role string
+	// Name is the name of the PVC.
+	Name string
+
+	// From is the size of the PVC before, and To is its size after. They are
+	// the same when the PVC was already large enough.
+	From, To resource.Quantity
+
+	// Resized is true when the PVC was grown.
+	Resized bool
+}
+
+// ResizeCluster grows the data, WAL, and tablespace PVCs of every instance of
+// cluster that are smaller than their storage specifications, using Resize.
+// The instances are the primary and the replicas that have a Deployment, and
+// their PVCs are those returned by List. The data PVC of the current primary is
+// compared with PrimaryStorage, and that of a replica with ReplicaStorage. A
+// PVC that is already at least as large as its specification is left alone, as
+// is one that does not exist or was not created by the Operator. It returns a
+// VolumeResize for every PVC that it checked, up to any error.
+func ResizeCluster(ctx context.Context, clientset kubernetes.Interface, cluster *crv1.Pgcluster, namespace string) ([]VolumeResize, error) {
+	primary := cluster.Annotations[config.ANNOTATION_CURRENT_PRIMARY]
+	if primary == "" {
+		primary = cluster.Spec.Name
+	}
+
+	replicas, err := listReplicas(ctx, clientset, cluster.Name, primary, namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	pvcs, err := List(ctx, clientset, cluster.Name, namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	claims := map[string]*v1.PersistentVolumeClaim{}
+	for i := range pvcs {
+		claims[pvcs[i].Name] = &pvcs[i]
+	}
+
+	type volume struct {
+		role, name string
+		spec       crv1.PgStorageSpec
+	}
+
+	tablespaceNames := make([]string, 0, len(cluster.Spec.TablespaceMounts))
+	for tablespaceName := range cluster.Spec.TablespaceMounts {
+		tablespaceNames = append(tablespaceNames, tablespaceName)
+	}
+	sort.Strings(tablespaceNames)
+
+	volumes := []volume{}
+	for _, instance := range append([]string{primary}, replicas...) {
+		data := cluster.Spec.ReplicaStorage
+		if instance == primary {
+			data = cluster.Spec.PrimaryStorage
+		}
+
+		volumes = append(volumes,
+			volume{"data", instance, data},
+			volume{"wal", instance + "-wal", cluster.Spec.WALStorage})
+
+		for _, tablespaceName := range tablespaceNames {
+			volumes = append(volumes, volume{"tablespace",
+				tablespacePVCName(instance, tablespaceName),
+				cluster.Spec.TablespaceMounts[tablespaceName]})
+		}
+	}
+
+	report := []VolumeResize{}
+	for _, v := range volumes {
+		pvc, ok := claims[v.name]
+		if !ok {
+			continue
+		}
+		if (v.spec.StorageType != "create" && v.spec.StorageType != "dynamic") || v.spec.Size == "" {
+			continue
+		}
+
+		result, err := resizeVolume(ctx, clientset, v.role, pvc, v.spec.Size)
+		if err != nil {
+			return report, fmt.Errorf("unable to resize %s volume %s: %w", v.role, v.name, err)
+		}
+		report = append(report, result)
+	}
+
+	return report, nil
+}
+
+// listReplicas returns the sorted names of the instances of clusterName other
+// than primary, which are those of their Deployments.
+func listReplicas(ctx context.Context, clientset kubernetes.Interface, clusterName, primary, namespace string) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	selector := config.LABEL_PG_CLUSTER + "=" + clusterName + "," + config.LABEL_PG_DATABASE + "=true"
+	deployments, err := clientset.AppsV1().Deployments(namespace).List(
+		metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return nil, err
+	}
+
+	replicas := []string{}
+	for _, deployment := range deployments.Items {
+		if deployment.Name != primary {
+			replicas = append(replicas, deployment.Name)
+		}
+	}
+	sort.Strings(replicas)
+
+	return replicas, nil
+}
+
+// resizeVolume grows the PVC pvc to size when it is smaller.
+func resizeVolume(ctx context.Context, clientset kubernetes.Interface, role string, pvc *v1.PersistentVolumeClaim, size string) (VolumeResize, error) {
+	current := pvc.Spec.Resources.Requests[v1.ResourceStorage]
+	result := VolumeResize{Role: role, Name: pvc.Name, From: current, To: current}
+
+	requested, err := resource.ParseQuantity(size)
+	if err != nil {
+		return result, fmt.Errorf("invalid size %q: %w", size, err)
+	}
+
+	if requested.Cmp(current) <= 0 {
+		return result, nil
+	}
+
+	if err := resizeClaim(ctx, clientset, pvc, requested); err != nil {
+		return result, err
+	}
+
+	result.To, result.Resized = requested, true
+	return result, nil
+}
@@ -0,0 +1,270 @@
+package pvc
+
+/*
+ Copyright 2020 Crunchy Data Solutions, Inc.
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/crunchydata/postgres-operator/internal/config"
+	crv1 "github.com/crunchydata/postgres-operator/pkg/apis/crunchydata.com/v1"
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func newTestPVC(name, namespace, size, storageClass string) *v1.PersistentVolumeClaim {
+	return &v1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+		Spec: v1.PersistentVolumeClaimSpec{
+			StorageClassName: &storageClass,
+			Resources: v1.ResourceRequirements{
+				Requests: v1.ResourceList{
+					v1.ResourceStorage: resource.MustParse(size),
+				},
+			},
+		},
+	}
+}
+
+func newTestStorageClass(name string, allowExpansion bool) *storagev1.StorageClass {
+	return &storagev1.StorageClass{
+		ObjectMeta:           metav1.ObjectMeta{Name: name},
+		AllowVolumeExpansion: &allowExpansion,
+	}
+}
+
+func TestResize(t *testing.T) {
+	requested := func(t *testing.T, clientset *fake.Clientset, name string) string {
+		pvc, err := clientset.CoreV1().PersistentVolumeClaims("ns").Get(name, metav1.GetOptions{})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		q := pvc.Spec.Resources.Requests[v1.ResourceStorage]
+		return q.String()
+	}
+
+	t.Run("grow", func(t *testing.T) {
+		clientset := fake.NewSimpleClientset(
+			newTestPVC("data", "ns", "1Gi", "fast"),
+			newTestStorageClass("fast", true))
+
+		if err := Resize(context.Background(), clientset, "data", "ns", "2Gi"); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if actual := requested(t, clientset, "data"); actual != "2Gi" {
+			t.Errorf("expected 2Gi, got %q", actual)
+		}
+	})
+
+	t.Run("no-op", func(t *testing.T) {
+		clientset := fake.NewSimpleClientset(
+			newTestPVC("data", "ns", "1Gi", "fast"),
+			newTestStorageClass("fast", true))
+
+		if err := Resize(context.Background(), clientset, "data", "ns", "1024Mi"); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		for _, action := range clientset.Actions() {
+			if action.GetVerb() == "patch" {
+				t.Errorf("expected no patch, got %v", action)
+			}
+		}
+	})
+
+	t.Run("shrink", func(t *testing.T) {
+		clientset := fake.NewSimpleClientset(
+			newTestPVC("data", "ns", "2Gi", "fast"),
+			newTestStorageClass("fast", true))
+
+		if err := Resize(context.Background(), clientset, "data", "ns", "1Gi"); err == nil {
+			t.Fatal("expected an error")
+		}
+		if actual := requested(t, clientset, "data"); actual != "2Gi" {
+			t.Errorf("expected 2Gi, got %q", actual)
+		}
+	})
+
+	t.Run("expansion not allowed", func(t *testing.T) {
+		clientset := fake.NewSimpleClientset(
+			newTestPVC("data", "ns", "1Gi", "slow"),
+			newTestStorageClass("slow", false))
+
+		if err := Resize(context.Background(), clientset, "data", "ns", "2Gi"); err == nil {
+			t.Fatal("expected an error")
+		}
+		if actual := requested(t, clientset, "data"); actual != "1Gi" {
+			t.Errorf("expected 1Gi, got %q", actual)
+		}
+	})
+}
+
+func TestResizeIfLarger(t *testing.T) {
+	pvc := newTestPVC("data", "ns", "2Gi", "fast")
+	clientset := fake.NewSimpleClientset(pvc, newTestStorageClass("fast", true))
+
+	for _, size := range []string{"", "1Gi", "2Gi"} {
+		if err := resizeIfLarger(context.Background(), clientset, pvc, size); err != nil {
+			t.Errorf("expected no error for %q, got %v", size, err)
+		}
+	}
+	if actions := clientset.Actions(); len(actions) != 0 {
+		t.Errorf("expected no API calls, got %v", actions)
+	}
+
+	if err := resizeIfLarger(context.Background(), clientset, pvc, "3Gi"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	for _, action := range clientset.Actions() {
+		if action.GetVerb() == "get" && action.GetResource().Resource == "persistentvolumeclaims" {
+			t.Errorf("expected the pvc not to be fetched again, got %v", action)
+		}
+	}
+	stored, _ := clientset.CoreV1().PersistentVolumeClaims("ns").Get("data", metav1.GetOptions{})
+	if q := stored.Spec.Resources.Requests[v1.ResourceStorage]; q.String() != "3Gi" {
+		t.Errorf("expected 3Gi, got %q", q.String())
+	}
+}
+
+func TestResizeCluster(t *testing.T) {
+	spec := func(size string) crv1.PgStorageSpec {
+		return crv1.PgStorageSpec{AccessMode: "ReadWriteOnce", Size: size, StorageType: "dynamic", StorageClass: "fast"}
+	}
+	cluster := &crv1.Pgcluster{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "hippo",
+			Annotations: map[string]string{config.ANNOTATION_CURRENT_PRIMARY: "hippo-abcd"},
+		},
+		Spec: crv1.PgclusterSpec{
+			Name:           "hippo",
+			PrimaryStorage: spec("2Gi"),
+			ReplicaStorage: spec("3Gi"),
+			WALStorage:     spec("1Gi"),
+			TablespaceMounts: map[string]crv1.PgStorageSpec{
+				"lake": spec("5Gi"),
+				"pond": spec("1Gi"),
+				"tmp":  {StorageType: "emptydir", Size: "1Gi"},
+			},
+		},
+	}
+
+	// clusterPVC returns a PVC that List finds for the hippo cluster
+	clusterPVC := func(name, size, storageClass string) *v1.PersistentVolumeClaim {
+		pvc := newTestPVC(name, "ns", size, storageClass)
+		pvc.Labels = map[string]string{config.LABEL_PG_CLUSTER: "hippo"}
+		return pvc
+	}
+	// instance returns the Deployment of an instance of the hippo cluster
+	instance := func(name string) *appsv1.Deployment {
+		return &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{
+			Name: name, Namespace: "ns",
+			Labels: map[string]string{config.LABEL_PG_CLUSTER: "hippo", config.LABEL_PG_DATABASE: "true"},
+		}}
+	}
+
+	clientset := fake.NewSimpleClientset(
+		instance("hippo-abcd"), instance("hippo-efgh"),
+		clusterPVC("hippo-abcd", "1Gi", "fast"),
+		clusterPVC("hippo-abcd-wal", "1Gi", "fast"),
+		clusterPVC("hippo-abcd-tablespace-lake", "3Gi", "fast"),
+		clusterPVC("hippo-abcd-tablespace-pond", "2Gi", "fast"),
+		clusterPVC("hippo-efgh", "1Gi", "fast"),
+		clusterPVC("hippo-efgh-wal", "1Gi", "fast"),
+		clusterPVC("hippo-efgh-tablespace-lake", "3Gi", "fast"),
+		clusterPVC("hippo-pgbr-repo", "1Gi", "fast"),
+		newTestStorageClass("fast", true))
+
+	report, err := ResizeCluster(context.Background(), clientset, cluster, "ns")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	summary := []string{}
+	for _, r := range report {
+		summary = append(summary, r.Role+" "+r.Name+" "+r.From.String()+" "+r.To.String()+" "+
+			map[bool]string{true: "resized", false: "unchanged"}[r.Resized])
+	}
+	expected := []string{
+		"data hippo-abcd 1Gi 2Gi resized",
+		"wal hippo-abcd-wal 1Gi 1Gi unchanged",
+		"tablespace hippo-abcd-tablespace-lake 3Gi 5Gi resized",
+		"tablespace hippo-abcd-tablespace-pond 2Gi 2Gi unchanged",
+		"data hippo-efgh 1Gi 3Gi resized",
+		"wal hippo-efgh-wal 1Gi 1Gi unchanged",
+		"tablespace hippo-efgh-tablespace-lake 3Gi 5Gi resized",
+	}
+	if strings.Join(summary, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("expected\n%s\ngot\n%s", strings.Join(expected, "\n"), strings.Join(summary, "\n"))
+	}
+
+	// the claims that were listed are not fetched again
+	for _, action := range clientset.Actions() {
+		if action.GetVerb() == "get" && action.GetResource().Resource == "persistentvolumeclaims" {
+			t.Errorf("expected no pvc to be fetched, got %v", action)
+		}
+	}
+
+	for name, size := range map[string]string{
+		"hippo-abcd-tablespace-lake": "5Gi",
+		"hippo-efgh":                 "3Gi",
+		"hippo-pgbr-repo":            "1Gi",
+	} {
+		pvc, _ := clientset.CoreV1().PersistentVolumeClaims("ns").Get(name, metav1.GetOptions{})
+		if q := pvc.Spec.Resources.Requests[v1.ResourceStorage]; q.String() != size {
+			t.Errorf("expected %s to be %s, got %q", name, size, q.String())
+		}
+	}
+
+	t.Run("idempotent", func(t *testing.T) {
+		clientset.ClearActions()
+
+		report, err := ResizeCluster(context.Background(), clientset, cluster, "ns")
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		for _, r := range report {
+			if r.Resized {
+				t.Errorf("expected nothing to be resized, got %v", r)
+			}
+		}
+		for _, action := range clientset.Actions() {
+			if action.GetVerb() == "patch" {
+				t.Errorf("expected no patch, got %v", action)
+			}
+		}
+	})
+
+	t.Run("expansion not allowed", func(t *testing.T) {
+		clientset := fake.NewSimpleClientset(
+			instance("hippo-abcd"),
+			clusterPVC("hippo-abcd", "2Gi", "fixed"),
+			clusterPVC("hippo-abcd-wal", "1Gi", "fixed"),
+			clusterPVC("hippo-abcd-tablespace-lake", "3Gi", "fixed"),
+			newTestStorageClass("fixed", false))
+
+		report, err := ResizeCluster(context.Background(), clientset, cluster, "ns")
+		if err == nil || !strings.Contains(err.Error(), "tablespace volume hippo-abcd-tablespace-lake") {
+			t.Fatalf("expected the lake tablespace to fail, got %v", err)
+		}
+		if len(report) != 2 {
+			t.Errorf("expected the data and wal volumes to be reported, got %v", report)
+		}
+	})
+}
@@ -20,12 +20,44 @@ import (
 	"encoding/json"
 
 	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 )
 
 // StorageResult is a resolved PgStorageSpec. The zero value is an emptyDir.
 type StorageResult struct {
 	PersistentVolumeClaimName string
 	SupplementalGroups        []int64
+
+	// FSGroup is the securityContext.fsGroup that a pod needs to write to the
+	// volume. It is nil when the PgStorageSpec does not call for one.
+	FSGroup *int64
+
+	// SizeLimit caps the storage of an emptyDir. It is nil when the emptyDir
+	// is unbounded.
+	SizeLimit *resource.Quantity
+
+	// Size is the storage requested by a PgStorageSpec that calls for a PVC to
+	// be created. It is nil for any other PgStorageSpec.
+	Size *resource.Quantity
+
+	// StorageClass is the StorageClass that a "dynamic" PgStorageSpec asks
+	// for. It is empty for any other PgStorageSpec and when the default
+	// StorageClass is used.
+	StorageClass string
+
+	// ReadOnly causes the PersistentVolumeClaim to be mounted read-only. It is
+	// only set for an existing claim.
+	ReadOnly bool
+
+	// Claim is the PersistentVolumeClaim that was created while resolving the
+	// PgStorageSpec, if any. It is nil when the claim already existed or when
+	// no claim is needed.
+	Claim *v1.PersistentVolumeClaim
+
+	// Created is true when the PersistentVolumeClaim was created while
+	// resolving the PgStorageSpec. It is false when the claim already existed,
+	// when no claim is needed, and for a dry run.
+	Created bool
 }
 
 // InlineVolumeSource returns the key and value of a k8s.io/api/core/v1.VolumeSource.
@@ -45,9 +77,10 @@ func (s StorageResult) VolumeSource() v1.VolumeSource {
 		return v1.VolumeSource{
 			PersistentVolumeClaim: &v1.PersistentVolumeClaimVolumeSource{
 				ClaimName: s.PersistentVolumeClaimName,
+				ReadOnly:  s.ReadOnly,
 			},
 		}
 	}
 
-	return v1.VolumeSource{EmptyDir: &v1.EmptyDirVolumeSource{}}
+	return v1.VolumeSource{EmptyDir: &v1.EmptyDirVolumeSource{SizeLimit: s.SizeLimit}}
 }
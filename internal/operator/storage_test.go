@@ -20,6 +20,7 @@ import (
 	"testing"
 
 	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 )
 
 func TestStorageResultInlineVolumeSource(t *testing.T) {
@@ -27,15 +28,20 @@ func TestStorageResultInlineVolumeSource(t *testing.T) {
 		t.Logf("expected VolumeSource to always marshal with brackets, got %q", b)
 	}
 
+	limit := resource.MustParse("1Gi")
+
 	for _, tt := range []struct {
 		value    StorageResult
 		expected string
 	}{
 		{StorageResult{}, `"emptyDir":{}`},
+		{StorageResult{SizeLimit: &limit}, `"emptyDir":{"sizeLimit":"1Gi"}`},
 		{StorageResult{PersistentVolumeClaimName: "<\x00"},
 			`"persistentVolumeClaim":{"claimName":"<\u0000"}`},
 		{StorageResult{PersistentVolumeClaimName: "some-name"},
 			`"persistentVolumeClaim":{"claimName":"some-name"}`},
+		{StorageResult{PersistentVolumeClaimName: "some-name", ReadOnly: true},
+			`"persistentVolumeClaim":{"claimName":"some-name","readOnly":true}`},
 	} {
 		if actual := tt.value.InlineVolumeSource(); actual != tt.expected {
 			t.Errorf("expected %q for %v, got %q", tt.expected, tt.value, actual)
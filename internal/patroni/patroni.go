@@ -16,6 +16,7 @@ package patroni
 */
 
 import (
+	"context"
 	"errors"
 	"fmt"
 
@@ -194,7 +195,7 @@ func (p *patroniClient) RestartInstances(instances ...string) ([]RestartResult,
 // replica) within a PG cluster
 func (p *patroniClient) reload(podName string) error {
 
-	stdout, stderr, err := kubeapi.ExecToPodThroughAPI(p.restConfig, p.kubeclientset, reloadCMD,
+	stdout, stderr, err := kubeapi.ExecToPodThroughAPI(context.TODO(), p.restConfig, p.kubeclientset, reloadCMD,
 		dbContainerName, podName, p.namespace, nil)
 	if err != nil {
 		return err
@@ -211,7 +212,7 @@ func (p *patroniClient) reload(podName string) error {
 // cluster.
 func (p *patroniClient) restart(podName string) error {
 
-	stdout, stderr, err := kubeapi.ExecToPodThroughAPI(p.restConfig, p.kubeclientset, restartCMD,
+	stdout, stderr, err := kubeapi.ExecToPodThroughAPI(context.TODO(), p.restConfig, p.kubeclientset, restartCMD,
 		dbContainerName, podName, p.namespace, nil)
 	if err != nil {
 		return err
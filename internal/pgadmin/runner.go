@@ -16,6 +16,7 @@ package pgadmin
 */
 
 import (
+	"context"
 	"fmt"
 	"strings"
 	"time"
@@ -87,7 +88,7 @@ func (qr *queryRunner) EnsureReady() error {
 	}
 
 	// short-fuse test, otherwise minimum wait is tick time
-	stdout, _, err := kubeapi.ExecToPodThroughAPI(qr.apicfg, qr.clientset,
+	stdout, _, err := kubeapi.ExecToPodThroughAPI(context.TODO(), qr.apicfg, qr.clientset,
 		cmd, qr.Pod.Spec.Containers[0].Name, qr.Pod.Name, qr.Namespace, nil)
 	if len(strings.TrimSpace(stdout)) > 0 && err == nil {
 		return nil
@@ -98,7 +99,7 @@ func (qr *queryRunner) EnsureReady() error {
 	// Extended retries compared to "normal" queries
 	for i := 0; i < maxRetries; i++ {
 		// exec into the pod to run the query
-		stdout, stderr, err := kubeapi.ExecToPodThroughAPI(qr.apicfg, qr.clientset,
+		stdout, stderr, err := kubeapi.ExecToPodThroughAPI(context.TODO(), qr.apicfg, qr.clientset,
 			cmd, qr.Pod.Spec.Containers[0].Name, qr.Pod.Name, qr.Namespace, nil)
 
 		if err != nil && !strings.Contains(stderr, "no such table") {
@@ -138,7 +139,7 @@ func (qr *queryRunner) Exec(query string) error {
 	var lastError error
 	for i := 0; i < maxRetries; i++ {
 		// exec into the pod to run the query
-		_, stderr, err := kubeapi.ExecToPodThroughAPI(qr.apicfg, qr.clientset,
+		_, stderr, err := kubeapi.ExecToPodThroughAPI(context.TODO(), qr.apicfg, qr.clientset,
 			cmd, qr.Pod.Spec.Containers[0].Name, qr.Pod.Name, qr.Namespace, nil)
 		if err != nil {
 			lastError = fmt.Errorf("%v - %v", err, stderr)
@@ -175,7 +176,7 @@ func (qr *queryRunner) Query(query string) (string, error) {
 	var lastError error
 	for i := 0; i < maxRetries; i++ {
 		// exec into the pod to run the query
-		stdout, stderr, err := kubeapi.ExecToPodThroughAPI(qr.apicfg, qr.clientset,
+		stdout, stderr, err := kubeapi.ExecToPodThroughAPI(context.TODO(), qr.apicfg, qr.clientset,
 			cmd, qr.Pod.Spec.Containers[0].Name, qr.Pod.Name, qr.Namespace, nil)
 		if err != nil {
 			lastError = fmt.Errorf("%v - %v", err, stderr)
@@ -0,0 +1,121 @@
+package pgbackrest
+
+/*
+ Copyright 2020 Crunchy Data Solutions, Inc.
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// InfoResult is one stanza of the output of "pgbackrest info --output=json"
+type InfoResult struct {
+	Name     string        `json:"name"`
+	Status   InfoStatus    `json:"status"`
+	Backups  []InfoBackup  `json:"backup"`
+	Archives []InfoArchive `json:"archive"`
+}
+
+// InfoStatus reports whether a stanza is healthy. A Code of zero means "ok".
+type InfoStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// InfoBackup is a backup set of a stanza
+type InfoBackup struct {
+	// Label identifies the backup, e.g. "20200601-120000F"
+	Label string `json:"label"`
+	// Type is one of "full", "diff", or "incr"
+	Type string `json:"type"`
+	// Prior is the label of the backup that this one depends on, if any
+	Prior string `json:"prior"`
+
+	Timestamp InfoTimestamp  `json:"timestamp"`
+	Archive   InfoWALRange   `json:"archive"`
+	Info      InfoBackupSize `json:"info"`
+}
+
+// InfoTimestamp is when a backup started and stopped, in seconds since the
+// Unix epoch
+type InfoTimestamp struct {
+	Start int64 `json:"start"`
+	Stop  int64 `json:"stop"`
+}
+
+// InfoWALRange is the first and last WAL segment of a range
+type InfoWALRange struct {
+	Start string `json:"start"`
+	Stop  string `json:"stop"`
+}
+
+// InfoBackupSize is the size of a backup, in bytes. Size is the size of the
+// database, and Delta is the amount that was copied by this backup. Repository
+// holds the same measures as stored, i.e. after compression.
+type InfoBackupSize struct {
+	Size       int64 `json:"size"`
+	Delta      int64 `json:"delta"`
+	Repository struct {
+		Size  int64 `json:"size"`
+		Delta int64 `json:"delta"`
+	} `json:"repository"`
+}
+
+// InfoArchive is the range of WAL archived for a version of the database
+type InfoArchive struct {
+	ID  string `json:"id"`
+	Min string `json:"min"`
+	Max string `json:"max"`
+}
+
+// ParseInfo parses the output of "pgbackrest info --output=json"
+func ParseInfo(output []byte) ([]InfoResult, error) {
+	var results []InfoResult
+	if err := json.Unmarshal(output, &results); err != nil {
+		return nil, fmt.Errorf("unable to parse pgbackrest info: %w", err)
+	}
+	return results, nil
+}
+
+// StartTime returns the time the backup started
+func (b InfoBackup) StartTime() time.Time { return time.Unix(b.Timestamp.Start, 0).UTC() }
+
+// StopTime returns the time the backup completed
+func (b InfoBackup) StopTime() time.Time { return time.Unix(b.Timestamp.Stop, 0).UTC() }
+
+// LatestBackup returns the most recently completed backup of the stanza, and
+// false when the stanza has no backups.
+func (r InfoResult) LatestBackup() (InfoBackup, bool) {
+	var latest InfoBackup
+	for _, backup := range r.Backups {
+		if backup.Timestamp.Stop >= latest.Timestamp.Stop {
+			latest = backup
+		}
+	}
+	return latest, len(r.Backups) > 0
+}
+
+// Backup returns the backup set of the stanza with label, and false when there
+// is no such backup. This is the one backup reported by "pgbackrest info
+// --set=<label>".
+func (r InfoResult) Backup(label string) (InfoBackup, bool) {
+	for _, backup := range r.Backups {
+		if backup.Label == label {
+			return backup, true
+		}
+	}
+	return InfoBackup{}, false
+}
@@ -0,0 +1,150 @@
+package pgbackrest
+
+/*
+ Copyright 2020 Crunchy Data Solutions, Inc.
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+import (
+	"testing"
+	"time"
+)
+
+const sampleInfo = `[
+  {
+    "archive": [
+      {
+        "database": {"id": 1, "repo-key": 1},
+        "id": "12-1",
+        "max": "000000010000000000000009",
+        "min": "000000010000000000000002"
+      }
+    ],
+    "backup": [
+      {
+        "archive": {"start": "000000010000000000000002", "stop": "000000010000000000000002"},
+        "backrest": {"format": 5, "version": "2.25"},
+        "database": {"id": 1, "repo-key": 1},
+        "info": {"delta": 31395012, "repository": {"delta": 3875519, "size": 3875519}, "size": 31395012},
+        "label": "20200601-120000F",
+        "prior": null,
+        "reference": null,
+        "timestamp": {"start": 1591012800, "stop": 1591012830},
+        "type": "full"
+      },
+      {
+        "archive": {"start": "000000010000000000000008", "stop": "000000010000000000000008"},
+        "backrest": {"format": 5, "version": "2.25"},
+        "database": {"id": 1, "repo-key": 1},
+        "info": {"delta": 8462, "repository": {"delta": 1024, "size": 3876543}, "size": 31403474},
+        "label": "20200601-120000F_20200602-120000I",
+        "prior": "20200601-120000F",
+        "reference": ["20200601-120000F"],
+        "timestamp": {"start": 1591099200, "stop": 1591099205},
+        "type": "incr"
+      }
+    ],
+    "cipher": "none",
+    "db": [{"id": 1, "repo-key": 1, "system-id": 6833224468296769615, "version": "12"}],
+    "name": "db",
+    "status": {"code": 0, "message": "ok"}
+  }
+]`
+
+func TestParseInfo(t *testing.T) {
+	results, err := ParseInfo([]byte(sampleInfo))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(results) != 1 {
+		t.Fatalf("expected one stanza, got %v", results)
+	}
+
+	stanza := results[0]
+	if stanza.Name != "db" || stanza.Status.Code != 0 || stanza.Status.Message != "ok" {
+		t.Errorf("expected a healthy stanza named db, got %+v", stanza)
+	}
+
+	if len(stanza.Archives) != 1 {
+		t.Fatalf("expected one archive, got %v", stanza.Archives)
+	}
+	if archive := stanza.Archives[0]; archive.ID != "12-1" ||
+		archive.Min != "000000010000000000000002" || archive.Max != "000000010000000000000009" {
+		t.Errorf("unexpected archive range %+v", archive)
+	}
+
+	if len(stanza.Backups) != 2 {
+		t.Fatalf("expected two backups, got %v", stanza.Backups)
+	}
+
+	full := stanza.Backups[0]
+	if full.Label != "20200601-120000F" || full.Type != "full" || full.Prior != "" {
+		t.Errorf("unexpected full backup %+v", full)
+	}
+	if full.Info.Size != 31395012 || full.Info.Repository.Size != 3875519 {
+		t.Errorf("unexpected sizes %+v", full.Info)
+	}
+	if full.Archive.Start != "000000010000000000000002" {
+		t.Errorf("unexpected WAL range %+v", full.Archive)
+	}
+	if expected := time.Date(2020, time.June, 1, 12, 0, 0, 0, time.UTC); !full.StartTime().Equal(expected) {
+		t.Errorf("expected %v, got %v", expected, full.StartTime())
+	}
+
+	incr := stanza.Backups[1]
+	if incr.Type != "incr" || incr.Prior != "20200601-120000F" || incr.Info.Delta != 8462 {
+		t.Errorf("unexpected incremental backup %+v", incr)
+	}
+
+	latest, ok := stanza.LatestBackup()
+	if !ok || latest.Label != incr.Label {
+		t.Errorf("expected the incremental backup to be the latest, got %v", latest.Label)
+	}
+	if expected := time.Date(2020, time.June, 2, 12, 0, 5, 0, time.UTC); !latest.StopTime().Equal(expected) {
+		t.Errorf("expected %v, got %v", expected, latest.StopTime())
+	}
+}
+
+func TestParseInfoEmpty(t *testing.T) {
+	results, err := ParseInfo([]byte(`[{"archive": [], "backup": [], "name": "db",
+		"status": {"code": 2, "message": "no valid backups"}}]`))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if _, ok := results[0].LatestBackup(); ok {
+		t.Error("expected no backups")
+	}
+	if results[0].Status.Code != 2 {
+		t.Errorf("expected status code 2, got %v", results[0].Status)
+	}
+
+	if _, err := ParseInfo([]byte("stanza: db")); err == nil {
+		t.Error("expected an error")
+	}
+}
+
+func TestInfoResultBackup(t *testing.T) {
+	results, err := ParseInfo([]byte(sampleInfo))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	backup, ok := results[0].Backup("20200601-120000F")
+	if !ok || backup.Type != "full" || backup.Info.Size != 31395012 {
+		t.Errorf("expected the full backup, got %+v", backup)
+	}
+
+	if _, ok := results[0].Backup("20200603-120000F"); ok {
+		t.Error("expected no backup for an unknown label")
+	}
+}
@@ -16,6 +16,7 @@ package util
 */
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"strconv"
@@ -277,7 +278,7 @@ func SetPostgreSQLPassword(clientset *kubernetes.Clientset, restconfig *rest.Con
 	cmd := []string{"psql", "-p", port}
 
 	// exec into the pod to run the query
-	_, stderr, err := kubeapi.ExecToPodThroughAPI(restconfig, clientset,
+	_, stderr, err := kubeapi.ExecToPodThroughAPI(context.TODO(), restconfig, clientset,
 		cmd, "database", pod.Name, pod.ObjectMeta.Namespace, sql)
 
 	// if there is an error executing the command, or output in stderr,
@@ -305,7 +306,7 @@ func StopPostgreSQLInstance(clientset *kubernetes.Clientset, restconfig *rest.Co
 	cmd = append(cmd, dataDirectory)
 
 	// exec into the pod to execute the stop command
-	_, stderr, _ := kubeapi.ExecToPodThroughAPI(restconfig, clientset,
+	_, stderr, _ := kubeapi.ExecToPodThroughAPI(context.TODO(), restconfig, clientset,
 		cmd, "database", pod.Name, pod.ObjectMeta.Namespace, nil)
 
 	// if there is error output, assume this is an error and return
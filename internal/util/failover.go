@@ -16,6 +16,7 @@ package util
 */
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -179,7 +180,7 @@ func ReplicationStatus(request ReplicationStatusRequest, includePrimary bool) (R
 	pod := pods.Items[0]
 
 	// Execute the command that will retrieve the replica information from Patroni
-	commandStdOut, _, err := kubeapi.ExecToPodThroughAPI(
+	commandStdOut, _, err := kubeapi.ExecToPodThroughAPI(context.TODO(),
 		request.RESTConfig, request.Clientset, instanceInfoCommand,
 		pod.Spec.Containers[0].Name, pod.Name, request.Namespace, nil)
 
@@ -16,6 +16,7 @@ package util
 */
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -94,7 +95,7 @@ func ExecPolicy(clientset *kubernetes.Clientset, restclient *rest.RESTClient, re
 	}
 
 	// execute the command! if it fails, return the error
-	if _, stderr, err := kubeapi.ExecToPodThroughAPI(restconfig, clientset,
+	if _, stderr, err := kubeapi.ExecToPodThroughAPI(context.TODO(), restconfig, clientset,
 		command, pod.Spec.Containers[0].Name, pod.Name, namespace, stdin); err != nil || stderr != "" {
 		// log the error from the pod and stderr, but return the stderr
 		log.Error(err, stderr)
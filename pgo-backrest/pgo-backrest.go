@@ -16,22 +16,56 @@ package main
 */
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"os"
+	"os/signal"
 	"strconv"
 	"strings"
+	"syscall"
+	"time"
+	"unicode"
 
+	"github.com/crunchydata/postgres-operator/internal/config"
 	"github.com/crunchydata/postgres-operator/internal/kubeapi"
+	"github.com/crunchydata/postgres-operator/internal/pgbackrest"
+	"github.com/crunchydata/postgres-operator/internal/util"
 	crv1 "github.com/crunchydata/postgres-operator/pkg/apis/crunchydata.com/v1"
 	log "github.com/sirupsen/logrus"
+	v1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
 )
 
+// backrestCommand is the pgBackRest executable used when PGBACKREST_BIN is not
+// set. It is found on the PATH of the database container.
 const backrestCommand = "pgbackrest"
 
+const backrestArchiveGetCommand = `archive-get`
+const backrestArchivePushCommand = `archive-push`
 const backrestBackupCommand = `backup`
+const backrestCheckCommand = `check`
+const backrestExpireCommand = `expire`
 const backrestInfoCommand = `info`
+const backrestRestoreCommand = `restore`
 const backrestStanzaCreateCommand = `stanza-create`
-const containername = "database"
-const repoTypeFlagS3 = "--repo-type=s3"
+const backrestStanzaDeleteCommand = `stanza-delete`
+
+// defaultContainerName is the container of the PostgreSQL pod that commands
+// are executed in when PGBACKREST_CONTAINER_NAME is not set
+const defaultContainerName = "database"
+
+// localRepoType is the pgBackRest type of the local repository
+const localRepoType = "posix"
+
+// remoteRepoTypes are the pgBackRest repository types, other than the local
+// "posix" repository, that a command can be directed to
+var remoteRepoTypes = []string{"s3", "gcs", "azure"}
 
 func main() {
 	log.Info("pgo-backrest starts")
@@ -44,94 +78,1633 @@ func main() {
 		log.Info("debug flag set to false")
 	}
 
-	Namespace := os.Getenv("NAMESPACE")
-	log.Debugf("setting NAMESPACE to %s", Namespace)
-	if Namespace == "" {
-		log.Error("NAMESPACE env var not set")
+	// report every required variable that is missing, not just the first
+	if err := requireEnv(os.Getenv, "NAMESPACE", "COMMAND", "PODNAME|PGBACKREST_POD_SELECTOR"); err != nil {
+		log.Error(err)
 		os.Exit(2)
 	}
 
+	Namespace := os.Getenv("NAMESPACE")
+	log.Debugf("setting NAMESPACE to %s", Namespace)
+
 	COMMAND := os.Getenv("COMMAND")
 	log.Debugf("setting COMMAND to %s", COMMAND)
-	if COMMAND == "" {
-		log.Error("COMMAND env var not set")
-		os.Exit(2)
-	}
 
 	COMMAND_OPTS := os.Getenv("COMMAND_OPTS")
 	log.Debugf("setting COMMAND_OPTS to %s", COMMAND_OPTS)
 
 	PODNAME := os.Getenv("PODNAME")
 	log.Debugf("setting PODNAME to %s", PODNAME)
-	if PODNAME == "" {
-		log.Error("PODNAME env var not set")
-		os.Exit(2)
-	}
+
+	// PGBACKREST_POD_SELECTOR finds the pod when PODNAME is not set, e.g.
+	// "pg-cluster=hippo", so that the command follows the primary after a failover
+	POD_SELECTOR := os.Getenv("PGBACKREST_POD_SELECTOR")
+	log.Debugf("setting POD_SELECTOR to %s", POD_SELECTOR)
+
+	CONTAINER_NAME := containerName(os.Getenv("PGBACKREST_CONTAINER_NAME"))
+	log.Debugf("setting CONTAINER_NAME to %s", CONTAINER_NAME)
 
 	REPO_TYPE := os.Getenv("PGBACKREST_REPO_TYPE")
 	log.Debugf("setting REPO_TYPE to %s", REPO_TYPE)
 
-	// determine the setting of PGHA_PGBACKREST_LOCAL_S3_STORAGE
+	// determine the setting of PGHA_PGBACKREST_LOCAL_S3_STORAGE and its analogs
+	// for the other remote repository types, e.g. PGHA_PGBACKREST_LOCAL_GCS_STORAGE.
 	// we will discard the error and treat the value as "false" if it is not
 	// explicitly set
-	PGHA_PGBACKREST_LOCAL_S3_STORAGE, _ := strconv.ParseBool(os.Getenv("PGHA_PGBACKREST_LOCAL_S3_STORAGE"))
-	log.Debugf("setting PGHA_PGBACKREST_LOCAL_S3_STORAGE to %v", PGHA_PGBACKREST_LOCAL_S3_STORAGE)
+	localAndRepoTypes := make([]string, 0)
+	for _, repoType := range remoteRepoTypes {
+		env := "PGHA_PGBACKREST_LOCAL_" + strings.ToUpper(repoType) + "_STORAGE"
+		enabled, _ := strconv.ParseBool(os.Getenv(env))
+		log.Debugf("setting %s to %v", env, enabled)
+		if enabled {
+			localAndRepoTypes = append(localAndRepoTypes, repoType)
+		}
+	}
+
+	// the command is canceled when the pod of the Job is terminated, e.g. when
+	// the cluster is deleted, so that the exec stream is closed before the
+	// grace period ends
+	ctx, stop := notifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
+
+	// COMMAND_TIMEOUT is optional, e.g. "90m". When it is not set, the command
+	// is allowed to run for as long as it needs
+	if COMMAND_TIMEOUT := os.Getenv("COMMAND_TIMEOUT"); COMMAND_TIMEOUT != "" {
+		timeout, err := time.ParseDuration(COMMAND_TIMEOUT)
+		if err != nil || timeout <= 0 {
+			log.Errorf("invalid COMMAND_TIMEOUT %q", COMMAND_TIMEOUT)
+			os.Exit(2)
+		}
+		log.Debugf("setting COMMAND_TIMEOUT to %s", timeout)
+
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
 
-	config, clientset, err := kubeapi.NewKubeClient()
+	// PGBACKREST_REPO_INDEX directs the command at a single repository, e.g. "2",
+	// whose type is PGBACKREST_REPO_TYPE. PGBACKREST_REPOS runs the command
+	// against several repositories in turn, e.g. "1=posix,2=s3"
+	REPO_INDEX := os.Getenv("PGBACKREST_REPO_INDEX")
+	log.Debugf("setting REPO_INDEX to %s", REPO_INDEX)
+
+	REPOS := os.Getenv("PGBACKREST_REPOS")
+	log.Debugf("setting REPOS to %s", REPOS)
+
+	targets, err := repoTargets(REPO_TYPE, REPO_INDEX, REPOS, localAndRepoTypes)
+	if err != nil {
+		log.Error(err)
+		os.Exit(2)
+	}
+
+	// PGBACKREST_BACKUP_TYPE selects the type of a backup: full, diff, or incr
+	BACKUP_TYPE := os.Getenv("PGBACKREST_BACKUP_TYPE")
+	log.Debugf("setting BACKUP_TYPE to %s", BACKUP_TYPE)
+
+	// PGBACKREST_PROCESS_MAX is the number of processes a backup or restore can
+	// use to copy files in parallel
+	PROCESS_MAX, err := parseProcessMax(os.Getenv("PGBACKREST_PROCESS_MAX"))
+	if err != nil {
+		log.Error(err)
+		os.Exit(2)
+	}
+	log.Debugf("setting PROCESS_MAX to %d", PROCESS_MAX)
+
+	// PGBACKREST_BACKUP_ANNOTATIONS attaches annotations to a backup, e.g.
+	// "user=admin,reason=upgrade", which requires pgBackRest 2.30 or later
+	BACKUP_ANNOTATIONS, err := parseBackupAnnotations(os.Getenv("PGBACKREST_BACKUP_ANNOTATIONS"))
+	if err != nil {
+		log.Error(err)
+		os.Exit(2)
+	}
+	log.Debugf("setting BACKUP_ANNOTATIONS to %v", BACKUP_ANNOTATIONS)
+
+	// PGBACKREST_STANZA_DELETE_FORCE allows a stanza to be deleted while
+	// PostgreSQL is running. We will discard the error and treat the value as
+	// "false" if it is not explicitly set
+	STANZA_DELETE_FORCE, _ := strconv.ParseBool(os.Getenv("PGBACKREST_STANZA_DELETE_FORCE"))
+	log.Debugf("setting STANZA_DELETE_FORCE to %v", STANZA_DELETE_FORCE)
+
+	// PGBACKREST_VERIFY_ARCHIVE runs a check once a stanza-create succeeds, so
+	// that the Job fails when WAL cannot be archived. We will discard the error
+	// and treat the value as "false" if it is not explicitly set
+	VERIFY_ARCHIVE, _ := strconv.ParseBool(os.Getenv("PGBACKREST_VERIFY_ARCHIVE"))
+	log.Debugf("setting VERIFY_ARCHIVE to %v", VERIFY_ARCHIVE)
+
+	// PGBACKREST_RETRY_COUNT is the number of times a backup is attempted again
+	// when the exec stream to the pod fails, e.g. when the connection is lost
+	RETRY_COUNT, err := parseRetryCount(os.Getenv("PGBACKREST_RETRY_COUNT"))
+	if err != nil {
+		log.Error(err)
+		os.Exit(2)
+	}
+	log.Debugf("setting RETRY_COUNT to %d", RETRY_COUNT)
+
+	// PGBACKREST_OUTPUT_LIMIT is the number of kilobytes of output pgo-backrest
+	// holds onto to summarize a command. The full output is always streamed to
+	// the log of this Job; zero holds onto all of it
+	OUTPUT_LIMIT, err := parseOutputLimit(os.Getenv("PGBACKREST_OUTPUT_LIMIT"))
+	if err != nil {
+		log.Error(err)
+		os.Exit(2)
+	}
+	log.Debugf("setting OUTPUT_LIMIT to %d", OUTPUT_LIMIT)
+
+	// PGBACKREST_READY_TIMEOUT is how long to wait for the container to be ready
+	// before running the command, e.g. "10m". It does not wait when this is not
+	// set or is zero
+	READY_TIMEOUT, err := parseReadyTimeout(os.Getenv("PGBACKREST_READY_TIMEOUT"))
+	if err != nil {
+		log.Error(err)
+		os.Exit(2)
+	}
+	log.Debugf("setting READY_TIMEOUT to %s", READY_TIMEOUT)
+
+	// PGBACKREST_STANZA names the stanza of every command, e.g. when the pod has
+	// the configuration of more than one stanza
+	STANZA := parseStanza(os.Getenv("PGBACKREST_STANZA"))
+	log.Debugf("setting STANZA to %s", STANZA)
+
+	// PGBACKREST_REPO1_PATH is the path of the first repository in S3, GCS, or
+	// Azure, e.g. so that clusters can share a bucket. It applies to the local
+	// repository only when PGBACKREST_REPO1_PATH_LOCAL is "true"
+	REPO1_PATH := os.Getenv("PGBACKREST_REPO1_PATH")
+	log.Debugf("setting REPO1_PATH to %s", REPO1_PATH)
+
+	REPO1_PATH_LOCAL, _ := strconv.ParseBool(os.Getenv("PGBACKREST_REPO1_PATH_LOCAL"))
+	log.Debugf("setting REPO1_PATH_LOCAL to %v", REPO1_PATH_LOCAL)
+
+	// PGBACKREST_INFO_SET limits info to one backup set, e.g. "20200601-120000F"
+	INFO_SET := os.Getenv("PGBACKREST_INFO_SET")
+	log.Debugf("setting INFO_SET to %s", INFO_SET)
+
+	BIN := os.Getenv("PGBACKREST_BIN")
+	log.Debugf("setting BIN to %s", BIN)
+
+	// the variables of tuningOptions, e.g. PGBACKREST_COMPRESS_TYPE, each set
+	// one option of pgBackRest to a value it is known to support
+	TUNING, err := parseTuningOpts(os.Getenv)
+	if err != nil {
+		log.Error(err)
+		os.Exit(2)
+	}
+	log.Debugf("setting TUNING to %v", TUNING)
+
+	// PGBACKREST_COMPRESS_LEVEL is the --compress-level of a backup, which must
+	// be within the range of PGBACKREST_COMPRESS_TYPE
+	COMPRESS_LEVEL, err := parseCompressLevel(os.Getenv("PGBACKREST_COMPRESS_LEVEL"), TUNING[compressTypeEnv])
+	if err != nil {
+		log.Error(err)
+		os.Exit(2)
+	}
+	log.Debugf("setting COMPRESS_LEVEL to %s", COMPRESS_LEVEL)
+
+	// PGBACKREST_CIPHER_TYPE is the cipher of every repository a command runs
+	// against. pgBackRest only accepts the passphrase of a repository from its
+	// environment, so the passphrase of each one must be there as well
+	CIPHER_TYPE := os.Getenv("PGBACKREST_CIPHER_TYPE")
+	if err := requireCipherPass(CIPHER_TYPE, os.Getenv, targets); err != nil {
+		log.Error(err)
+		os.Exit(2)
+	}
+	log.Debugf("setting CIPHER_TYPE to %s", CIPHER_TYPE)
+
+	// PGBACKREST_RESTORE_TARGET_TYPE, PGBACKREST_RESTORE_TARGET, and
+	// PGBACKREST_RESTORE_TARGET_ACTION are the point-in-time of a restore,
+	// e.g. "time", "2020-06-01 12:00:00+00", and "promote"
+	RESTORE_TARGET_TYPE := os.Getenv("PGBACKREST_RESTORE_TARGET_TYPE")
+	RESTORE_TARGET := os.Getenv("PGBACKREST_RESTORE_TARGET")
+	RESTORE_TARGET_ACTION := os.Getenv("PGBACKREST_RESTORE_TARGET_ACTION")
+	if err := validateRestoreTarget(RESTORE_TARGET_TYPE, RESTORE_TARGET, RESTORE_TARGET_ACTION); err != nil {
+		log.Error(err)
+		os.Exit(2)
+	}
+	log.Debugf("setting RESTORE_TARGET_TYPE to %s", RESTORE_TARGET_TYPE)
+	log.Debugf("setting RESTORE_TARGET to %s", RESTORE_TARGET)
+	log.Debugf("setting RESTORE_TARGET_ACTION to %s", RESTORE_TARGET_ACTION)
+
+	settings := commandSettings{
+		Binary:            BIN,
+		BackupType:        BACKUP_TYPE,
+		BackupAnnotations: BACKUP_ANNOTATIONS,
+		ProcessMax:        PROCESS_MAX,
+		StanzaDeleteForce: STANZA_DELETE_FORCE,
+		VerifyArchive:     VERIFY_ARCHIVE,
+		Stanza:            STANZA,
+		Repo1Path:         REPO1_PATH,
+		Repo1PathLocal:    REPO1_PATH_LOCAL,
+		InfoSet:           INFO_SET,
+		Tuning:            TUNING,
+		CompressLevel:     COMPRESS_LEVEL,
+		CipherType:        CIPHER_TYPE,
+
+		RestoreTargetType:   RESTORE_TARGET_TYPE,
+		RestoreTarget:       RESTORE_TARGET,
+		RestoreTargetAction: RESTORE_TARGET_ACTION,
+	}
+
+	commands, err := buildCommands(COMMAND, COMMAND_OPTS, settings, targets)
+	if err != nil {
+		log.Error(err)
+		os.Exit(2)
+	}
+
+	restConfig, clientset, err := kubeapi.NewKubeClient()
 	if err != nil {
 		panic(err)
 	}
 
-	bashcmd := make([]string, 1)
-	bashcmd[0] = "bash"
+	if err := requireNamespace(clientset, Namespace); err != nil {
+		log.Error(err)
+		os.Exit(2)
+	}
+
+	if PODNAME == "" {
+		if PODNAME, err = selectPrimaryPod(clientset, Namespace, POD_SELECTOR); err != nil {
+			log.Error(err)
+			os.Exit(2)
+		}
+		log.Infof("selected pod %s", PODNAME)
+	}
+
+	// the Job can start before the database is up, e.g. right after a failover,
+	// and an exec into a container that is not ready fails immediately
+	if READY_TIMEOUT > 0 {
+		if err := waitForContainer(ctx, clientset, Namespace, PODNAME, CONTAINER_NAME, READY_TIMEOUT); err != nil {
+			log.Error(err)
+			os.Exit(2)
+		}
+	}
+
+	// pgBackRest is executed directly rather than through a shell so that each
+	// option reaches it exactly as it was written. Its output is streamed to the
+	// log of this Job as it runs so that the progress of a long backup is visible.
+	// The end of stderr is kept so that a failure explains itself
+	exec := withStderr(func(cmdStrs []string, stdout, stderr io.Writer) (int, error) {
+		return kubeapi.ExecToPodThroughAPIStream(ctx, restConfig, clientset, cmdStrs, CONTAINER_NAME, PODNAME, Namespace, nil, stdout, stderr)
+	})
+
+	// only a backup is attempted again; other commands fail on the first error
+	backup := withRetries(ctx, exec, RETRY_COUNT, retryDelay)
+
+	// a stanza that already exists is what stanza-create is asked for
+	stanzaCreate := tolerateExistingStanza(exec)
+
+	exitCode, err := runCommands(commands, os.Stdout, os.Stderr, func(cmdStrs []string, stdout, stderr io.Writer) (int, error) {
+		switch {
+		case COMMAND == crv1.PgtaskBackrestBackup:
+			exitCode, err := backup(cmdStrs, stdout, stderr)
+			if err == nil {
+				reportBackup(cmdStrs, stdout, exec)
+			}
+			return exitCode, err
+
+		case COMMAND == crv1.PgtaskBackrestStanzaCreate:
+			return stanzaCreate(cmdStrs, stdout, stderr)
+
+		case COMMAND == crv1.PgtaskBackrestInfo && hasOption(cmdStrs, "--output=json"):
+			output := kubeapi.NewTailBuffer(OUTPUT_LIMIT)
+			exitCode, err := exec(cmdStrs, io.MultiWriter(stdout, output), stderr)
+			if err == nil && output.Truncated() > 0 {
+				log.Warn("not summarizing info output larger than PGBACKREST_OUTPUT_LIMIT")
+			} else if err == nil && INFO_SET != "" {
+				logInfoSet(output.String(), INFO_SET)
+			} else if err == nil {
+				logInfo(output.String())
+			}
+			return exitCode, err
+		}
+
+		return exec(cmdStrs, stdout, stderr)
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, context.DeadlineExceeded):
+			log.Errorf("command did not complete within COMMAND_TIMEOUT: %v", err)
+		case errors.Is(err, context.Canceled):
+			log.Errorf("command was canceled: %v", err)
+		default:
+			log.Error(err)
+		}
+
+		status := exitStatus(COMMAND, exitCode, err)
+		if status != 2 && status != exitCodeCanceled {
+			log.Errorf("pgbackrest exited with code %d", exitCode)
+		}
+		os.Exit(status)
+	}
+
+	log.Info("pgo-backrest ends")
+
+}
+
+// exitCodeCanceled is the exit status of pgo-backrest when its command is
+// canceled by a termination signal. It is the status of a process that is
+// terminated by SIGTERM.
+const exitCodeCanceled = 143
+
+// exitStatus returns the exit status of pgo-backrest after command failed with
+// err. It is the status of pgBackRest when it ran, so that its error code is
+// visible on the Job, and exitCodeCanceled when the command was canceled.
+// Anything else is a failure of pgo-backrest itself. A failed check or
+// stanza-create is always reported as a failure of the stanza.
+func exitStatus(command string, exitCode int, err error) int {
+	switch {
+	case errors.Is(err, context.Canceled):
+		return exitCodeCanceled
+	case exitCode > 0 && command != crv1.PgtaskBackrestCheck && command != crv1.PgtaskBackrestStanzaCreate:
+		return exitCode
+	}
+	return 2
+}
+
+// notifyContext returns a copy of parent that is canceled when one of signals
+// is received. Calling stop releases the signals and cancels the context.
+func notifyContext(parent context.Context, signals ...os.Signal) (ctx context.Context, stop func()) {
+	ctx, cancel := context.WithCancel(parent)
+
+	received := make(chan os.Signal, 1)
+	signal.Notify(received, signals...)
+
+	go func() {
+		select {
+		case sig := <-received:
+			log.Warnf("received %s, canceling the command", sig)
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	return ctx, func() {
+		signal.Stop(received)
+		cancel()
+	}
+}
+
+// requireEnv returns an error naming each of names that getenv reports as
+// empty, or nil when they are all set. A name can list alternatives separated
+// by "|", e.g. "PODNAME|PGBACKREST_POD_SELECTOR", any one of which is enough.
+func requireEnv(getenv func(string) string, names ...string) error {
+	missing := make([]string, 0)
+	for _, name := range names {
+		alternatives := strings.Split(name, "|")
+		set := false
+		for _, alternative := range alternatives {
+			set = set || getenv(alternative) != ""
+		}
+		if !set {
+			missing = append(missing, strings.Join(alternatives, " or "))
+		}
+	}
+
+	if len(missing) > 0 {
+		return fmt.Errorf("required env vars not set: %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// requireNamespace returns an error when namespace does not exist. The
+// pgo-backrest-role allows its own namespace to be read; a service account
+// with an older role cannot tell, so that is not an error.
+func requireNamespace(clientset kubernetes.Interface, namespace string) error {
+	_, err := clientset.CoreV1().Namespaces().Get(namespace, metav1.GetOptions{})
+	switch {
+	case err == nil:
+		return nil
+	case kerrors.IsNotFound(err):
+		return fmt.Errorf("namespace %q does not exist", namespace)
+	case kerrors.IsForbidden(err):
+		log.Debugf("unable to verify that namespace %q exists: %v", namespace, err)
+		return nil
+	}
+	return fmt.Errorf("unable to verify that namespace %q exists: %w", namespace, err)
+}
+
+// selectPrimaryPod returns the name of the running primary among the pods in
+// namespace that match selector. It is an error when there is not exactly one.
+func selectPrimaryPod(clientset kubernetes.Interface, namespace, selector string) (string, error) {
+	pods, err := clientset.CoreV1().Pods(namespace).List(metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return "", err
+	}
+
+	names := make([]string, 0, 1)
+	for _, pod := range pods.Items {
+		if pod.DeletionTimestamp == nil && pod.Status.Phase == v1.PodRunning &&
+			pod.Labels[config.LABEL_PGHA_ROLE] == config.LABEL_PGHA_ROLE_PRIMARY {
+			names = append(names, pod.Name)
+		}
+	}
+
+	switch len(names) {
+	case 0:
+		return "", fmt.Errorf("no running primary pod matches selector %q", selector)
+	case 1:
+		return names[0], nil
+	default:
+		return "", fmt.Errorf("%d running primary pods match selector %q: %s",
+			len(names), selector, strings.Join(names, ", "))
+	}
+}
+
+// containerName returns the name of the container to execute commands in,
+// which is value unless it is empty
+func containerName(value string) string {
+	if value == "" {
+		return defaultContainerName
+	}
+	return value
+}
+
+// readyPollInterval is how often the pod is checked while waiting for its
+// container to be ready
+var readyPollInterval = 2 * time.Second
+
+// parseReadyTimeout parses the value of PGBACKREST_READY_TIMEOUT, a duration that
+// must not be negative. It is zero, which does not wait, when value is empty.
+func parseReadyTimeout(value string) (time.Duration, error) {
+	if value == "" {
+		return 0, nil
+	}
+
+	timeout, err := time.ParseDuration(value)
+	if err != nil || timeout < 0 {
+		return 0, fmt.Errorf("invalid PGBACKREST_READY_TIMEOUT %q", value)
+	}
+
+	return timeout, nil
+}
+
+// waitForContainer blocks until the container of the pod name is ready,
+// checking right away and then every readyPollInterval. It returns an error when
+// the container is still not ready after timeout.
+func waitForContainer(ctx context.Context, clientset kubernetes.Interface, namespace, name, container string, timeout time.Duration) error {
+	deadline := time.After(timeout)
+	tick := time.NewTicker(readyPollInterval)
+	defer tick.Stop()
+
+	for {
+		pod, err := clientset.CoreV1().Pods(namespace).Get(name, metav1.GetOptions{})
+		if err == nil && containerReady(pod, container) {
+			return nil
+		}
+		if err != nil {
+			log.Debugf("unable to get pod %s: %v", name, err)
+		} else {
+			log.Debugf("waiting for container %s of pod %s to be ready", container, name)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-deadline:
+			return fmt.Errorf("container %s of pod %s was not ready within %s", container, name, timeout)
+		case <-tick.C:
+		}
+	}
+}
+
+// containerReady returns true when pod has a ready container named container
+func containerReady(pod *v1.Pod, container string) bool {
+	for _, status := range pod.Status.ContainerStatuses {
+		if status.Name == container {
+			return status.Ready
+		}
+	}
+	return false
+}
+
+// commandSettings are the options of a pgBackRest command that pgo-backrest
+// is configured with separately from COMMAND_OPTS
+type commandSettings struct {
+	// BackupType is the --type of a backup. It is not used by other commands.
+	BackupType string
+	// BackupAnnotations are the key=value pairs of an --annotation of a backup
+	BackupAnnotations []string
+	// ProcessMax is the --process-max of a backup or restore, when positive
+	ProcessMax int
+	// StanzaDeleteForce adds --force to a stanza-delete
+	StanzaDeleteForce bool
+	// Binary is the path of the pgBackRest executable, when it is not the
+	// default
+	Binary string
+	// VerifyArchive runs a check after a stanza-create
+	VerifyArchive bool
+	// Stanza is the --stanza of every command, when it is not only in the
+	// pgBackRest configuration
+	Stanza string
+	// Repo1Path is the --repo1-path of a command against the first repository
+	// when it is in S3, GCS, or Azure
+	Repo1Path string
+	// Repo1PathLocal applies Repo1Path to the local repository as well
+	Repo1PathLocal bool
+	// InfoSet is the --set of an info command, which then reports only that
+	// backup set in JSON
+	InfoSet string
+	// Tuning is the value of each of tuningOptions that is set, by the name of
+	// its environment variable
+	Tuning map[string]string
+	// CompressLevel is the --compress-level of the commands that compress,
+	// when it is not empty
+	CompressLevel string
+	// CipherType is the --repoN-cipher-type of every repository, when it is
+	// not empty
+	CipherType string
+	// RestoreTargetType, RestoreTarget, and RestoreTargetAction are the
+	// --type, --target, and --target-action of a restore, when not empty
+	RestoreTargetType   string
+	RestoreTarget       string
+	RestoreTargetAction string
+}
+
+// binary returns the pgBackRest executable that commands run
+func (s commandSettings) binary() string {
+	if s.Binary == "" {
+		return backrestCommand
+	}
+	return s.Binary
+}
+
+// repoPathOpts returns the --repo1-path option of a command against target, if
+// one is configured. Only the first repository has that path, and the path of
+// the local repository comes from the pgBackRest configuration unless
+// Repo1PathLocal is set.
+func (s commandSettings) repoPathOpts(target repoTarget) []string {
+	if s.Repo1Path == "" || target.Index > 1 {
+		return nil
+	}
+	if repoTypeFlag(target.Type) == "" && !s.Repo1PathLocal {
+		return nil
+	}
+	return []string{"--repo1-path=" + s.Repo1Path}
+}
+
+// processMaxOpts returns the --process-max option, if one is configured
+func (s commandSettings) processMaxOpts() []string {
+	if s.ProcessMax > 0 {
+		return []string{"--process-max=" + strconv.Itoa(s.ProcessMax)}
+	}
+	return nil
+}
+
+// parseProcessMax parses the value of PGBACKREST_PROCESS_MAX. A value that is
+// not a positive integer leaves the pgBackRest default in place: zero and
+// negative numbers are ignored with a warning, anything else is an error.
+func parseProcessMax(value string) (int, error) {
+	if value == "" {
+		return 0, nil
+	}
+
+	processMax, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid PGBACKREST_PROCESS_MAX %q, must be a positive integer", value)
+	}
+	if processMax <= 0 {
+		log.Warnf("ignoring PGBACKREST_PROCESS_MAX %q, must be a positive integer", value)
+		return 0, nil
+	}
+
+	return processMax, nil
+}
+
+// tuningOption is an option of pgBackRest that is set by an environment
+// variable rather than COMMAND_OPTS. Its value must be one of Values.
+type tuningOption struct {
+	Env    string
+	Flag   string
+	Values []string
+	// Commands are the commands the option applies to. It applies to every
+	// command when this is empty.
+	Commands []string
+}
+
+// tuningOptions are the options of pgBackRest that can be tuned without
+// COMMAND_OPTS, in the order they are added to a command
+var tuningOptions = []tuningOption{
+	{
+		Env:    "PGBACKREST_LOG_LEVEL_CONSOLE",
+		Flag:   "--log-level-console",
+		Values: []string{"off", "error", "warn", "info", "detail", "debug", "trace"},
+	},
+	{
+		Env:      compressTypeEnv,
+		Flag:     "--compress-type",
+		Values:   []string{"none", "bz2", "gz", "lz4", "zst"},
+		Commands: compressCommands,
+	},
+}
+
+// compressTypeEnv is the variable of the --compress-type tuning option
+const compressTypeEnv = "PGBACKREST_COMPRESS_TYPE"
+
+// compressCommands are the commands that compress what they write
+var compressCommands = []string{crv1.PgtaskBackrestBackup, crv1.PgtaskBackrestArchivePush}
+
+// defaultCompressType is the compression of pgBackRest when no type is set
+const defaultCompressType = "gz"
+
+// compressLevels are the levels of each compression type that has them
+var compressLevels = map[string]struct{ min, max int }{
+	"bz2": {1, 9},
+	"gz":  {0, 9},
+	"lz4": {0, 12},
+	"zst": {0, 22},
+}
+
+// parseCompressLevel parses the value of PGBACKREST_COMPRESS_LEVEL, an integer
+// within the range of compressType, or of the default type when compressType
+// is empty. A level cannot be set when nothing is compressed.
+func parseCompressLevel(value, compressType string) (string, error) {
+	if value == "" {
+		return "", nil
+	}
+
+	if compressType == "" {
+		compressType = defaultCompressType
+	}
+	levels, ok := compressLevels[compressType]
+	if !ok {
+		return "", fmt.Errorf("PGBACKREST_COMPRESS_LEVEL cannot be set with %s %q", compressTypeEnv, compressType)
+	}
+
+	level, err := strconv.Atoi(value)
+	if err != nil || level < levels.min || level > levels.max {
+		return "", fmt.Errorf("invalid PGBACKREST_COMPRESS_LEVEL %q, must be an integer from %d to %d for %s",
+			value, levels.min, levels.max, compressType)
+	}
+
+	return strconv.Itoa(level), nil
+}
+
+// compressLevelOpts returns the --compress-level option of command, if one is
+// configured and command compresses
+func (s commandSettings) compressLevelOpts(command string, opts []string) ([]string, error) {
+	if s.CompressLevel == "" || !util.IsStringOneOf(command, compressCommands...) {
+		return nil, nil
+	}
+	if hasOption(opts, "--compress-level") {
+		return nil, errors.New("--compress-level cannot be set by both PGBACKREST_COMPRESS_LEVEL and COMMAND_OPTS")
+	}
+	return []string{"--compress-level=" + s.CompressLevel}, nil
+}
+
+// parseTuningOpts reads the variable of each of tuningOptions using getenv. It
+// returns the values that are set by the name of their variable, and an error
+// naming the supported values when one is not.
+func parseTuningOpts(getenv func(string) string) (map[string]string, error) {
+	tuning := map[string]string{}
+
+	for _, option := range tuningOptions {
+		value := getenv(option.Env)
+		if value == "" {
+			continue
+		}
+		if !util.IsStringOneOf(value, option.Values...) {
+			return nil, fmt.Errorf("invalid %s %q, must be one of %s",
+				option.Env, value, strings.Join(option.Values, ", "))
+		}
+		tuning[option.Env] = value
+	}
+
+	return tuning, nil
+}
+
+// tuningOpts returns the options of Tuning that apply to command. An option
+// cannot also be set in opts.
+func (s commandSettings) tuningOpts(command string, opts []string) ([]string, error) {
+	flags := []string{}
+
+	for _, option := range tuningOptions {
+		value, ok := s.Tuning[option.Env]
+		if !ok || (len(option.Commands) > 0 && !util.IsStringOneOf(command, option.Commands...)) {
+			continue
+		}
+		if hasOption(opts, option.Flag) {
+			return nil, fmt.Errorf("%s cannot be set by both %s and COMMAND_OPTS", option.Flag, option.Env)
+		}
+		flags = append(flags, option.Flag+"="+value)
+	}
+
+	return flags, nil
+}
+
+// annotationOpts returns an --annotation option for each of BackupAnnotations
+func (s commandSettings) annotationOpts() []string {
+	opts := make([]string, 0, len(s.BackupAnnotations))
+	for _, annotation := range s.BackupAnnotations {
+		opts = append(opts, "--annotation="+annotation)
+	}
+	return opts
+}
+
+// parseBackupAnnotations parses the value of PGBACKREST_BACKUP_ANNOTATIONS, a
+// comma-separated list of key=value pairs, and returns the pairs in order. A
+// key cannot be empty, contain whitespace, or appear more than once, and a
+// value cannot be empty.
+func parseBackupAnnotations(value string) ([]string, error) {
+	if strings.TrimSpace(value) == "" {
+		return nil, nil
+	}
+
+	annotations := []string{}
+	keys := map[string]bool{}
+
+	for _, pair := range strings.Split(value, ",") {
+		parts := strings.SplitN(strings.TrimSpace(pair), "=", 2)
+		if len(parts) != 2 || parts[0] == "" || strings.TrimSpace(parts[1]) == "" ||
+			strings.IndexFunc(parts[0], unicode.IsSpace) >= 0 {
+			return nil, fmt.Errorf("invalid PGBACKREST_BACKUP_ANNOTATIONS %q, must be comma-separated key=value pairs", value)
+		}
+		if keys[parts[0]] {
+			return nil, fmt.Errorf("invalid PGBACKREST_BACKUP_ANNOTATIONS %q, key %q is repeated", value, parts[0])
+		}
+		keys[parts[0]] = true
+		annotations = append(annotations, parts[0]+"="+strings.TrimSpace(parts[1]))
+	}
+
+	return annotations, nil
+}
+
+// cipherTypes are the values of PGBACKREST_CIPHER_TYPE
+var cipherTypes = []string{"none", "aes-256-cbc"}
+
+// repoNumber returns the N of the repoN options of target. The one repository
+// of a configuration that predates multiple repositories is the first.
+func repoNumber(target repoTarget) int {
+	if target.Index == 0 {
+		return 1
+	}
+	return target.Index
+}
+
+// cipherPassEnv returns the variable pgBackRest reads the passphrase of the
+// repository number from
+func cipherPassEnv(number int) string {
+	return fmt.Sprintf("PGBACKREST_REPO%d_CIPHER_PASS", number)
+}
+
+// requireCipherPass returns an error when cipherType is not one that pgBackRest
+// supports, or when it encrypts and the passphrase of one of targets is not
+// set. getenv looks up the variables.
+func requireCipherPass(cipherType string, getenv func(string) string, targets []repoTarget) error {
+	if cipherType == "" {
+		return nil
+	}
+	if !util.IsStringOneOf(cipherType, cipherTypes...) {
+		return fmt.Errorf("invalid PGBACKREST_CIPHER_TYPE %q, must be one of %s",
+			cipherType, strings.Join(cipherTypes, ", "))
+	}
+	if cipherType == "none" {
+		return nil
+	}
+
+	if len(targets) == 0 {
+		targets = []repoTarget{{}}
+	}
+
+	names := []string{}
+	for _, target := range targets {
+		names = append(names, cipherPassEnv(repoNumber(target)))
+	}
+	return requireEnv(getenv, names...)
+}
+
+// cipherOpts returns the --repoN-cipher-type option of target, if a cipher is
+// configured. It cannot also be set in opts.
+func (s commandSettings) cipherOpts(target repoTarget, opts []string) ([]string, error) {
+	if s.CipherType == "" {
+		return nil, nil
+	}
+
+	flag := fmt.Sprintf("--repo%d-cipher-type", repoNumber(target))
+	if hasOption(opts, flag) {
+		return nil, fmt.Errorf("%s cannot be set by both PGBACKREST_CIPHER_TYPE and COMMAND_OPTS", flag)
+	}
+	return []string{flag + "=" + s.CipherType}, nil
+}
+
+var (
+	// restoreTargetTypes are the types of a restore that recover to a target
+	restoreTargetTypes = []string{"lsn", "name", "time", "xid"}
+	// restoreTypes are all of the types of a restore that pgBackRest supports
+	restoreTypes = append([]string{"default", "immediate", "none", "preserve", "standby"}, restoreTargetTypes...)
+	// restoreTargetActions are what PostgreSQL does once it reaches the target
+	restoreTargetActions = []string{"pause", "promote", "shutdown"}
+)
+
+// validateRestoreTarget checks that the point-in-time of a restore is one that
+// pgBackRest supports: a target is required by the types in restoreTargetTypes
+// and not allowed by the others, and an action needs a type that stops
+// recovery early.
+func validateRestoreTarget(targetType, target, action string) error {
+	if targetType == "" {
+		if target != "" || action != "" {
+			return errors.New("PGBACKREST_RESTORE_TARGET_TYPE is required with a target or target action")
+		}
+		return nil
+	}
+
+	if !util.IsStringOneOf(targetType, restoreTypes...) {
+		return fmt.Errorf("invalid PGBACKREST_RESTORE_TARGET_TYPE %q, must be one of %s",
+			targetType, strings.Join(restoreTypes, ", "))
+	}
+
+	needsTarget := util.IsStringOneOf(targetType, restoreTargetTypes...)
+	if needsTarget && target == "" {
+		return fmt.Errorf("PGBACKREST_RESTORE_TARGET is required with type %q", targetType)
+	}
+	if !needsTarget && target != "" {
+		return fmt.Errorf("PGBACKREST_RESTORE_TARGET cannot be set with type %q", targetType)
+	}
+
+	if action != "" {
+		if !needsTarget && targetType != "immediate" {
+			return fmt.Errorf("PGBACKREST_RESTORE_TARGET_ACTION cannot be set with type %q", targetType)
+		}
+		if !util.IsStringOneOf(action, restoreTargetActions...) {
+			return fmt.Errorf("invalid PGBACKREST_RESTORE_TARGET_ACTION %q, must be one of %s",
+				action, strings.Join(restoreTargetActions, ", "))
+		}
+	}
+
+	return nil
+}
+
+// restoreTargetOpts returns the --type, --target, and --target-action options
+// of a restore, if a point-in-time is configured. None of them can also be set
+// in opts.
+func (s commandSettings) restoreTargetOpts(opts []string) ([]string, error) {
+	if s.RestoreTargetType == "" {
+		return nil, nil
+	}
+
+	for _, flag := range []string{"--type", "--target", "--target-action"} {
+		if hasOption(opts, flag) {
+			return nil, fmt.Errorf("restore %s cannot be set by both PGBACKREST_RESTORE_TARGET_TYPE and COMMAND_OPTS", flag)
+		}
+	}
+
+	targetOpts := []string{"--type=" + s.RestoreTargetType}
+	if s.RestoreTarget != "" {
+		targetOpts = append(targetOpts, "--target="+s.RestoreTarget)
+	}
+	if s.RestoreTargetAction != "" {
+		targetOpts = append(targetOpts, "--target-action="+s.RestoreTargetAction)
+	}
+	return targetOpts, nil
+}
+
+// defaultOutputLimit is the number of bytes of output held onto when
+// PGBACKREST_OUTPUT_LIMIT is not set
+const defaultOutputLimit = 1024 * 1024
+
+// parseOutputLimit parses the value of PGBACKREST_OUTPUT_LIMIT, a number of
+// kilobytes that must be zero or a positive integer, and returns it in bytes.
+// Zero is no limit.
+func parseOutputLimit(value string) (int, error) {
+	if value == "" {
+		return defaultOutputLimit, nil
+	}
+
+	limit, err := strconv.Atoi(value)
+	if err != nil || limit < 0 {
+		return 0, fmt.Errorf("invalid PGBACKREST_OUTPUT_LIMIT %q, must be zero or a positive integer", value)
+	}
+
+	return limit * 1024, nil
+}
+
+// buildCommands assembles a pgBackRest command line for COMMAND for each of
+// targets, in order.
+func buildCommands(command, commandOpts string, settings commandSettings, targets []repoTarget) ([][]string, error) {
 	cmdStrs := make([]string, 0)
 
-	switch COMMAND {
+	opts, err := splitCommandOpts(commandOpts)
+	if err != nil {
+		return nil, err
+	}
+
+	switch command {
 	case crv1.PgtaskBackrestStanzaCreate:
 		log.Info("backrest stanza-create command requested")
-		cmdStrs = append(cmdStrs, backrestCommand)
+		cmdStrs = append(cmdStrs, settings.binary())
 		cmdStrs = append(cmdStrs, backrestStanzaCreateCommand)
-		cmdStrs = append(cmdStrs, COMMAND_OPTS)
+		cmdStrs = append(cmdStrs, opts...)
+	case crv1.PgtaskBackrestStanzaDelete:
+		log.Info("backrest stanza-delete command requested")
+		cmdStrs = append(cmdStrs, settings.binary())
+		cmdStrs = append(cmdStrs, backrestStanzaDeleteCommand)
+		cmdStrs = append(cmdStrs, opts...)
+		// deleting a stanza while PostgreSQL is running must be asked for explicitly
+		if settings.StanzaDeleteForce {
+			log.Warn("backrest stanza-delete will be forced")
+			cmdStrs = append(cmdStrs, "--force")
+		}
+	case crv1.PgtaskBackrestArchivePush:
+		log.Info("backrest archive-push command requested")
+		if err := validateArchiveOpts(command, opts, 1); err != nil {
+			return nil, err
+		}
+		cmdStrs = append(cmdStrs, settings.binary())
+		cmdStrs = append(cmdStrs, backrestArchivePushCommand)
+		cmdStrs = append(cmdStrs, opts...)
+	case crv1.PgtaskBackrestArchiveGet:
+		log.Info("backrest archive-get command requested")
+		if err := validateArchiveOpts(command, opts, 2); err != nil {
+			return nil, err
+		}
+		cmdStrs = append(cmdStrs, settings.binary())
+		cmdStrs = append(cmdStrs, backrestArchiveGetCommand)
+		cmdStrs = append(cmdStrs, opts...)
 	case crv1.PgtaskBackrestInfo:
 		log.Info("backrest info command requested")
-		cmdStrs = append(cmdStrs, backrestCommand)
+		cmdStrs = append(cmdStrs, settings.binary())
 		cmdStrs = append(cmdStrs, backrestInfoCommand)
-		cmdStrs = append(cmdStrs, COMMAND_OPTS)
+		cmdStrs = append(cmdStrs, opts...)
+		setOpts, err := infoSetOpts(settings.InfoSet, opts)
+		if err != nil {
+			return nil, err
+		}
+		// the output is parsed, so ask for JSON unless another format was chosen
+		if !hasOption(opts, "--output") {
+			cmdStrs = append(cmdStrs, "--output=json")
+		}
+		cmdStrs = append(cmdStrs, setOpts...)
 	case crv1.PgtaskBackrestBackup:
 		log.Info("backrest backup command requested")
-		cmdStrs = append(cmdStrs, backrestCommand)
+		typeOpts, err := backupTypeOpts(settings.BackupType, opts)
+		if err != nil {
+			return nil, err
+		}
+		cmdStrs = append(cmdStrs, settings.binary())
 		cmdStrs = append(cmdStrs, backrestBackupCommand)
-		cmdStrs = append(cmdStrs, COMMAND_OPTS)
+		cmdStrs = append(cmdStrs, opts...)
+		cmdStrs = append(cmdStrs, typeOpts...)
+		cmdStrs = append(cmdStrs, settings.processMaxOpts()...)
+		cmdStrs = append(cmdStrs, settings.annotationOpts()...)
+	case crv1.PgtaskBackrestCheck:
+		log.Info("backrest check command requested")
+		cmdStrs = append(cmdStrs, settings.binary())
+		cmdStrs = append(cmdStrs, backrestCheckCommand)
+		cmdStrs = append(cmdStrs, opts...)
+	case crv1.PgtaskBackrestExpire:
+		log.Info("backrest expire command requested")
+		cmdStrs = append(cmdStrs, settings.binary())
+		cmdStrs = append(cmdStrs, backrestExpireCommand)
+		cmdStrs = append(cmdStrs, opts...)
+	case crv1.PgtaskBackrestRestore:
+		log.Info("backrest restore command requested")
+		if err := validateRestoreOpts(opts, settings); err != nil {
+			return nil, err
+		}
+		targetOpts, err := settings.restoreTargetOpts(opts)
+		if err != nil {
+			return nil, err
+		}
+		cmdStrs = append(cmdStrs, settings.binary())
+		cmdStrs = append(cmdStrs, backrestRestoreCommand)
+		cmdStrs = append(cmdStrs, opts...)
+		cmdStrs = append(cmdStrs, targetOpts...)
+		cmdStrs = append(cmdStrs, settings.processMaxOpts()...)
 	default:
-		log.Error("unsupported backup command specified " + COMMAND)
-		os.Exit(2)
+		return nil, fmt.Errorf("unsupported backup command specified %s", command)
 	}
 
-	if PGHA_PGBACKREST_LOCAL_S3_STORAGE {
-		firstCmd := cmdStrs
-		cmdStrs = append(cmdStrs, "&&")
-		cmdStrs = append(cmdStrs, strings.Join(firstCmd, " "))
-		cmdStrs = append(cmdStrs, repoTypeFlagS3)
-		log.Info("backrest command will be executed for both local and s3 storage")
-	} else if REPO_TYPE == "s3" {
-		cmdStrs = append(cmdStrs, repoTypeFlagS3)
-		log.Info("s3 flag enabled for backrest command")
+	stanza, err := stanzaOpt(settings.Stanza, opts)
+	if err != nil {
+		return nil, err
 	}
+	cmdStrs = append(cmdStrs, stanza...)
 
-	log.Infof("command to execute is [%s]", strings.Join(cmdStrs, " "))
+	tuning, err := settings.tuningOpts(command, opts)
+	if err != nil {
+		return nil, err
+	}
+	cmdStrs = append(cmdStrs, tuning...)
 
-	log.Infof("command is %s ", strings.Join(cmdStrs, " "))
-	reader := strings.NewReader(strings.Join(cmdStrs, " "))
-	output, stderr, err := kubeapi.ExecToPodThroughAPI(config, clientset, bashcmd, containername, PODNAME, Namespace, reader)
+	level, err := settings.compressLevelOpts(command, opts)
 	if err != nil {
-		log.Info("output=[" + output + "]")
-		log.Info("stderr=[" + stderr + "]")
-		log.Error(err)
-		os.Exit(2)
+		return nil, err
 	}
-	log.Info("output=[" + output + "]")
-	log.Info("stderr=[" + stderr + "]")
+	cmdStrs = append(cmdStrs, level...)
 
-	log.Info("pgo-backrest ends")
+	if settings.Repo1Path != "" && hasOption(opts, "--repo1-path") {
+		return nil, errors.New("--repo1-path cannot be set by both PGBACKREST_REPO1_PATH and COMMAND_OPTS")
+	}
+
+	if len(targets) == 0 {
+		targets = []repoTarget{{}}
+	}
+
+	commands := make([][]string, 0, len(targets))
+	for _, target := range targets {
+		flags, err := target.flags()
+		if err != nil {
+			return nil, err
+		}
+		flags = append(flags, settings.repoPathOpts(target)...)
+
+		cipher, err := settings.cipherOpts(target, opts)
+		if err != nil {
+			return nil, err
+		}
+		flags = append(flags, cipher...)
+		commands = append(commands, append(append([]string{}, cmdStrs...), flags...))
+	}
+
+	if len(targets) > 1 {
+		log.Infof("backrest command will be executed for %d repositories", len(targets))
+	}
+
+	// archiving is verified only once every stanza-create has succeeded
+	if command == crv1.PgtaskBackrestStanzaCreate && settings.VerifyArchive {
+		log.Info("backrest check will verify archiving after stanza-create")
+		for _, cmdStrs := range commands[:len(targets)] {
+			commands = append(commands, verifyArchiveCommand(cmdStrs))
+		}
+	}
+
+	return commands, nil
+}
+
+// splitCommandOpts splits COMMAND_OPTS into separate arguments the way a shell
+// would split words, without interpreting anything else. Whitespace inside
+// single or double quotes is kept, and a backslash escapes the character after
+// it, except inside single quotes. Characters such as ";" and "$" are literal.
+func splitCommandOpts(commandOpts string) ([]string, error) {
+	args := make([]string, 0)
+
+	var arg strings.Builder
+	inArg, escaped := false, false
+	var quote rune
+
+	for _, r := range commandOpts {
+		switch {
+		case escaped:
+			arg.WriteRune(r)
+			escaped = false
+		case quote == '\'':
+			if r == '\'' {
+				quote = 0
+			} else {
+				arg.WriteRune(r)
+			}
+		case r == '\\':
+			escaped, inArg = true, true
+		case quote == '"':
+			if r == '"' {
+				quote = 0
+			} else {
+				arg.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote, inArg = r, true
+		case unicode.IsSpace(r):
+			if inArg {
+				args = append(args, arg.String())
+				arg.Reset()
+				inArg = false
+			}
+		default:
+			arg.WriteRune(r)
+			inArg = true
+		}
+	}
+
+	if quote != 0 {
+		return nil, fmt.Errorf("COMMAND_OPTS has an unterminated %c quote", quote)
+	}
+	if escaped {
+		return nil, errors.New("COMMAND_OPTS ends with an incomplete escape")
+	}
+	if inArg {
+		args = append(args, arg.String())
+	}
+
+	return args, nil
+}
+
+// hasOption returns true when args contain the option name, either on its own
+// or followed by "=" and a value
+func hasOption(args []string, name string) bool {
+	for _, arg := range args {
+		if arg == name || strings.HasPrefix(arg, name+"=") {
+			return true
+		}
+	}
+	return false
+}
+
+// logInfo logs a summary of each stanza in the JSON output of pgBackRest info
+func logInfo(output string) {
+	results, err := pgbackrest.ParseInfo([]byte(output))
+	if err != nil {
+		log.Warn(err)
+		return
+	}
+
+	for _, stanza := range results {
+		log.Infof("stanza %s status: %d (%s), backups: %d",
+			stanza.Name, stanza.Status.Code, stanza.Status.Message, len(stanza.Backups))
+
+		if latest, ok := stanza.LatestBackup(); ok {
+			log.Infof("stanza %s latest backup: %s (%s) completed at %s",
+				stanza.Name, latest.Label, latest.Type, latest.StopTime().Format(time.RFC3339))
+		}
+		for _, archive := range stanza.Archives {
+			log.Infof("stanza %s archive %s: %s to %s", stanza.Name, archive.ID, archive.Min, archive.Max)
+		}
+	}
+}
+
+// logInfoSet logs the details of the backup set label in the JSON output of
+// pgBackRest info --set
+func logInfoSet(output, label string) {
+	results, err := pgbackrest.ParseInfo([]byte(output))
+	if err != nil {
+		log.Warn(err)
+		return
+	}
+
+	for _, stanza := range results {
+		backup, ok := stanza.Backup(label)
+		if !ok {
+			log.Warnf("stanza %s has no backup set %s", stanza.Name, label)
+			continue
+		}
+
+		log.Infof("stanza %s backup %s (%s) ran from %s to %s, size %d, repository size %d, WAL %s to %s",
+			stanza.Name, backup.Label, backup.Type,
+			backup.StartTime().Format(time.RFC3339), backup.StopTime().Format(time.RFC3339),
+			backup.Info.Size, backup.Info.Repository.Size, backup.Archive.Start, backup.Archive.Stop)
+	}
+}
+
+// backupResultTag identifies the JSON result of a backup in the output of
+// pgo-backrest
+const backupResultTag = "pgo-backrest-backup-result"
+
+// backupResult is the outcome of a successful backup, written to stdout as a
+// single line of JSON so that it can be collected from the log of the Job
+type backupResult struct {
+	Tag             string    `json:"tag"`
+	Stanza          string    `json:"stanza"`
+	Label           string    `json:"label"`
+	Type            string    `json:"type"`
+	Size            int64     `json:"size"`
+	Delta           int64     `json:"delta"`
+	RepositorySize  int64     `json:"repositorySize"`
+	RepositoryDelta int64     `json:"repositoryDelta"`
+	Start           time.Time `json:"start"`
+	Stop            time.Time `json:"stop"`
+	DurationSeconds int64     `json:"durationSeconds"`
+}
+
+// backupInfoCommand returns the info command that describes the repository
+// and stanza of backupCmd, using the same executable. Options that only apply
+// to a backup are dropped.
+func backupInfoCommand(backupCmd []string) []string {
+	cmdStrs := []string{backupCmd[0], backrestInfoCommand}
+	cmdStrs = append(cmdStrs, stanzaOpts(backupCmd)...)
+	return append(cmdStrs, "--output=json")
+}
+
+// verifyArchiveCommand returns the check command that verifies WAL archiving to
+// the repository and stanza of stanzaCreateCmd, using the same executable
+func verifyArchiveCommand(stanzaCreateCmd []string) []string {
+	cmdStrs := []string{stanzaCreateCmd[0], backrestCheckCommand}
+	return append(cmdStrs, stanzaOpts(stanzaCreateCmd)...)
+}
+
+// stanzaOpts returns the options of cmdStrs that select a stanza and its
+// repository, which every pgBackRest command understands
+func stanzaOpts(cmdStrs []string) []string {
+	opts := []string{}
+	for _, arg := range cmdStrs[1:] {
+		if strings.HasPrefix(arg, "--stanza=") ||
+			strings.HasPrefix(arg, "--config=") ||
+			strings.HasPrefix(arg, "--repo=") ||
+			(strings.HasPrefix(arg, "--repo") && strings.Contains(arg, "-type=")) ||
+			(strings.HasPrefix(arg, "--repo") && strings.Contains(arg, "-path=")) {
+			opts = append(opts, arg)
+		}
+	}
+	return opts
+}
+
+// backupResults returns a line of JSON for the latest backup of each stanza in
+// the JSON output of pgBackRest info
+func backupResults(output []byte) ([][]byte, error) {
+	stanzas, err := pgbackrest.ParseInfo(output)
+	if err != nil {
+		return nil, err
+	}
+
+	lines := make([][]byte, 0, len(stanzas))
+	for _, stanza := range stanzas {
+		latest, ok := stanza.LatestBackup()
+		if !ok {
+			continue
+		}
+
+		line, err := json.Marshal(backupResult{
+			Tag:             backupResultTag,
+			Stanza:          stanza.Name,
+			Label:           latest.Label,
+			Type:            latest.Type,
+			Size:            latest.Info.Size,
+			Delta:           latest.Info.Delta,
+			RepositorySize:  latest.Info.Repository.Size,
+			RepositoryDelta: latest.Info.Repository.Delta,
+			Start:           latest.StartTime(),
+			Stop:            latest.StopTime(),
+			DurationSeconds: latest.Timestamp.Stop - latest.Timestamp.Start,
+		})
+		if err != nil {
+			return nil, err
+		}
+		lines = append(lines, line)
+	}
+
+	return lines, nil
+}
+
+// reportBackup writes the result of the backup made by backupCmd to stdout. The
+// backup has already succeeded, so a problem here is only a warning.
+func reportBackup(backupCmd []string, stdout io.Writer, exec execFunc) {
+	var output, stderr bytes.Buffer
+	if _, err := exec(backupInfoCommand(backupCmd), &output, &stderr); err != nil {
+		log.Warnf("unable to report the result of the backup: %v: %s", err, stderr.String())
+		return
+	}
+
+	lines, err := backupResults(output.Bytes())
+	if err != nil {
+		log.Warnf("unable to report the result of the backup: %v", err)
+		return
+	}
+	for _, line := range lines {
+		fmt.Fprintln(stdout, string(line))
+	}
+}
+
+// execFunc runs a command line in the database container, writing its output
+// to stdout and stderr as it arrives
+type execFunc func(cmdStrs []string, stdout, stderr io.Writer) (exitCode int, err error)
+
+// retryDelay is how long to wait before attempting a failed command again
+var retryDelay = 15 * time.Second
+
+// parseRetryCount parses the value of PGBACKREST_RETRY_COUNT, which must be zero
+// or a positive integer. It is zero when value is empty.
+func parseRetryCount(value string) (int, error) {
+	if value == "" {
+		return 0, nil
+	}
+
+	retries, err := strconv.Atoi(value)
+	if err != nil || retries < 0 {
+		return 0, fmt.Errorf("invalid PGBACKREST_RETRY_COUNT %q, must be zero or a positive integer", value)
+	}
+	return retries, nil
+}
+
+// backrestLockExitCode is the exit code of pgBackRest when another process
+// holds the lock of the command, e.g. "ERROR: [050]: unable to acquire lock"
+const backrestLockExitCode = 50
+
+// withRetries returns an execFunc that runs a command using exec, and runs it
+// again up to retries times, after delay, when the exec stream fails. A command
+// that runs and fails is not attempted again, and there are no retries once ctx
+// is done.
+//
+// Losing the stream does not stop the command in the pod, so an attempt that
+// follows may find that the earlier one still holds the pgBackRest lock. That
+// attempt is tried again as well, so a command never runs alongside itself.
+// A backup that completed without its stream can still be followed by another.
+func withRetries(ctx context.Context, exec execFunc, retries int, delay time.Duration) execFunc {
+	return func(cmdStrs []string, stdout, stderr io.Writer) (int, error) {
+		exitCode, err := exec(cmdStrs, stdout, stderr)
+		lostStream := false
+		for attempt := 1; attempt <= retries && ctx.Err() == nil; attempt++ {
+			switch {
+			case kubeapi.IsExecTransportError(err):
+				lostStream = true
+				log.Warnf("lost the exec stream of the command, which may still be running: %v, retrying in %s (%d of %d)",
+					err, delay, attempt, retries)
+			case lostStream && exitCode == backrestLockExitCode:
+				log.Warnf("an earlier attempt of the command still holds the pgBackRest lock, retrying in %s (%d of %d)",
+					delay, attempt, retries)
+			default:
+				return exitCode, err
+			}
+
+			select {
+			case <-ctx.Done():
+				return exitCode, err
+			case <-time.After(delay):
+			}
+
+			exitCode, err = exec(cmdStrs, stdout, stderr)
+		}
+		return exitCode, err
+	}
+}
+
+// stderrTailLimit is how many bytes at the end of stderr are kept for an error
+const stderrTailLimit = 4096
+
+// stderrTailLines is how many lines at the end of stderr are included in an
+// error
+const stderrTailLines = 5
+
+// withStderr returns an execFunc that runs a command using exec and, when it
+// fails, includes the last lines the command wrote to stderr in the error so
+// that the complaint of pgBackRest is visible without reading the whole log
+func withStderr(exec execFunc) execFunc {
+	return func(cmdStrs []string, stdout, stderr io.Writer) (int, error) {
+		tail := kubeapi.NewTailBuffer(stderrTailLimit)
+		exitCode, err := exec(cmdStrs, stdout, io.MultiWriter(stderr, tail))
+		if err != nil {
+			if lines := lastLines(string(tail.Bytes()), stderrTailLines); lines != "" {
+				err = fmt.Errorf("%w: %s", err, lines)
+			}
+		}
+		return exitCode, err
+	}
+}
+
+// stanzaExistsMessages are written to stderr by pgBackRest when stanza-create
+// finds that the stanza is already initialized
+var stanzaExistsMessages = []string{
+	"already exists and is valid",
+	"stanza already exists",
+}
+
+// tolerateExistingStanza returns an execFunc that runs a command using exec and
+// treats a stanza-create that fails because its stanza already exists as a
+// success. Any other command, and any other failure, is returned as it is.
+func tolerateExistingStanza(exec execFunc) execFunc {
+	return func(cmdStrs []string, stdout, stderr io.Writer) (int, error) {
+		tail := kubeapi.NewTailBuffer(stderrTailLimit)
+		exitCode, err := exec(cmdStrs, stdout, io.MultiWriter(stderr, tail))
+
+		if err != nil && exitCode > 0 && len(cmdStrs) > 1 && cmdStrs[1] == backrestStanzaCreateCommand {
+			for _, message := range stanzaExistsMessages {
+				if strings.Contains(tail.String(), message) {
+					log.Infof("stanza was already present, ignoring exit code %d", exitCode)
+					return 0, nil
+				}
+			}
+		}
+
+		return exitCode, err
+	}
+}
+
+// lastLines returns up to n of the last non-empty lines of output, joined by
+// "; " so they fit on one line
+func lastLines(output string, n int) string {
+	lines := make([]string, 0)
+	for _, line := range strings.Split(output, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return strings.Join(lines, "; ")
+}
+
+// runCommands runs each of commands in order using exec, passing along stdout
+// and stderr. It stops at the first command that fails and returns its exit
+// code and error.
+func runCommands(commands [][]string, stdout, stderr io.Writer, exec execFunc) (int, error) {
+	for i, cmdStrs := range commands {
+		log.Infof("command %d of %d to execute is [%s]", i+1, len(commands), strings.Join(cmdStrs, " "))
+
+		if exitCode, err := exec(cmdStrs, stdout, stderr); err != nil {
+			return exitCode, fmt.Errorf("command %d of %d failed: %w", i+1, len(commands), err)
+		}
+		log.Infof("command %d of %d completed", i+1, len(commands))
+	}
+
+	return 0, nil
+}
+
+// repoTarget is a pgBackRest repository that a command runs against. An Index
+// of zero refers to the one repository of a pgBackRest configuration that
+// predates multiple repositories, which is selected by its type alone.
+type repoTarget struct {
+	Index int
+	Type  string
+}
+
+// maxRepoIndex is the number of repositories pgBackRest can use at once
+const maxRepoIndex = 4
+
+// flags returns the options that direct pgBackRest to the repository.
+func (r repoTarget) flags() ([]string, error) {
+	if r.Index == 0 {
+		if flag := repoTypeFlag(r.Type); flag != "" {
+			return []string{flag}, nil
+		}
+		if r.Type == localRepoType {
+			return []string{"--repo-type=" + localRepoType}, nil
+		}
+		return nil, nil
+	}
+
+	if r.Index < 0 || r.Index > maxRepoIndex {
+		return nil, fmt.Errorf("repository index %d is invalid; must be between 1 and %d",
+			r.Index, maxRepoIndex)
+	}
+	if r.Type != "" && r.Type != localRepoType && repoTypeFlag(r.Type) == "" {
+		return nil, fmt.Errorf("unsupported repository type %q", r.Type)
+	}
+
+	flags := []string{fmt.Sprintf("--repo=%d", r.Index)}
+	if r.Type != "" {
+		flags = append(flags, fmt.Sprintf("--repo%d-type=%s", r.Index, r.Type))
+	}
+	return flags, nil
+}
+
+// repoTargets determines the repositories a command runs against. repos, e.g.
+// "1=posix,2=s3", takes precedence over repoIndex, which takes precedence over
+// the legacy combination of repoType and localAndRepoTypes.
+func repoTargets(repoType, repoIndex, repos string, localAndRepoTypes []string) ([]repoTarget, error) {
+	if repos != "" {
+		targets := make([]repoTarget, 0)
+		for _, segment := range strings.Split(repos, ",") {
+			pair := strings.Split(strings.TrimSpace(segment), "=")
+			index, err := strconv.Atoi(pair[0])
+			if len(pair) != 2 || err != nil || index < 1 {
+				return nil, fmt.Errorf("repository %q is not formatted as index=type", segment)
+			}
+			targets = append(targets, repoTarget{Index: index, Type: pair[1]})
+		}
+		return targets, nil
+	}
+
+	if repoIndex != "" {
+		index, err := strconv.Atoi(repoIndex)
+		if err != nil || index < 1 {
+			return nil, fmt.Errorf("repository index %q is invalid", repoIndex)
+		}
+		return []repoTarget{{Index: index, Type: repoType}}, nil
+	}
+
+	return legacyRepoTargets(repoType, localAndRepoTypes), nil
+}
+
+// legacyRepoTargets returns the repositories of a configuration that predates
+// multiple repositories. When localAndRepoTypes is not empty, the command runs
+// against the local repository and then each of those types. Otherwise, it
+// runs against the repository of repoType. The local repository is always
+// named by its type so the command does not depend on the pgBackRest default.
+func legacyRepoTargets(repoType string, localAndRepoTypes []string) []repoTarget {
+	if len(localAndRepoTypes) == 0 {
+		if repoType == "" || repoType == "local" {
+			repoType = localRepoType
+		}
+		return []repoTarget{{Type: repoType}}
+	}
+
+	targets := []repoTarget{{Type: localRepoType}}
+	for _, localAndRepoType := range localAndRepoTypes {
+		targets = append(targets, repoTarget{Type: localAndRepoType})
+	}
+	return targets
+}
+
+// repoTypeFlag returns the flag that directs pgBackRest to a remote repository
+// of repoType. Neither the local repository nor an unknown type has one.
+func repoTypeFlag(repoType string) string {
+	for _, remote := range remoteRepoTypes {
+		if repoType == remote {
+			return "--repo-type=" + repoType
+		}
+	}
+	return ""
+}
+
+// backupTypeOpts returns the option that selects backupType, if any. The type
+// must be one that pgBackRest supports and cannot also be set in opts.
+func backupTypeOpts(backupType string, opts []string) ([]string, error) {
+	switch backupType {
+	case "":
+		return nil, nil
+	case "full", "diff", "incr":
+	default:
+		return nil, fmt.Errorf("invalid PGBACKREST_BACKUP_TYPE %q, must be one of full, diff, or incr", backupType)
+	}
+
+	if hasOption(opts, "--type") {
+		return nil, errors.New("backup --type cannot be set by both PGBACKREST_BACKUP_TYPE and COMMAND_OPTS")
+	}
+
+	return []string{"--type=" + backupType}, nil
+}
+
+// parseStanza parses the value of PGBACKREST_STANZA. The Job template always
+// sets the variable, so an empty value is the same as one that is not set.
+func parseStanza(value string) string {
+	return strings.TrimSpace(value)
+}
+
+// stanzaOpt returns the --stanza option for stanza, if one is configured. A
+// stanza name cannot contain whitespace.
+func stanzaOpt(stanza string, opts []string) ([]string, error) {
+	if stanza == "" {
+		return nil, nil
+	}
+
+	if strings.IndexFunc(stanza, unicode.IsSpace) >= 0 {
+		return nil, fmt.Errorf("invalid PGBACKREST_STANZA %q, must not contain whitespace", stanza)
+	}
+	if hasOption(opts, "--stanza") {
+		return nil, errors.New("--stanza cannot be set by both PGBACKREST_STANZA and COMMAND_OPTS")
+	}
+
+	return []string{"--stanza=" + stanza}, nil
+}
+
+// infoSetOpts returns the --set option of an info command that reports only
+// the backup set label, if any. pgBackRest reports the details of a set only
+// in JSON, so no other output format can be chosen in opts.
+func infoSetOpts(label string, opts []string) ([]string, error) {
+	if label == "" {
+		return nil, nil
+	}
+	if strings.IndexFunc(label, unicode.IsSpace) >= 0 {
+		return nil, fmt.Errorf("invalid PGBACKREST_INFO_SET %q, must not contain whitespace", label)
+	}
+	if hasOption(opts, "--set") {
+		return nil, errors.New("--set cannot be set by both PGBACKREST_INFO_SET and COMMAND_OPTS")
+	}
+	if hasOption(opts, "--output") && !hasOption(opts, "--output=json") {
+		return nil, errors.New("PGBACKREST_INFO_SET requires --output=json")
+	}
+	return []string{"--set=" + label}, nil
+}
+
+// validateArchiveOpts ensures the options of an archive-push or archive-get
+// include the arguments that identify the WAL, i.e. the path of the segment to
+// push, or the name of the segment to get and the path to write it to.
+func validateArchiveOpts(command string, opts []string, args int) error {
+	count := 0
+	for _, opt := range opts {
+		if !strings.HasPrefix(opt, "--") {
+			count++
+		}
+	}
+
+	switch {
+	case len(opts) == 0:
+		return fmt.Errorf("%s requires COMMAND_OPTS, e.g. --stanza=db and the WAL segment", command)
+	case count < args:
+		return fmt.Errorf("%s requires %d WAL arguments in COMMAND_OPTS, got %d", command, args, count)
+	}
+	return nil
+}
+
+// validateRestoreOpts ensures the options of a restore are present, unless its
+// stanza or point-in-time come from settings, and that any --type and --target
+// options are consistent with one another. A --target is required by, and only
+// allowed with, the types in restoreTargetTypes.
+func validateRestoreOpts(opts []string, settings commandSettings) error {
+	if len(opts) == 0 && settings.Stanza == "" && settings.RestoreTargetType == "" {
+		return errors.New("restore requires COMMAND_OPTS or PGBACKREST_STANZA, e.g. --stanza=db")
+	}
+
+	restoreType, hasTarget := "", false
+	for _, opt := range opts {
+		switch {
+		case opt == "--type" || opt == "--type=":
+			return errors.New("restore option --type requires a value, e.g. --type=time")
+		case strings.HasPrefix(opt, "--type="):
+			restoreType = strings.TrimPrefix(opt, "--type=")
+		case opt == "--target" || opt == "--target=":
+			return errors.New("restore option --target requires a value")
+		case strings.HasPrefix(opt, "--target="):
+			hasTarget = true
+		}
+	}
+
+	if restoreType != "" && !util.IsStringOneOf(restoreType, restoreTypes...) {
+		return fmt.Errorf("restore option --type=%s is invalid, must be one of %s",
+			restoreType, strings.Join(restoreTypes, ", "))
+	}
+
+	needsTarget := util.IsStringOneOf(restoreType, restoreTargetTypes...)
+	if needsTarget && !hasTarget {
+		return fmt.Errorf("restore option --type=%s requires a --target", restoreType)
+	}
+	if !needsTarget && hasTarget {
+		return fmt.Errorf("restore option --target cannot be used with --type=%s", restoreType)
+	}
 
+	return nil
 }
@@ -0,0 +1,2076 @@
+package main
+
+/*
+ Copyright 2020 Crunchy Data Solutions, Inc.
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+	"syscall"
+	"testing"
+	"text/template"
+	"time"
+
+	"github.com/crunchydata/postgres-operator/internal/kubeapi"
+	crv1 "github.com/crunchydata/postgres-operator/pkg/apis/crunchydata.com/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	v1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// joinCommands renders commands the way a shell would run them one after the
+// other
+func joinCommands(commands [][]string) string {
+	joined := make([]string, 0, len(commands))
+	for _, command := range commands {
+		joined = append(joined, strings.Join(command, " "))
+	}
+	return strings.Join(joined, " && ")
+}
+
+func TestBuildCommandRestore(t *testing.T) {
+	for _, tt := range []struct {
+		opts, repoType string
+		localAnd       []string
+		expected       string
+	}{
+		{
+			opts:     "--stanza=db --delta",
+			expected: "pgbackrest restore --stanza=db --delta --repo-type=posix",
+		},
+		{
+			opts:     "--stanza=db --delta --type=time --target='2020-06-01 12:00:00+00'",
+			expected: "pgbackrest restore --stanza=db --delta --type=time --target=2020-06-01 12:00:00+00 --repo-type=posix",
+		},
+		{
+			opts:     "--stanza=db --type=immediate",
+			repoType: "s3",
+			expected: "pgbackrest restore --stanza=db --type=immediate --repo-type=s3",
+		},
+		{
+			opts:     "--stanza=db --type=xid --target=1234",
+			localAnd: []string{"s3"},
+			expected: "pgbackrest restore --stanza=db --type=xid --target=1234 --repo-type=posix && pgbackrest restore --stanza=db --type=xid --target=1234 --repo-type=s3",
+		},
+	} {
+		cmd, err := buildCommands(crv1.PgtaskBackrestRestore, tt.opts, commandSettings{}, legacyRepoTargets(tt.repoType, tt.localAnd))
+		if err != nil {
+			t.Fatalf("expected no error for %q, got %v", tt.opts, err)
+		}
+		if actual := joinCommands(cmd); actual != tt.expected {
+			t.Errorf("expected %q, got %q", tt.expected, actual)
+		}
+	}
+
+	for _, opts := range []string{
+		"",
+		"  ",
+		"--stanza=db --type",
+		"--stanza=db --type=",
+		"--stanza=db --type=sometime --target=1234",
+		"--stanza=db --type=time",
+		"--stanza=db --type=time --target",
+		"--stanza=db --type=immediate --target=1234",
+		"--stanza=db --target=1234",
+	} {
+		if _, err := buildCommands(crv1.PgtaskBackrestRestore, opts, commandSettings{}, legacyRepoTargets("", nil)); err == nil {
+			t.Errorf("expected an error for %q", opts)
+		}
+	}
+}
+
+func TestValidateRestoreTarget(t *testing.T) {
+	for _, tt := range []struct{ targetType, target, action string }{
+		{"", "", ""},
+		{"time", "2020-06-01 12:00:00+00", ""},
+		{"time", "2020-06-01 12:00:00+00", "promote"},
+		{"lsn", "0/3000060", "pause"},
+		{"name", "before-upgrade", "shutdown"},
+		{"xid", "1234", ""},
+		{"immediate", "", "promote"},
+		{"standby", "", ""},
+	} {
+		if err := validateRestoreTarget(tt.targetType, tt.target, tt.action); err != nil {
+			t.Errorf("expected no error for %v, got %v", tt, err)
+		}
+	}
+
+	for _, tt := range []struct{ targetType, target, action string }{
+		{"sometime", "2020-06-01 12:00:00+00", ""},
+		{"TIME", "2020-06-01 12:00:00+00", ""},
+		{"", "2020-06-01 12:00:00+00", ""},
+		{"", "", "promote"},
+		{"time", "", ""},
+		{"immediate", "1234", ""},
+		{"default", "", "promote"},
+		{"name", "before-upgrade", "resume"},
+	} {
+		if err := validateRestoreTarget(tt.targetType, tt.target, tt.action); err == nil {
+			t.Errorf("expected an error for %v", tt)
+		}
+	}
+}
+
+func TestBuildCommandRestoreTarget(t *testing.T) {
+	for _, tt := range []struct {
+		settings commandSettings
+		expected string
+	}{
+		{commandSettings{RestoreTargetType: "time", RestoreTarget: "2020-06-01 12:00:00+00", RestoreTargetAction: "promote"},
+			"pgbackrest restore --stanza=db --delta --type=time --target=2020-06-01 12:00:00+00 --target-action=promote --repo-type=posix"},
+		{commandSettings{RestoreTargetType: "lsn", RestoreTarget: "0/3000060"},
+			"pgbackrest restore --stanza=db --delta --type=lsn --target=0/3000060 --repo-type=posix"},
+		{commandSettings{RestoreTargetType: "name", RestoreTarget: "before-upgrade", RestoreTargetAction: "pause"},
+			"pgbackrest restore --stanza=db --delta --type=name --target=before-upgrade --target-action=pause --repo-type=posix"},
+		{commandSettings{RestoreTargetType: "immediate"},
+			"pgbackrest restore --stanza=db --delta --type=immediate --repo-type=posix"},
+		{commandSettings{},
+			"pgbackrest restore --stanza=db --delta --repo-type=posix"},
+	} {
+		cmd, err := buildCommands(crv1.PgtaskBackrestRestore, "--stanza=db --delta", tt.settings, legacyRepoTargets("", nil))
+		if err != nil {
+			t.Fatalf("expected no error for %v, got %v", tt.settings, err)
+		}
+		if actual := joinCommands(cmd); actual != tt.expected {
+			t.Errorf("expected %q, got %q", tt.expected, actual)
+		}
+	}
+
+	t.Run("env only", func(t *testing.T) {
+		settings := commandSettings{
+			Stanza:            "db",
+			RestoreTargetType: "time",
+			RestoreTarget:     "2020-06-01 12:00:00+00",
+		}
+		cmd, err := buildCommands(crv1.PgtaskBackrestRestore, "", settings, legacyRepoTargets("", nil))
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		expected := "pgbackrest restore --type=time --target=2020-06-01 12:00:00+00 --stanza=db --repo-type=posix"
+		if actual := joinCommands(cmd); actual != expected {
+			t.Errorf("expected %q, got %q", expected, actual)
+		}
+	})
+
+	settings := commandSettings{RestoreTargetType: "time", RestoreTarget: "2020-06-01 12:00:00+00"}
+	for _, opts := range []string{
+		"--stanza=db --type=immediate",
+		"--stanza=db --target=1234",
+		"--stanza=db --target-action=promote",
+	} {
+		if _, err := buildCommands(crv1.PgtaskBackrestRestore, opts, settings, legacyRepoTargets("", nil)); err == nil {
+			t.Errorf("expected an error when COMMAND_OPTS is %q", opts)
+		}
+	}
+}
+
+func TestBuildCommandExpire(t *testing.T) {
+	opts := "--stanza=db --repo1-retention-full=2"
+
+	t.Run("local", func(t *testing.T) {
+		cmd, err := buildCommands(crv1.PgtaskBackrestExpire, opts, commandSettings{}, legacyRepoTargets("posix", nil))
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		expected := "pgbackrest expire --stanza=db --repo1-retention-full=2 --repo-type=posix"
+		if actual := joinCommands(cmd); actual != expected {
+			t.Errorf("expected %q, got %q", expected, actual)
+		}
+	})
+
+	t.Run("local and s3", func(t *testing.T) {
+		cmd, err := buildCommands(crv1.PgtaskBackrestExpire, opts, commandSettings{}, legacyRepoTargets("", []string{"s3"}))
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		expected := "pgbackrest expire --stanza=db --repo1-retention-full=2 --repo-type=posix && " +
+			"pgbackrest expire --stanza=db --repo1-retention-full=2 --repo-type=s3"
+		if actual := joinCommands(cmd); actual != expected {
+			t.Errorf("expected %q, got %q", expected, actual)
+		}
+	})
+}
+
+func TestBuildCommandCheck(t *testing.T) {
+	for _, tt := range []struct {
+		repoType string
+		localAnd []string
+		expected string
+	}{
+		{"", nil, "pgbackrest check --stanza=db --repo-type=posix"},
+		{"s3", nil, "pgbackrest check --stanza=db --repo-type=s3"},
+		{"", []string{"s3"}, "pgbackrest check --stanza=db --repo-type=posix && pgbackrest check --stanza=db --repo-type=s3"},
+	} {
+		cmd, err := buildCommands(crv1.PgtaskBackrestCheck, "--stanza=db", commandSettings{}, legacyRepoTargets(tt.repoType, tt.localAnd))
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if actual := joinCommands(cmd); actual != tt.expected {
+			t.Errorf("expected %q, got %q", tt.expected, actual)
+		}
+	}
+}
+
+func TestBuildCommandInfo(t *testing.T) {
+	for _, tt := range []struct {
+		opts, repoType string
+		expected       string
+	}{
+		{"--stanza=db", "", "pgbackrest info --stanza=db --output=json --repo-type=posix"},
+		{"--stanza=db", "s3", "pgbackrest info --stanza=db --output=json --repo-type=s3"},
+		{"--stanza=db --output=text", "", "pgbackrest info --stanza=db --output=text --repo-type=posix"},
+	} {
+		cmd, err := buildCommands(crv1.PgtaskBackrestInfo, tt.opts, commandSettings{}, legacyRepoTargets(tt.repoType, nil))
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if actual := joinCommands(cmd); actual != tt.expected {
+			t.Errorf("expected %q, got %q", tt.expected, actual)
+		}
+	}
+}
+
+func TestBuildCommandInfoSet(t *testing.T) {
+	settings := commandSettings{InfoSet: "20200601-120000F"}
+
+	for _, tt := range []struct {
+		opts, repoType string
+		settings       commandSettings
+		expected       string
+	}{
+		{"--stanza=db", "s3", settings,
+			"pgbackrest info --stanza=db --output=json --set=20200601-120000F --repo-type=s3"},
+		{"--stanza=db --output=json", "s3", settings,
+			"pgbackrest info --stanza=db --output=json --set=20200601-120000F --repo-type=s3"},
+		{"--stanza=db", "s3", commandSettings{},
+			"pgbackrest info --stanza=db --output=json --repo-type=s3"},
+	} {
+		cmd, err := buildCommands(crv1.PgtaskBackrestInfo, tt.opts, tt.settings, legacyRepoTargets(tt.repoType, nil))
+		if err != nil {
+			t.Fatalf("expected no error for %q, got %v", tt.opts, err)
+		}
+		if actual := joinCommands(cmd); actual != tt.expected {
+			t.Errorf("expected %q, got %q", tt.expected, actual)
+		}
+	}
+
+	t.Run("other commands", func(t *testing.T) {
+		cmd, err := buildCommands(crv1.PgtaskBackrestBackup, "--stanza=db", settings, legacyRepoTargets("s3", nil))
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if expected, actual := "pgbackrest backup --stanza=db --repo-type=s3", joinCommands(cmd); actual != expected {
+			t.Errorf("expected %q, got %q", expected, actual)
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		for _, tt := range []struct {
+			opts     string
+			settings commandSettings
+		}{
+			{"--stanza=db --output=text", settings},
+			{"--stanza=db --set=20200602-120000F", settings},
+			{"--stanza=db", commandSettings{InfoSet: "20200601 120000F"}},
+		} {
+			if _, err := buildCommands(crv1.PgtaskBackrestInfo, tt.opts, tt.settings, nil); err == nil {
+				t.Errorf("expected an error for %q and %q", tt.opts, tt.settings.InfoSet)
+			}
+		}
+	})
+}
+
+func TestParseTuningOpts(t *testing.T) {
+	env := func(values map[string]string) func(string) string {
+		return func(name string) string { return values[name] }
+	}
+
+	for _, option := range tuningOptions {
+		for _, value := range option.Values {
+			tuning, err := parseTuningOpts(env(map[string]string{option.Env: value}))
+			if err != nil {
+				t.Errorf("expected no error for %s=%q, got %v", option.Env, value, err)
+			}
+			if !reflect.DeepEqual(tuning, map[string]string{option.Env: value}) {
+				t.Errorf("expected %s=%q, got %v", option.Env, value, tuning)
+			}
+		}
+
+		for _, value := range []string{"bogus", "INFO", " gz", "gz --force", "--log-level-file=trace"} {
+			if _, err := parseTuningOpts(env(map[string]string{option.Env: value})); err == nil ||
+				!strings.Contains(err.Error(), option.Env) {
+				t.Errorf("expected an error naming %s for %q, got %v", option.Env, value, err)
+			}
+		}
+	}
+
+	if tuning, err := parseTuningOpts(env(nil)); err != nil || len(tuning) != 0 {
+		t.Errorf("expected nothing when unset, got %v and %v", tuning, err)
+	}
+}
+
+func TestBuildCommandTuning(t *testing.T) {
+	settings := commandSettings{Tuning: map[string]string{
+		"PGBACKREST_LOG_LEVEL_CONSOLE": "detail",
+		"PGBACKREST_COMPRESS_TYPE":     "lz4",
+	}}
+
+	for _, tt := range []struct {
+		command, opts string
+		expected      string
+	}{
+		{crv1.PgtaskBackrestBackup, "--stanza=db",
+			"pgbackrest backup --stanza=db --log-level-console=detail --compress-type=lz4"},
+		{crv1.PgtaskBackrestArchivePush, "/pgwal/000000010000000000000001",
+			"pgbackrest archive-push /pgwal/000000010000000000000001 --log-level-console=detail --compress-type=lz4"},
+		{crv1.PgtaskBackrestExpire, "--stanza=db",
+			"pgbackrest expire --stanza=db --log-level-console=detail"},
+	} {
+		cmd, err := buildCommands(tt.command, tt.opts, settings, nil)
+		if err != nil {
+			t.Fatalf("expected no error for %s, got %v", tt.command, err)
+		}
+		if actual := joinCommands(cmd); actual != tt.expected {
+			t.Errorf("expected %q, got %q", tt.expected, actual)
+		}
+	}
+
+	t.Run("conflict", func(t *testing.T) {
+		for _, opts := range []string{"--stanza=db --log-level-console=warn", "--stanza=db --compress-type=gz"} {
+			if _, err := buildCommands(crv1.PgtaskBackrestBackup, opts, settings, nil); err == nil {
+				t.Errorf("expected an error for %q", opts)
+			}
+		}
+	})
+}
+
+func TestParseCompressLevel(t *testing.T) {
+	for _, tt := range []struct {
+		value, compressType string
+		expected            string
+	}{
+		{"", "", ""},
+		{"", "none", ""},
+		{"6", "", "6"},
+		{"0", "gz", "0"},
+		{"9", "gz", "9"},
+		{"1", "bz2", "1"},
+		{"9", "bz2", "9"},
+		{"0", "lz4", "0"},
+		{"12", "lz4", "12"},
+		{"0", "zst", "0"},
+		{"22", "zst", "22"},
+		{"03", "zst", "3"},
+	} {
+		actual, err := parseCompressLevel(tt.value, tt.compressType)
+		if err != nil {
+			t.Errorf("expected no error for %q and %q, got %v", tt.value, tt.compressType, err)
+		}
+		if actual != tt.expected {
+			t.Errorf("expected %q for %q and %q, got %q", tt.expected, tt.value, tt.compressType, actual)
+		}
+	}
+
+	for _, tt := range []struct{ value, compressType string }{
+		{"10", ""},
+		{"-1", "gz"},
+		{"10", "gz"},
+		{"0", "bz2"},
+		{"13", "lz4"},
+		{"23", "zst"},
+		{"1", "none"},
+		{"fast", "lz4"},
+		{"1.5", "zst"},
+	} {
+		if _, err := parseCompressLevel(tt.value, tt.compressType); err == nil {
+			t.Errorf("expected an error for %q and %q", tt.value, tt.compressType)
+		}
+	}
+}
+
+func TestBuildCommandCompressLevel(t *testing.T) {
+	settings := commandSettings{
+		Tuning:        map[string]string{"PGBACKREST_COMPRESS_TYPE": "zst"},
+		CompressLevel: "3",
+	}
+
+	for _, tt := range []struct {
+		command, opts string
+		expected      string
+	}{
+		{crv1.PgtaskBackrestBackup, "--stanza=db",
+			"pgbackrest backup --stanza=db --compress-type=zst --compress-level=3"},
+		{crv1.PgtaskBackrestExpire, "--stanza=db",
+			"pgbackrest expire --stanza=db"},
+	} {
+		cmd, err := buildCommands(tt.command, tt.opts, settings, nil)
+		if err != nil {
+			t.Fatalf("expected no error for %s, got %v", tt.command, err)
+		}
+		if actual := joinCommands(cmd); actual != tt.expected {
+			t.Errorf("expected %q, got %q", tt.expected, actual)
+		}
+	}
+
+	if _, err := buildCommands(crv1.PgtaskBackrestBackup, "--stanza=db --compress-level=1", settings, nil); err == nil {
+		t.Error("expected an error when COMMAND_OPTS sets the level too")
+	}
+}
+
+func TestRequireCipherPass(t *testing.T) {
+	env := func(values map[string]string) func(string) string {
+		return func(name string) string { return values[name] }
+	}
+	passphrase := env(map[string]string{"PGBACKREST_REPO1_CIPHER_PASS": "secret"})
+
+	t.Run("aes-256-cbc with passphrase", func(t *testing.T) {
+		if err := requireCipherPass("aes-256-cbc", passphrase, nil); err != nil {
+			t.Errorf("expected no error, got %v", err)
+		}
+		if err := requireCipherPass("aes-256-cbc", passphrase, legacyRepoTargets("s3", nil)); err != nil {
+			t.Errorf("expected no error, got %v", err)
+		}
+	})
+
+	t.Run("aes-256-cbc without passphrase", func(t *testing.T) {
+		err := requireCipherPass("aes-256-cbc", env(nil), nil)
+		if err == nil || !strings.Contains(err.Error(), "PGBACKREST_REPO1_CIPHER_PASS") {
+			t.Errorf("expected an error naming the passphrase, got %v", err)
+		}
+
+		targets := []repoTarget{{Index: 1, Type: "posix"}, {Index: 2, Type: "s3"}}
+		err = requireCipherPass("aes-256-cbc", passphrase, targets)
+		if err == nil || !strings.Contains(err.Error(), "PGBACKREST_REPO2_CIPHER_PASS") ||
+			strings.Contains(err.Error(), "PGBACKREST_REPO1_CIPHER_PASS") {
+			t.Errorf("expected an error naming only the second passphrase, got %v", err)
+		}
+	})
+
+	t.Run("none", func(t *testing.T) {
+		if err := requireCipherPass("none", env(nil), nil); err != nil {
+			t.Errorf("expected no error, got %v", err)
+		}
+		if err := requireCipherPass("", env(nil), nil); err != nil {
+			t.Errorf("expected no error, got %v", err)
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		if err := requireCipherPass("aes-128-cbc", passphrase, nil); err == nil {
+			t.Error("expected an error")
+		}
+	})
+}
+
+func TestBuildCommandCipherType(t *testing.T) {
+	for _, tt := range []struct {
+		cipherType string
+		targets    []repoTarget
+		expected   string
+	}{
+		{"aes-256-cbc", nil,
+			"pgbackrest backup --stanza=db --repo1-cipher-type=aes-256-cbc"},
+		{"none", legacyRepoTargets("s3", nil),
+			"pgbackrest backup --stanza=db --repo-type=s3 --repo1-cipher-type=none"},
+		{"aes-256-cbc", []repoTarget{{Index: 1, Type: "posix"}, {Index: 2, Type: "s3"}},
+			"pgbackrest backup --stanza=db --repo=1 --repo1-type=posix --repo1-cipher-type=aes-256-cbc && " +
+				"pgbackrest backup --stanza=db --repo=2 --repo2-type=s3 --repo2-cipher-type=aes-256-cbc"},
+		{"", nil, "pgbackrest backup --stanza=db"},
+	} {
+		cmd, err := buildCommands(crv1.PgtaskBackrestBackup, "--stanza=db", commandSettings{CipherType: tt.cipherType}, tt.targets)
+		if err != nil {
+			t.Fatalf("expected no error for %q, got %v", tt.cipherType, err)
+		}
+		if actual := joinCommands(cmd); actual != tt.expected {
+			t.Errorf("expected %q, got %q", tt.expected, actual)
+		}
+	}
+
+	if _, err := buildCommands(crv1.PgtaskBackrestBackup, "--stanza=db --repo1-cipher-type=none",
+		commandSettings{CipherType: "aes-256-cbc"}, nil); err == nil {
+		t.Error("expected an error when COMMAND_OPTS sets the cipher too")
+	}
+}
+
+func TestHasOption(t *testing.T) {
+	for _, tt := range []struct {
+		args     []string
+		expected bool
+	}{
+		{[]string{"--stanza=db"}, false},
+		{[]string{"--stanza=db", "--output=json"}, true},
+		{[]string{"--output", "text"}, true},
+		{[]string{"--output-format=json"}, false},
+	} {
+		if actual := hasOption(tt.args, "--output"); actual != tt.expected {
+			t.Errorf("expected %v for %q, got %v", tt.expected, tt.args, actual)
+		}
+	}
+}
+
+func TestBuildCommandBackupType(t *testing.T) {
+	for _, backupType := range []string{"full", "diff", "incr"} {
+		cmd, err := buildCommands(crv1.PgtaskBackrestBackup, "--stanza=db",
+			commandSettings{BackupType: backupType}, legacyRepoTargets("s3", nil))
+		if err != nil {
+			t.Fatalf("expected no error for %q, got %v", backupType, err)
+		}
+		expected := "pgbackrest backup --stanza=db --type=" + backupType + " --repo-type=s3"
+		if actual := joinCommands(cmd); actual != expected {
+			t.Errorf("expected %q, got %q", expected, actual)
+		}
+	}
+
+	t.Run("unset", func(t *testing.T) {
+		cmd, err := buildCommands(crv1.PgtaskBackrestBackup, "--stanza=db --type=diff", commandSettings{}, nil)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if expected, actual := "pgbackrest backup --stanza=db --type=diff", joinCommands(cmd); actual != expected {
+			t.Errorf("expected %q, got %q", expected, actual)
+		}
+	})
+
+	t.Run("other commands", func(t *testing.T) {
+		cmd, err := buildCommands(crv1.PgtaskBackrestExpire, "--stanza=db", commandSettings{BackupType: "incr"}, nil)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if expected, actual := "pgbackrest expire --stanza=db", joinCommands(cmd); actual != expected {
+			t.Errorf("expected %q, got %q", expected, actual)
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		for _, tt := range []struct{ backupType, opts string }{
+			{"differential", "--stanza=db"},
+			{"FULL", "--stanza=db"},
+			{"full", "--stanza=db --type=incr"},
+		} {
+			if _, err := buildCommands(crv1.PgtaskBackrestBackup, tt.opts,
+				commandSettings{BackupType: tt.backupType}, nil); err == nil {
+				t.Errorf("expected an error for %q and %q", tt.backupType, tt.opts)
+			}
+		}
+	})
+}
+
+func TestBuildCommandProcessMax(t *testing.T) {
+	settings := commandSettings{BackupType: "full", ProcessMax: 4}
+
+	for _, tt := range []struct {
+		command, opts string
+		expected      string
+	}{
+		{crv1.PgtaskBackrestBackup, "--stanza=db",
+			"pgbackrest backup --stanza=db --type=full --process-max=4"},
+		{crv1.PgtaskBackrestRestore, "--stanza=db --delta",
+			"pgbackrest restore --stanza=db --delta --process-max=4"},
+		{crv1.PgtaskBackrestInfo, "--stanza=db",
+			"pgbackrest info --stanza=db --output=json"},
+		{crv1.PgtaskBackrestStanzaCreate, "--stanza=db",
+			"pgbackrest stanza-create --stanza=db"},
+	} {
+		cmd, err := buildCommands(tt.command, tt.opts, settings, nil)
+		if err != nil {
+			t.Fatalf("expected no error for %q, got %v", tt.command, err)
+		}
+		if actual := joinCommands(cmd); actual != tt.expected {
+			t.Errorf("expected %q, got %q", tt.expected, actual)
+		}
+	}
+}
+
+func TestParseBackupAnnotations(t *testing.T) {
+	for _, tt := range []struct {
+		value    string
+		expected []string
+	}{
+		{"", nil},
+		{"user=admin", []string{"user=admin"}},
+		{"user=admin,reason=upgrade", []string{"user=admin", "reason=upgrade"}},
+		{" user=admin , reason=minor upgrade ", []string{"user=admin", "reason=minor upgrade"}},
+		{"ticket=a=b", []string{"ticket=a=b"}},
+	} {
+		actual, err := parseBackupAnnotations(tt.value)
+		if err != nil {
+			t.Errorf("expected no error for %q, got %v", tt.value, err)
+		}
+		if !reflect.DeepEqual(actual, tt.expected) {
+			t.Errorf("expected %q for %q, got %q", tt.expected, tt.value, actual)
+		}
+	}
+
+	for _, value := range []string{"user", "user=", "=admin", "user=admin,", "user=admin,,reason=x",
+		"the user=admin", "user=admin,user=root"} {
+		if _, err := parseBackupAnnotations(value); err == nil {
+			t.Errorf("expected an error for %q", value)
+		}
+	}
+}
+
+func TestBuildCommandBackupAnnotations(t *testing.T) {
+	settings := commandSettings{BackupAnnotations: []string{"user=admin", "reason=upgrade"}}
+
+	cmd, err := buildCommands(crv1.PgtaskBackrestBackup, "--stanza=db", settings, nil)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if expected, actual := "pgbackrest backup --stanza=db --annotation=user=admin --annotation=reason=upgrade",
+		joinCommands(cmd); actual != expected {
+		t.Errorf("expected %q, got %q", expected, actual)
+	}
+
+	// annotations only apply to a backup
+	cmd, err = buildCommands(crv1.PgtaskBackrestExpire, "--stanza=db", settings, nil)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if expected, actual := "pgbackrest expire --stanza=db", joinCommands(cmd); actual != expected {
+		t.Errorf("expected %q, got %q", expected, actual)
+	}
+}
+
+func TestParseProcessMax(t *testing.T) {
+	for _, tt := range []struct {
+		value    string
+		expected int
+	}{
+		{"", 0},
+		{"1", 1},
+		{"8", 8},
+		{"0", 0},
+		{"-2", 0},
+	} {
+		actual, err := parseProcessMax(tt.value)
+		if err != nil {
+			t.Fatalf("expected no error for %q, got %v", tt.value, err)
+		}
+		if actual != tt.expected {
+			t.Errorf("expected %d for %q, got %d", tt.expected, tt.value, actual)
+		}
+	}
+
+	for _, value := range []string{"four", "2.5", " 4"} {
+		if _, err := parseProcessMax(value); err == nil {
+			t.Errorf("expected an error for %q", value)
+		}
+	}
+}
+
+func TestBuildCommandArchive(t *testing.T) {
+	for _, tt := range []struct {
+		command, opts, repoType string
+		localAnd                []string
+		expected                string
+	}{
+		{crv1.PgtaskBackrestArchivePush, "--stanza=db pg_wal/000000010000000000000003", "", nil,
+			"pgbackrest archive-push --stanza=db pg_wal/000000010000000000000003 --repo-type=posix"},
+		{crv1.PgtaskBackrestArchivePush, "--stanza=db pg_wal/000000010000000000000003", "s3", nil,
+			"pgbackrest archive-push --stanza=db pg_wal/000000010000000000000003 --repo-type=s3"},
+		{crv1.PgtaskBackrestArchiveGet, "--stanza=db 000000010000000000000003 /tmp/wal", "", nil,
+			"pgbackrest archive-get --stanza=db 000000010000000000000003 /tmp/wal --repo-type=posix"},
+		{crv1.PgtaskBackrestArchiveGet, "--stanza=db 000000010000000000000003 /tmp/wal", "", []string{"s3"},
+			"pgbackrest archive-get --stanza=db 000000010000000000000003 /tmp/wal --repo-type=posix && " +
+				"pgbackrest archive-get --stanza=db 000000010000000000000003 /tmp/wal --repo-type=s3"},
+	} {
+		cmd, err := buildCommands(tt.command, tt.opts, commandSettings{}, legacyRepoTargets(tt.repoType, tt.localAnd))
+		if err != nil {
+			t.Fatalf("expected no error for %q, got %v", tt.opts, err)
+		}
+		if actual := joinCommands(cmd); actual != tt.expected {
+			t.Errorf("expected %q, got %q", tt.expected, actual)
+		}
+	}
+
+	for _, tt := range []struct{ command, opts string }{
+		{crv1.PgtaskBackrestArchivePush, ""},
+		{crv1.PgtaskBackrestArchivePush, "--stanza=db"},
+		{crv1.PgtaskBackrestArchiveGet, ""},
+		{crv1.PgtaskBackrestArchiveGet, "--stanza=db 000000010000000000000003"},
+	} {
+		if _, err := buildCommands(tt.command, tt.opts, commandSettings{}, nil); err == nil {
+			t.Errorf("expected an error for %s %q", tt.command, tt.opts)
+		}
+	}
+}
+
+func TestBuildCommandVerifyArchive(t *testing.T) {
+	settings := commandSettings{VerifyArchive: true}
+
+	for _, tt := range []struct {
+		opts     string
+		repoType string
+		localAnd []string
+		expected string
+	}{
+		{"--stanza=db", "", nil,
+			"pgbackrest stanza-create --stanza=db --repo-type=posix && pgbackrest check --stanza=db --repo-type=posix"},
+		{"--stanza=db --no-online", "s3", nil,
+			"pgbackrest stanza-create --stanza=db --no-online --repo-type=s3 && pgbackrest check --stanza=db --repo-type=s3"},
+		{"--stanza=db", "", []string{"s3"},
+			"pgbackrest stanza-create --stanza=db --repo-type=posix && pgbackrest stanza-create --stanza=db --repo-type=s3" +
+				" && pgbackrest check --stanza=db --repo-type=posix && pgbackrest check --stanza=db --repo-type=s3"},
+	} {
+		commands, err := buildCommands(crv1.PgtaskBackrestStanzaCreate, tt.opts, settings,
+			legacyRepoTargets(tt.repoType, tt.localAnd))
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if actual := joinCommands(commands); actual != tt.expected {
+			t.Errorf("expected %q, got %q", tt.expected, actual)
+		}
+	}
+
+	t.Run("disabled", func(t *testing.T) {
+		commands, err := buildCommands(crv1.PgtaskBackrestStanzaCreate, "--stanza=db", commandSettings{}, nil)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if actual := joinCommands(commands); actual != "pgbackrest stanza-create --stanza=db" {
+			t.Errorf("expected no check, got %q", actual)
+		}
+	})
+
+	t.Run("other commands", func(t *testing.T) {
+		commands, err := buildCommands(crv1.PgtaskBackrestStanzaDelete, "--stanza=db", settings, nil)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if actual := joinCommands(commands); actual != "pgbackrest stanza-delete --stanza=db" {
+			t.Errorf("expected no check, got %q", actual)
+		}
+	})
+
+	t.Run("runs after stanza-create", func(t *testing.T) {
+		commands, err := buildCommands(crv1.PgtaskBackrestStanzaCreate, "--stanza=db", settings, nil)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		// run returns the pgBackRest command of each call
+		run := func(stanzaCreateCode int) (ran []string, exitCode int, err error) {
+			exitCode, err = runCommands(commands, ioutil.Discard, ioutil.Discard, func(cmdStrs []string, stdout, stderr io.Writer) (int, error) {
+				ran = append(ran, cmdStrs[1])
+				if cmdStrs[1] == "stanza-create" && stanzaCreateCode != 0 {
+					return stanzaCreateCode, fmt.Errorf("command terminated with exit code %d", stanzaCreateCode)
+				}
+				return 0, nil
+			})
+			return
+		}
+
+		if ran, _, err := run(0); err != nil || !reflect.DeepEqual(ran, []string{"stanza-create", "check"}) {
+			t.Errorf("expected stanza-create then check, got %v and %v", ran, err)
+		}
+		if ran, exitCode, err := run(28); err == nil || exitCode != 28 || !reflect.DeepEqual(ran, []string{"stanza-create"}) {
+			t.Errorf("expected only stanza-create to fail, got %v, %d, and %v", ran, exitCode, err)
+		}
+	})
+}
+
+func TestBuildCommandStanza(t *testing.T) {
+	settings := commandSettings{Stanza: "hippo"}
+
+	for command, expected := range map[string]string{
+		crv1.PgtaskBackrestBackup:       "pgbackrest backup --stanza=hippo --repo-type=s3",
+		crv1.PgtaskBackrestCheck:        "pgbackrest check --stanza=hippo --repo-type=s3",
+		crv1.PgtaskBackrestExpire:       "pgbackrest expire --stanza=hippo --repo-type=s3",
+		crv1.PgtaskBackrestInfo:         "pgbackrest info --output=json --stanza=hippo --repo-type=s3",
+		crv1.PgtaskBackrestStanzaCreate: "pgbackrest stanza-create --stanza=hippo --repo-type=s3",
+		crv1.PgtaskBackrestStanzaDelete: "pgbackrest stanza-delete --stanza=hippo --repo-type=s3",
+	} {
+		commands, err := buildCommands(command, "", settings, legacyRepoTargets("s3", nil))
+		if err != nil {
+			t.Fatalf("expected no error for %q, got %v", command, err)
+		}
+		if actual := joinCommands(commands); actual != expected {
+			t.Errorf("expected %q, got %q", expected, actual)
+		}
+	}
+
+	t.Run("every repository", func(t *testing.T) {
+		commands, err := buildCommands(crv1.PgtaskBackrestBackup, "", settings, legacyRepoTargets("", []string{"s3"}))
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		for _, cmdStrs := range commands {
+			if !hasOption(cmdStrs, "--stanza") {
+				t.Errorf("expected --stanza in %q", cmdStrs)
+			}
+		}
+	})
+
+	t.Run("verify archive", func(t *testing.T) {
+		commands, err := buildCommands(crv1.PgtaskBackrestStanzaCreate, "",
+			commandSettings{Stanza: "hippo", VerifyArchive: true}, nil)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if expected := "pgbackrest stanza-create --stanza=hippo && pgbackrest check --stanza=hippo"; joinCommands(commands) != expected {
+			t.Errorf("expected %q, got %q", expected, joinCommands(commands))
+		}
+	})
+
+	t.Run("not set", func(t *testing.T) {
+		commands, err := buildCommands(crv1.PgtaskBackrestBackup, "", commandSettings{}, nil)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if hasOption(commands[0], "--stanza") {
+			t.Errorf("expected no --stanza, got %q", commands[0])
+		}
+	})
+
+	t.Run("job template", func(t *testing.T) {
+		// the Job of a backup renders PGBACKREST_STANZA even when its task has no stanza
+		env := renderJobEnv(t, map[string]interface{}{
+			"Command":          crv1.PgtaskBackrestBackup,
+			"CommandOpts":      "--type=full",
+			"PgbackrestStanza": "",
+		})
+		if _, ok := env["PGBACKREST_STANZA"]; !ok {
+			t.Fatal("expected the Job to set PGBACKREST_STANZA")
+		}
+
+		commands, err := buildCommands(env["COMMAND"], env["COMMAND_OPTS"],
+			commandSettings{Stanza: parseStanza(env["PGBACKREST_STANZA"])}, nil)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if expected := "pgbackrest backup --type=full"; joinCommands(commands) != expected {
+			t.Errorf("expected %q, got %q", expected, joinCommands(commands))
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		if _, err := buildCommands(crv1.PgtaskBackrestBackup, "", commandSettings{Stanza: "hip po"}, nil); err == nil {
+			t.Error("expected an error for whitespace")
+		}
+		if _, err := buildCommands(crv1.PgtaskBackrestBackup, "--stanza=db", settings, nil); err == nil {
+			t.Error("expected an error for a second --stanza")
+		}
+	})
+}
+
+// renderJobEnv renders the Job template of the operator with fields, which
+// default to empty strings, and returns the env of its container
+func renderJobEnv(t *testing.T, fields map[string]interface{}) map[string]string {
+	tmpl, err := template.ParseFiles("../conf/postgres-operator/backrest-job.json")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	values := map[string]interface{}{
+		"BackrestLocalAndS3Storage": false,
+		"SecurityContext":           "{}",
+	}
+	for _, name := range []string{
+		"JobName", "ClusterName", "Command", "CommandOpts", "PITRTarget", "PodName",
+		"PGOImagePrefix", "PGOImageTag", "PgbackrestStanza", "PgbackrestDBPath",
+		"PgbackrestRepoPath", "PgbackrestRepoType", "PgbackrestRestoreVolumes",
+		"PgbackrestRestoreVolumeMounts",
+	} {
+		values[name] = ""
+	}
+	for name, value := range fields {
+		values[name] = value
+	}
+
+	var doc bytes.Buffer
+	if err := tmpl.Execute(&doc, values); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	var job batchv1.Job
+	if err := json.Unmarshal(doc.Bytes(), &job); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	env := map[string]string{}
+	for _, v := range job.Spec.Template.Spec.Containers[0].Env {
+		env[v.Name] = v.Value
+	}
+	return env
+}
+
+func TestBuildCommandRepo1Path(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		settings commandSettings
+		targets  []repoTarget
+		expected string
+	}{
+		{"s3", commandSettings{Repo1Path: "/hippo"}, legacyRepoTargets("s3", nil),
+			"pgbackrest backup --stanza=db --repo-type=s3 --repo1-path=/hippo"},
+		{"s3 without path", commandSettings{}, legacyRepoTargets("s3", nil),
+			"pgbackrest backup --stanza=db --repo-type=s3"},
+		{"local", commandSettings{Repo1Path: "/hippo"}, legacyRepoTargets("", nil),
+			"pgbackrest backup --stanza=db --repo-type=posix"},
+		{"local explicitly", commandSettings{Repo1Path: "/hippo", Repo1PathLocal: true}, legacyRepoTargets("", nil),
+			"pgbackrest backup --stanza=db --repo-type=posix --repo1-path=/hippo"},
+		{"local and s3", commandSettings{Repo1Path: "/hippo"}, legacyRepoTargets("", []string{"s3"}),
+			"pgbackrest backup --stanza=db --repo-type=posix && pgbackrest backup --stanza=db --repo-type=s3 --repo1-path=/hippo"},
+		{"other repository", commandSettings{Repo1Path: "/hippo"}, []repoTarget{{Index: 1, Type: "gcs"}, {Index: 2, Type: "azure"}},
+			"pgbackrest backup --stanza=db --repo=1 --repo1-type=gcs --repo1-path=/hippo" +
+				" && pgbackrest backup --stanza=db --repo=2 --repo2-type=azure"},
+	} {
+		commands, err := buildCommands(crv1.PgtaskBackrestBackup, "--stanza=db", tt.settings, tt.targets)
+		if err != nil {
+			t.Fatalf("expected no error for %s, got %v", tt.name, err)
+		}
+		if actual := joinCommands(commands); actual != tt.expected {
+			t.Errorf("expected %q for %s, got %q", tt.expected, tt.name, actual)
+		}
+	}
+
+	t.Run("info after backup", func(t *testing.T) {
+		backupCmd := []string{"pgbackrest", "backup", "--stanza=db", "--type=full", "--repo-type=s3", "--repo1-path=/hippo"}
+		expected := []string{"pgbackrest", "info", "--stanza=db", "--repo-type=s3", "--repo1-path=/hippo", "--output=json"}
+		if actual := backupInfoCommand(backupCmd); !reflect.DeepEqual(actual, expected) {
+			t.Errorf("expected %q, got %q", expected, actual)
+		}
+	})
+
+	t.Run("conflict", func(t *testing.T) {
+		if _, err := buildCommands(crv1.PgtaskBackrestBackup, "--stanza=db --repo1-path=/rhino",
+			commandSettings{Repo1Path: "/hippo"}, legacyRepoTargets("s3", nil)); err == nil {
+			t.Error("expected an error")
+		}
+	})
+}
+
+func TestBuildCommandStanzaDelete(t *testing.T) {
+	for _, tt := range []struct {
+		force    bool
+		repoType string
+		localAnd []string
+		expected string
+	}{
+		{false, "", nil, "pgbackrest stanza-delete --stanza=db --repo-type=posix"},
+		{false, "s3", nil, "pgbackrest stanza-delete --stanza=db --repo-type=s3"},
+		{false, "", []string{"s3"},
+			"pgbackrest stanza-delete --stanza=db --repo-type=posix && pgbackrest stanza-delete --stanza=db --repo-type=s3"},
+		{true, "", nil, "pgbackrest stanza-delete --stanza=db --force --repo-type=posix"},
+		{true, "", []string{"s3"},
+			"pgbackrest stanza-delete --stanza=db --force --repo-type=posix && pgbackrest stanza-delete --stanza=db --force --repo-type=s3"},
+	} {
+		cmd, err := buildCommands(crv1.PgtaskBackrestStanzaDelete, "--stanza=db",
+			commandSettings{StanzaDeleteForce: tt.force}, legacyRepoTargets(tt.repoType, tt.localAnd))
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if actual := joinCommands(cmd); actual != tt.expected {
+			t.Errorf("expected %q, got %q", tt.expected, actual)
+		}
+	}
+
+	t.Run("other commands", func(t *testing.T) {
+		cmd, err := buildCommands(crv1.PgtaskBackrestStanzaCreate, "--stanza=db",
+			commandSettings{StanzaDeleteForce: true}, nil)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if expected, actual := "pgbackrest stanza-create --stanza=db", joinCommands(cmd); actual != expected {
+			t.Errorf("expected %q, got %q", expected, actual)
+		}
+	})
+}
+
+const sampleInfo = `[{
+	"archive": [{"id": "12-1", "max": "000000010000000000000008", "min": "000000010000000000000002"}],
+	"backup": [
+		{
+			"archive": {"start": "000000010000000000000002", "stop": "000000010000000000000002"},
+			"info": {"delta": 31395012, "repository": {"delta": 3875519, "size": 3875519}, "size": 31395012},
+			"label": "20200601-120000F", "prior": null,
+			"timestamp": {"start": 1591012800, "stop": 1591012830}, "type": "full"
+		},
+		{
+			"archive": {"start": "000000010000000000000008", "stop": "000000010000000000000008"},
+			"info": {"delta": 8462, "repository": {"delta": 1024, "size": 3876543}, "size": 31403474},
+			"label": "20200601-120000F_20200602-120000I", "prior": "20200601-120000F",
+			"timestamp": {"start": 1591099200, "stop": 1591099265}, "type": "incr"
+		}
+	],
+	"name": "db",
+	"status": {"code": 0, "message": "ok"}
+}]`
+
+func TestBackupInfoCommand(t *testing.T) {
+	for _, tt := range []struct{ backup, expected string }{
+		{"pgbackrest backup --stanza=db --type=full --process-max=4",
+			"pgbackrest info --stanza=db --output=json"},
+		{"pgbackrest backup --stanza=db --repo1-retention-full=2 --repo-type=s3",
+			"pgbackrest info --stanza=db --repo-type=s3 --output=json"},
+		{"pgbackrest backup --stanza=db --repo=2 --repo2-type=gcs",
+			"pgbackrest info --stanza=db --repo=2 --repo2-type=gcs --output=json"},
+	} {
+		if actual := strings.Join(backupInfoCommand(strings.Fields(tt.backup)), " "); actual != tt.expected {
+			t.Errorf("expected %q, got %q", tt.expected, actual)
+		}
+	}
+}
+
+func TestBackupResults(t *testing.T) {
+	lines, err := backupResults([]byte(sampleInfo))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(lines) != 1 {
+		t.Fatalf("expected one result, got %q", lines)
+	}
+
+	var result map[string]interface{}
+	if err := json.Unmarshal(lines[0], &result); err != nil {
+		t.Fatalf("expected JSON, got %q", lines[0])
+	}
+
+	expected := map[string]interface{}{
+		"tag":             backupResultTag,
+		"stanza":          "db",
+		"label":           "20200601-120000F_20200602-120000I",
+		"type":            "incr",
+		"size":            float64(31403474),
+		"delta":           float64(8462),
+		"repositorySize":  float64(3876543),
+		"repositoryDelta": float64(1024),
+		"start":           "2020-06-02T12:00:00Z",
+		"stop":            "2020-06-02T12:01:05Z",
+		"durationSeconds": float64(65),
+	}
+	if !reflect.DeepEqual(expected, result) {
+		t.Errorf("expected %v, got %v", expected, result)
+	}
+
+	t.Run("no backups", func(t *testing.T) {
+		lines, err := backupResults([]byte(`[{"backup": [], "name": "db", "status": {"code": 2}}]`))
+		if err != nil || len(lines) != 0 {
+			t.Errorf("expected nothing, got %q and %v", lines, err)
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		if _, err := backupResults([]byte("stanza: db")); err == nil {
+			t.Error("expected an error")
+		}
+	})
+}
+
+func TestReportBackup(t *testing.T) {
+	var ran []string
+	var stdout bytes.Buffer
+	reportBackup([]string{"pgbackrest", "backup", "--stanza=db"}, &stdout,
+		func(cmdStrs []string, stdout, stderr io.Writer) (int, error) {
+			ran = append(ran, strings.Join(cmdStrs, " "))
+			_, err := io.WriteString(stdout, sampleInfo)
+			return 0, err
+		})
+
+	if expected := []string{"pgbackrest info --stanza=db --output=json"}; !reflect.DeepEqual(expected, ran) {
+		t.Errorf("expected %q, got %q", expected, ran)
+	}
+	if actual := stdout.String(); !strings.HasPrefix(actual, `{"tag":"`+backupResultTag+`"`) ||
+		strings.Count(actual, "\n") != 1 {
+		t.Errorf("expected one line of JSON, got %q", actual)
+	}
+
+	t.Run("info fails", func(t *testing.T) {
+		var stdout bytes.Buffer
+		reportBackup([]string{"pgbackrest", "backup", "--stanza=db"}, &stdout,
+			func(cmdStrs []string, stdout, stderr io.Writer) (int, error) {
+				return 1, errors.New("command terminated with exit code 1")
+			})
+		if stdout.Len() != 0 {
+			t.Errorf("expected no result, got %q", stdout.String())
+		}
+	})
+}
+
+func TestRequireEnv(t *testing.T) {
+	env := map[string]string{"COMMAND": "backup"}
+	getenv := func(name string) string { return env[name] }
+
+	err := requireEnv(getenv, "NAMESPACE", "COMMAND", "PODNAME")
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	if expected := "required env vars not set: NAMESPACE, PODNAME"; err.Error() != expected {
+		t.Errorf("expected %q, got %q", expected, err.Error())
+	}
+
+	env["NAMESPACE"], env["PODNAME"] = "pgo", "hippo-abc"
+	if err := requireEnv(getenv, "NAMESPACE", "COMMAND", "PODNAME"); err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+
+	t.Run("alternatives", func(t *testing.T) {
+		env := map[string]string{}
+		getenv := func(name string) string { return env[name] }
+
+		err := requireEnv(getenv, "NAMESPACE", "COMMAND", "PODNAME|PGBACKREST_POD_SELECTOR")
+		if err == nil {
+			t.Fatal("expected an error")
+		}
+		expected := "required env vars not set: NAMESPACE, COMMAND, PODNAME or PGBACKREST_POD_SELECTOR"
+		if err.Error() != expected {
+			t.Errorf("expected %q, got %q", expected, err.Error())
+		}
+
+		env["NAMESPACE"], env["COMMAND"], env["PGBACKREST_POD_SELECTOR"] = "pgo", "backup", "pg-cluster=hippo"
+		if err := requireEnv(getenv, "NAMESPACE", "COMMAND", "PODNAME|PGBACKREST_POD_SELECTOR"); err != nil {
+			t.Errorf("expected no error, got %v", err)
+		}
+	})
+}
+
+func TestRequireNamespace(t *testing.T) {
+	clientset := fake.NewSimpleClientset(&v1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "pgo"}})
+
+	if err := requireNamespace(clientset, "pgo"); err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+	if err := requireNamespace(clientset, "pg0"); err == nil || !strings.Contains(err.Error(), `"pg0"`) {
+		t.Errorf("expected an error naming the namespace, got %v", err)
+	}
+
+	t.Run("forbidden", func(t *testing.T) {
+		clientset := fake.NewSimpleClientset()
+		clientset.PrependReactor("get", "namespaces", func(k8stesting.Action) (bool, runtime.Object, error) {
+			return true, nil, kerrors.NewForbidden(v1.Resource("namespaces"), "pgo", errors.New("cluster scope"))
+		})
+
+		if err := requireNamespace(clientset, "pgo"); err != nil {
+			t.Errorf("expected no error, got %v", err)
+		}
+	})
+
+	t.Run("other errors", func(t *testing.T) {
+		clientset := fake.NewSimpleClientset()
+		clientset.PrependReactor("get", "namespaces", func(k8stesting.Action) (bool, runtime.Object, error) {
+			return true, nil, kerrors.NewServiceUnavailable("try again")
+		})
+
+		if err := requireNamespace(clientset, "pgo"); err == nil {
+			t.Error("expected an error")
+		}
+	})
+
+	t.Run("role", func(t *testing.T) {
+		for _, path := range []string{
+			"../conf/postgres-operator/pgo-backrest-role.json",
+			"../installers/ansible/roles/pgo-operator/files/pgo-configs/pgo-backrest-role.json",
+		} {
+			data, err := ioutil.ReadFile(path)
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+
+			var role rbacv1.Role
+			if err := json.Unmarshal(data, &role); err != nil {
+				t.Fatalf("expected no error for %s, got %v", path, err)
+			}
+
+			allowed := false
+			for _, rule := range role.Rules {
+				allowed = allowed || (reflect.DeepEqual(rule.Resources, []string{"namespaces"}) &&
+					reflect.DeepEqual(rule.Verbs, []string{"get"}))
+			}
+			if !allowed {
+				t.Errorf("expected %s to allow namespaces to be read, got %v", path, role.Rules)
+			}
+		}
+	})
+}
+
+func TestSelectPrimaryPod(t *testing.T) {
+	// newPod returns a pod of the hippo cluster with role in phase
+	newPod := func(name, role string, phase v1.PodPhase) *v1.Pod {
+		return &v1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: name, Namespace: "ns",
+				Labels: map[string]string{"pg-cluster": "hippo", "role": role},
+			},
+			Status: v1.PodStatus{Phase: phase},
+		}
+	}
+
+	t.Run("primary", func(t *testing.T) {
+		clientset := fake.NewSimpleClientset(
+			newPod("hippo-old", "master", v1.PodFailed),
+			newPod("hippo-abc", "replica", v1.PodRunning),
+			newPod("hippo-def", "master", v1.PodRunning),
+		)
+
+		name, err := selectPrimaryPod(clientset, "ns", "pg-cluster=hippo")
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if name != "hippo-def" {
+			t.Errorf("expected %q, got %q", "hippo-def", name)
+		}
+	})
+
+	t.Run("no match", func(t *testing.T) {
+		clientset := fake.NewSimpleClientset(
+			newPod("hippo-abc", "replica", v1.PodRunning),
+		)
+
+		if _, err := selectPrimaryPod(clientset, "ns", "pg-cluster=hippo"); err == nil {
+			t.Error("expected an error")
+		}
+		if _, err := selectPrimaryPod(clientset, "ns", "pg-cluster=rhino"); err == nil {
+			t.Error("expected an error")
+		}
+	})
+
+	t.Run("multiple matches", func(t *testing.T) {
+		clientset := fake.NewSimpleClientset(
+			newPod("hippo-abc", "master", v1.PodRunning),
+			newPod("hippo-def", "master", v1.PodRunning),
+		)
+
+		_, err := selectPrimaryPod(clientset, "ns", "pg-cluster=hippo")
+		if err == nil || !strings.Contains(err.Error(), "hippo-abc, hippo-def") {
+			t.Errorf("expected an error naming both pods, got %v", err)
+		}
+	})
+}
+
+func TestBuildCommandBinary(t *testing.T) {
+	settings := commandSettings{Binary: "/opt/crunchy/bin/pgbackrest-wrapper"}
+
+	for _, command := range []string{
+		crv1.PgtaskBackrestBackup, crv1.PgtaskBackrestCheck, crv1.PgtaskBackrestExpire,
+		crv1.PgtaskBackrestInfo, crv1.PgtaskBackrestRestore, crv1.PgtaskBackrestStanzaCreate,
+		crv1.PgtaskBackrestStanzaDelete,
+	} {
+		commands, err := buildCommands(command, "--stanza=db", settings, legacyRepoTargets("", []string{"s3"}))
+		if err != nil {
+			t.Fatalf("expected no error for %q, got %v", command, err)
+		}
+		for _, cmdStrs := range commands {
+			if cmdStrs[0] != settings.Binary || cmdStrs[1] != command {
+				t.Errorf("expected %q to run %s, got %q", command, settings.Binary, cmdStrs)
+			}
+		}
+	}
+
+	backup := []string{settings.Binary, "backup", "--stanza=db"}
+	if actual := backupInfoCommand(backup); actual[0] != settings.Binary {
+		t.Errorf("expected info to run %s, got %q", settings.Binary, actual)
+	}
+
+	if expected, actual := "pgbackrest", (commandSettings{}).binary(); actual != expected {
+		t.Errorf("expected %q, got %q", expected, actual)
+	}
+}
+
+func TestContainerName(t *testing.T) {
+	if expected, actual := "database", containerName(""); actual != expected {
+		t.Errorf("expected %q, got %q", expected, actual)
+	}
+	if expected, actual := "postgres", containerName("postgres"); actual != expected {
+		t.Errorf("expected %q, got %q", expected, actual)
+	}
+}
+
+func TestBuildCommandGCS(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		repoType string
+		localAnd []string
+		expected string
+	}{
+		{
+			name: "gcs", repoType: "gcs",
+			expected: "pgbackrest backup --stanza=db --repo-type=gcs",
+		},
+		{
+			name: "local and gcs", localAnd: []string{"gcs"},
+			expected: "pgbackrest backup --stanza=db --repo-type=posix && pgbackrest backup --stanza=db --repo-type=gcs",
+		},
+		{
+			name: "s3 unchanged", repoType: "s3",
+			expected: "pgbackrest backup --stanza=db --repo-type=s3",
+		},
+		{
+			name: "local, s3, and gcs", localAnd: []string{"s3", "gcs"},
+			expected: "pgbackrest backup --stanza=db --repo-type=posix && pgbackrest backup --stanza=db --repo-type=s3" +
+				" && pgbackrest backup --stanza=db --repo-type=gcs",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd, err := buildCommands(crv1.PgtaskBackrestBackup, "--stanza=db", commandSettings{}, legacyRepoTargets(tt.repoType, tt.localAnd))
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if actual := joinCommands(cmd); actual != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, actual)
+			}
+		})
+	}
+}
+
+func TestBuildCommandAzure(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		repoType string
+		localAnd []string
+		expected string
+	}{
+		{
+			name: "azure", repoType: "azure",
+			expected: "pgbackrest backup --stanza=db --repo-type=azure",
+		},
+		{
+			name: "local and azure", localAnd: []string{"azure"},
+			expected: "pgbackrest backup --stanza=db --repo-type=posix && pgbackrest backup --stanza=db --repo-type=azure",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd, err := buildCommands(crv1.PgtaskBackrestBackup, "--stanza=db", commandSettings{}, legacyRepoTargets(tt.repoType, tt.localAnd))
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if actual := joinCommands(cmd); actual != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, actual)
+			}
+		})
+	}
+}
+
+func TestBuildCommandRepos(t *testing.T) {
+	t.Run("repo1 local and repo2 s3", func(t *testing.T) {
+		targets, err := repoTargets("", "", "1=posix,2=s3", nil)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		cmd, err := buildCommands(crv1.PgtaskBackrestBackup, "--stanza=db", commandSettings{}, targets)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		expected := "pgbackrest backup --stanza=db --repo=1 --repo1-type=posix && " +
+			"pgbackrest backup --stanza=db --repo=2 --repo2-type=s3"
+		if actual := joinCommands(cmd); actual != expected {
+			t.Errorf("expected %q, got %q", expected, actual)
+		}
+	})
+
+	t.Run("repo index", func(t *testing.T) {
+		for _, command := range []string{
+			crv1.PgtaskBackrestBackup, crv1.PgtaskBackrestCheck, crv1.PgtaskBackrestExpire,
+		} {
+			targets, err := repoTargets("gcs", "3", "", []string{"s3"})
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+
+			cmd, err := buildCommands(command, "--stanza=db", commandSettings{}, targets)
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			expected := "pgbackrest " + command + " --stanza=db --repo=3 --repo3-type=gcs"
+			if actual := joinCommands(cmd); actual != expected {
+				t.Errorf("expected %q, got %q", expected, actual)
+			}
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		for _, tt := range []struct{ repoIndex, repos string }{
+			{"0", ""},
+			{"one", ""},
+			{"", "1"},
+			{"", "1=posix,two=s3"},
+		} {
+			if _, err := repoTargets("", tt.repoIndex, tt.repos, nil); err == nil {
+				t.Errorf("expected an error for %q and %q", tt.repoIndex, tt.repos)
+			}
+		}
+
+		for _, targets := range [][]repoTarget{
+			{{Index: 5, Type: "s3"}},
+			{{Index: 1, Type: "cifs"}},
+		} {
+			if _, err := buildCommands(crv1.PgtaskBackrestBackup, "--stanza=db", commandSettings{}, targets); err == nil {
+				t.Errorf("expected an error for %v", targets)
+			}
+		}
+	})
+}
+
+func TestRepoTypeFlag(t *testing.T) {
+	for repoType, expected := range map[string]string{
+		"":      "",
+		"posix": "",
+		"s3":    "--repo-type=s3",
+		"gcs":   "--repo-type=gcs",
+		"azure": "--repo-type=azure",
+		"cifs":  "",
+	} {
+		if actual := repoTypeFlag(repoType); actual != expected {
+			t.Errorf("expected %q for %q, got %q", expected, repoType, actual)
+		}
+	}
+}
+
+func TestBuildCommandLocalRepoType(t *testing.T) {
+	for _, repoType := range []string{"", "local", "posix"} {
+		cmd, err := buildCommands(crv1.PgtaskBackrestBackup, "--stanza=db", commandSettings{}, legacyRepoTargets(repoType, nil))
+		if err != nil {
+			t.Fatalf("expected no error for %q, got %v", repoType, err)
+		}
+		if expected, actual := "pgbackrest backup --stanza=db --repo-type=posix", joinCommands(cmd); actual != expected {
+			t.Errorf("expected %q for %q, got %q", expected, repoType, actual)
+		}
+	}
+
+	t.Run("local and s3", func(t *testing.T) {
+		cmd, err := buildCommands(crv1.PgtaskBackrestBackup, "--stanza=db", commandSettings{}, legacyRepoTargets("", []string{"s3"}))
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		expected := "pgbackrest backup --stanza=db --repo-type=posix && pgbackrest backup --stanza=db --repo-type=s3"
+		if actual := joinCommands(cmd); actual != expected {
+			t.Errorf("expected %q, got %q", expected, actual)
+		}
+	})
+
+	t.Run("unknown type", func(t *testing.T) {
+		cmd, err := buildCommands(crv1.PgtaskBackrestBackup, "--stanza=db", commandSettings{}, legacyRepoTargets("cifs", nil))
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if expected, actual := "pgbackrest backup --stanza=db", joinCommands(cmd); actual != expected {
+			t.Errorf("expected %q, got %q", expected, actual)
+		}
+	})
+}
+
+func TestBuildCommandUnsupported(t *testing.T) {
+	if _, err := buildCommands("reticulate", "", commandSettings{}, legacyRepoTargets("", nil)); err == nil {
+		t.Error("expected an error")
+	}
+}
+
+func TestRunCommands(t *testing.T) {
+	commands, err := buildCommands(crv1.PgtaskBackrestBackup, "--stanza=db", commandSettings{}, legacyRepoTargets("", []string{"s3"}))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(commands) != 2 {
+		t.Fatalf("expected two commands, got %v", commands)
+	}
+	if actual := strings.Join(commands[0], " "); actual != "pgbackrest backup --stanza=db --repo-type=posix" {
+		t.Errorf("expected the local backup first, got %q", actual)
+	}
+	if actual := strings.Join(commands[1], " "); actual != "pgbackrest backup --stanza=db --repo-type=s3" {
+		t.Errorf("expected the s3 backup second, got %q", actual)
+	}
+
+	t.Run("success", func(t *testing.T) {
+		var ran [][]string
+		exitCode, err := runCommands(commands, ioutil.Discard, ioutil.Discard, func(cmdStrs []string, stdout, stderr io.Writer) (int, error) {
+			ran = append(ran, cmdStrs)
+			return 0, nil
+		})
+		if err != nil || exitCode != 0 {
+			t.Fatalf("expected success, got %d and %v", exitCode, err)
+		}
+		if len(ran) != 2 {
+			t.Errorf("expected both commands to run, got %v", ran)
+		}
+	})
+
+	t.Run("first fails", func(t *testing.T) {
+		var ran [][]string
+		exitCode, err := runCommands(commands, ioutil.Discard, ioutil.Discard, func(cmdStrs []string, stdout, stderr io.Writer) (int, error) {
+			ran = append(ran, cmdStrs)
+			fmt.Fprint(stderr, "ERROR: [041]")
+			return 41, errors.New("command terminated with exit code 41")
+		})
+		if err == nil || exitCode != 41 {
+			t.Errorf("expected exit code 41, got %d and %v", exitCode, err)
+		}
+		if len(ran) != 1 {
+			t.Errorf("expected the s3 backup to be skipped, got %v", ran)
+		}
+	})
+
+	t.Run("second fails", func(t *testing.T) {
+		exitCode, err := runCommands(commands, ioutil.Discard, ioutil.Discard, func(cmdStrs []string, stdout, stderr io.Writer) (int, error) {
+			if strings.Contains(strings.Join(cmdStrs, " "), "--repo-type=s3") {
+				return 28, errors.New("command terminated with exit code 28")
+			}
+			return 0, nil
+		})
+		if err == nil || exitCode != 28 || !strings.Contains(err.Error(), "command 2 of 2") {
+			t.Errorf("expected the s3 backup to fail with 28, got %d and %v", exitCode, err)
+		}
+	})
+
+	t.Run("streams output", func(t *testing.T) {
+		reader, writer := io.Pipe()
+		defer reader.Close()
+
+		// each command writes a progress line and then waits for it to be read
+		// from the pipe, which can only happen if it is passed along right away
+		exitCode, err := runCommands(commands, writer, ioutil.Discard, func(cmdStrs []string, stdout, stderr io.Writer) (int, error) {
+			line := strings.Join(cmdStrs, " ") + "\n"
+			read := make(chan string)
+			go func() {
+				buffer := make([]byte, len(line))
+				n, _ := io.ReadFull(reader, buffer)
+				read <- string(buffer[:n])
+			}()
+
+			if _, err := io.WriteString(stdout, line); err != nil {
+				return -1, err
+			}
+
+			select {
+			case actual := <-read:
+				if actual != line {
+					t.Errorf("expected %q, got %q", line, actual)
+				}
+			case <-time.After(time.Second):
+				t.Errorf("expected %q before the command returned", line)
+			}
+			return 0, nil
+		})
+		if err != nil || exitCode != 0 {
+			t.Errorf("expected success, got %d and %v", exitCode, err)
+		}
+	})
+}
+
+func TestParseRetryCount(t *testing.T) {
+	for _, tt := range []struct {
+		value    string
+		expected int
+	}{
+		{"", 0},
+		{"0", 0},
+		{"3", 3},
+	} {
+		actual, err := parseRetryCount(tt.value)
+		if err != nil {
+			t.Fatalf("expected no error for %q, got %v", tt.value, err)
+		}
+		if actual != tt.expected {
+			t.Errorf("expected %d for %q, got %d", tt.expected, tt.value, actual)
+		}
+	}
+
+	for _, value := range []string{"-1", "once", "1.5"} {
+		if _, err := parseRetryCount(value); err == nil {
+			t.Errorf("expected an error for %q", value)
+		}
+	}
+}
+
+func TestParseOutputLimit(t *testing.T) {
+	for _, tt := range []struct {
+		value    string
+		expected int
+	}{
+		{"", defaultOutputLimit},
+		{"0", 0},
+		{"64", 64 * 1024},
+	} {
+		actual, err := parseOutputLimit(tt.value)
+		if err != nil {
+			t.Fatalf("expected no error for %q, got %v", tt.value, err)
+		}
+		if actual != tt.expected {
+			t.Errorf("expected %d for %q, got %d", tt.expected, tt.value, actual)
+		}
+	}
+
+	for _, value := range []string{"-1", "1MB", "0.5"} {
+		if _, err := parseOutputLimit(value); err == nil {
+			t.Errorf("expected an error for %q", value)
+		}
+	}
+}
+
+func TestParseReadyTimeout(t *testing.T) {
+	for _, tt := range []struct {
+		value    string
+		expected time.Duration
+	}{
+		{"", 0},
+		{"0", 0},
+		{"10m", 10 * time.Minute},
+	} {
+		actual, err := parseReadyTimeout(tt.value)
+		if err != nil {
+			t.Fatalf("expected no error for %q, got %v", tt.value, err)
+		}
+		if actual != tt.expected {
+			t.Errorf("expected %s for %q, got %s", tt.expected, tt.value, actual)
+		}
+	}
+
+	for _, value := range []string{"-1m", "soon", "10"} {
+		if _, err := parseReadyTimeout(value); err == nil {
+			t.Errorf("expected an error for %q", value)
+		}
+	}
+}
+
+func TestWaitForContainer(t *testing.T) {
+	defer func(interval time.Duration) { readyPollInterval = interval }(readyPollInterval)
+	readyPollInterval = time.Millisecond
+
+	// newPod returns a pod whose database container is ready or not
+	newPod := func(ready bool) *v1.Pod {
+		return &v1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "hippo-abc", Namespace: "ns"},
+			Status: v1.PodStatus{ContainerStatuses: []v1.ContainerStatus{
+				{Name: "pgbadger", Ready: true},
+				{Name: "database", Ready: ready},
+			}},
+		}
+	}
+
+	t.Run("waits until ready", func(t *testing.T) {
+		clientset := fake.NewSimpleClientset(newPod(false))
+
+		// the container becomes ready on the third check
+		var gets int
+		clientset.PrependReactor("get", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+			if gets++; gets < 3 {
+				return false, nil, nil
+			}
+			return true, newPod(true), nil
+		})
+
+		if err := waitForContainer(context.Background(), clientset, "ns", "hippo-abc", "database", time.Minute); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if gets != 3 {
+			t.Errorf("expected three checks, got %d", gets)
+		}
+	})
+
+	t.Run("already ready", func(t *testing.T) {
+		clientset := fake.NewSimpleClientset(newPod(true))
+
+		if err := waitForContainer(context.Background(), clientset, "ns", "hippo-abc", "database", time.Minute); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	})
+
+	t.Run("never ready", func(t *testing.T) {
+		clientset := fake.NewSimpleClientset(newPod(false))
+
+		err := waitForContainer(context.Background(), clientset, "ns", "hippo-abc", "database", 20*time.Millisecond)
+		if err == nil || !strings.Contains(err.Error(), "was not ready") {
+			t.Errorf("expected a timeout error, got %v", err)
+		}
+	})
+
+	t.Run("missing pod", func(t *testing.T) {
+		clientset := fake.NewSimpleClientset()
+
+		if err := waitForContainer(context.Background(), clientset, "ns", "hippo-abc", "database", 20*time.Millisecond); err == nil {
+			t.Error("expected an error")
+		}
+	})
+
+	t.Run("missing container", func(t *testing.T) {
+		clientset := fake.NewSimpleClientset(newPod(true))
+
+		if err := waitForContainer(context.Background(), clientset, "ns", "hippo-abc", "backrest", 20*time.Millisecond); err == nil {
+			t.Error("expected an error")
+		}
+	})
+}
+
+func TestWithRetries(t *testing.T) {
+	commands, err := buildCommands(crv1.PgtaskBackrestBackup, "--stanza=db", commandSettings{}, legacyRepoTargets("s3", nil))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	transportErr := &kubeapi.ExecTransportError{Pod: "pod", Err: errors.New("unable to upgrade connection")}
+
+	// failOnce returns an execFunc that fails the first time it is called
+	failOnce := func(calls *int) execFunc {
+		return func(cmdStrs []string, stdout, stderr io.Writer) (int, error) {
+			if *calls++; *calls == 1 {
+				return -1, transportErr
+			}
+			return 0, nil
+		}
+	}
+
+	t.Run("fails once then succeeds", func(t *testing.T) {
+		var calls int
+		exec := withRetries(context.Background(), failOnce(&calls), 2, time.Millisecond)
+
+		exitCode, err := runCommands(commands, ioutil.Discard, ioutil.Discard, exec)
+		if err != nil || exitCode != 0 {
+			t.Errorf("expected success, got %d and %v", exitCode, err)
+		}
+		if calls != 2 {
+			t.Errorf("expected two attempts, got %d", calls)
+		}
+	})
+
+	t.Run("no retries", func(t *testing.T) {
+		var calls int
+		exec := withRetries(context.Background(), failOnce(&calls), 0, time.Millisecond)
+
+		exitCode, err := runCommands(commands, ioutil.Discard, ioutil.Discard, exec)
+		if !errors.Is(err, transportErr) || exitCode != -1 {
+			t.Errorf("expected transport error, got %d and %v", exitCode, err)
+		}
+		if calls != 1 {
+			t.Errorf("expected one attempt, got %d", calls)
+		}
+	})
+
+	t.Run("retries exhausted", func(t *testing.T) {
+		var calls int
+		exec := withRetries(context.Background(), func(cmdStrs []string, stdout, stderr io.Writer) (int, error) {
+			calls++
+			return -1, transportErr
+		}, 2, time.Millisecond)
+
+		if exitCode, err := exec(commands[0], ioutil.Discard, ioutil.Discard); err != transportErr || exitCode != -1 {
+			t.Errorf("expected transport error, got %d and %v", exitCode, err)
+		}
+		if calls != 3 {
+			t.Errorf("expected three attempts, got %d", calls)
+		}
+	})
+
+	t.Run("lock held by the lost attempt", func(t *testing.T) {
+		var calls int
+		exec := withRetries(context.Background(), func(cmdStrs []string, stdout, stderr io.Writer) (int, error) {
+			switch calls++; calls {
+			case 1:
+				return -1, transportErr
+			case 2:
+				return backrestLockExitCode, errors.New("command terminated with exit code 50")
+			}
+			return 0, nil
+		}, 3, time.Millisecond)
+
+		if exitCode, err := exec(commands[0], ioutil.Discard, ioutil.Discard); err != nil || exitCode != 0 {
+			t.Errorf("expected success, got %d and %v", exitCode, err)
+		}
+		if calls != 3 {
+			t.Errorf("expected three attempts, got %d", calls)
+		}
+	})
+
+	t.Run("lock held without a lost attempt", func(t *testing.T) {
+		var calls int
+		exec := withRetries(context.Background(), func(cmdStrs []string, stdout, stderr io.Writer) (int, error) {
+			calls++
+			return backrestLockExitCode, errors.New("command terminated with exit code 50")
+		}, 3, time.Millisecond)
+
+		if exitCode, _ := exec(commands[0], ioutil.Discard, ioutil.Discard); exitCode != backrestLockExitCode {
+			t.Errorf("expected exit code %d, got %d", backrestLockExitCode, exitCode)
+		}
+		if calls != 1 {
+			t.Errorf("expected one attempt, got %d", calls)
+		}
+	})
+
+	t.Run("command failure", func(t *testing.T) {
+		var calls int
+		exec := withRetries(context.Background(), func(cmdStrs []string, stdout, stderr io.Writer) (int, error) {
+			calls++
+			return 41, errors.New("command terminated with exit code 41")
+		}, 2, time.Millisecond)
+
+		if exitCode, err := exec(commands[0], ioutil.Discard, ioutil.Discard); err == nil || exitCode != 41 {
+			t.Errorf("expected exit code 41, got %d and %v", exitCode, err)
+		}
+		if calls != 1 {
+			t.Errorf("expected one attempt, got %d", calls)
+		}
+	})
+
+	t.Run("canceled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		var calls int
+		exec := withRetries(ctx, failOnce(&calls), 2, time.Minute)
+		if _, err := exec(commands[0], ioutil.Discard, ioutil.Discard); err == nil {
+			t.Error("expected an error")
+		}
+		if calls != 1 {
+			t.Errorf("expected one attempt, got %d", calls)
+		}
+	})
+}
+
+func TestWithStderr(t *testing.T) {
+	failure := errors.New("command terminated with exit code 41")
+
+	t.Run("failure", func(t *testing.T) {
+		exec := withStderr(func(cmdStrs []string, stdout, stderr io.Writer) (int, error) {
+			fmt.Fprintln(stderr, "INFO: backup command begin")
+			fmt.Fprintln(stderr, "ERROR: [041]: unable to open file '/backrestrepo/db/backup.info'")
+			return 41, failure
+		})
+
+		var stderr strings.Builder
+		exitCode, err := exec([]string{"pgbackrest", "backup"}, ioutil.Discard, &stderr)
+		if exitCode != 41 || !errors.Is(err, failure) {
+			t.Fatalf("expected the exit code and error of the command, got %d and %v", exitCode, err)
+		}
+		if !strings.Contains(err.Error(), "ERROR: [041]: unable to open file") {
+			t.Errorf("expected stderr in the error, got %q", err.Error())
+		}
+		if !strings.Contains(stderr.String(), "INFO: backup command begin") {
+			t.Errorf("expected stderr to be passed along, got %q", stderr.String())
+		}
+	})
+
+	t.Run("last lines", func(t *testing.T) {
+		exec := withStderr(func(cmdStrs []string, stdout, stderr io.Writer) (int, error) {
+			for i := 1; i <= 10; i++ {
+				fmt.Fprintf(stderr, "line %d\n", i)
+			}
+			return 41, failure
+		})
+
+		_, err := exec([]string{"pgbackrest", "backup"}, ioutil.Discard, ioutil.Discard)
+		if expected := failure.Error() + ": line 6; line 7; line 8; line 9; line 10"; err == nil || err.Error() != expected {
+			t.Errorf("expected %q, got %v", expected, err)
+		}
+	})
+
+	t.Run("no stderr", func(t *testing.T) {
+		exec := withStderr(func(cmdStrs []string, stdout, stderr io.Writer) (int, error) {
+			return 41, failure
+		})
+
+		if _, err := exec([]string{"pgbackrest", "backup"}, ioutil.Discard, ioutil.Discard); err != failure {
+			t.Errorf("expected the error unchanged, got %v", err)
+		}
+	})
+
+	t.Run("success", func(t *testing.T) {
+		exec := withStderr(func(cmdStrs []string, stdout, stderr io.Writer) (int, error) {
+			fmt.Fprintln(stderr, "WARN: option repo1-retention-full is not set")
+			return 0, nil
+		})
+
+		if _, err := exec([]string{"pgbackrest", "backup"}, ioutil.Discard, ioutil.Discard); err != nil {
+			t.Errorf("expected no error, got %v", err)
+		}
+	})
+
+	t.Run("transport error", func(t *testing.T) {
+		exec := withStderr(func(cmdStrs []string, stdout, stderr io.Writer) (int, error) {
+			fmt.Fprintln(stderr, "partial output")
+			return -1, &kubeapi.ExecTransportError{Pod: "hippo", Err: errors.New("connection reset")}
+		})
+
+		if _, err := exec([]string{"pgbackrest", "backup"}, ioutil.Discard, ioutil.Discard); !kubeapi.IsExecTransportError(err) {
+			t.Errorf("expected a transport error to be retried, got %v", err)
+		}
+	})
+}
+
+func TestNotifyContext(t *testing.T) {
+	t.Run("signal", func(t *testing.T) {
+		ctx, stop := notifyContext(context.Background(), syscall.SIGTERM)
+		defer stop()
+
+		started := make(chan struct{})
+		exec := func(cmdStrs []string, stdout, stderr io.Writer) (int, error) {
+			close(started)
+			select {
+			case <-ctx.Done():
+				return -1, fmt.Errorf("exec in pod hippo was aborted: %w", ctx.Err())
+			case <-time.After(5 * time.Second):
+				return 0, nil
+			}
+		}
+
+		go func() {
+			<-started
+			if err := syscall.Kill(os.Getpid(), syscall.SIGTERM); err != nil {
+				t.Errorf("expected no error, got %v", err)
+			}
+		}()
+
+		exitCode, err := runCommands([][]string{{"pgbackrest", "backup"}, {"pgbackrest", "info"}},
+			ioutil.Discard, ioutil.Discard, withRetries(ctx, exec, 2, time.Millisecond))
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("expected the command to be canceled, got %v", err)
+		}
+		if status := exitStatus(crv1.PgtaskBackrestBackup, exitCode, err); status != exitCodeCanceled {
+			t.Errorf("expected exit status %d, got %d", exitCodeCanceled, status)
+		}
+	})
+
+	t.Run("stop", func(t *testing.T) {
+		ctx, stop := notifyContext(context.Background(), syscall.SIGTERM)
+		stop()
+
+		if ctx.Err() == nil {
+			t.Error("expected the context to be canceled")
+		}
+	})
+}
+
+func TestExitStatus(t *testing.T) {
+	failure := errors.New("command terminated with exit code 41")
+
+	for _, tt := range []struct {
+		command  string
+		exitCode int
+		err      error
+		expected int
+	}{
+		{crv1.PgtaskBackrestBackup, 41, failure, 41},
+		{crv1.PgtaskBackrestCheck, 41, failure, 2},
+		{crv1.PgtaskBackrestStanzaCreate, 28, failure, 2},
+		{crv1.PgtaskBackrestBackup, -1, errors.New("unable to connect"), 2},
+		{crv1.PgtaskBackrestBackup, -1, fmt.Errorf("aborted: %w", context.DeadlineExceeded), 2},
+		{crv1.PgtaskBackrestBackup, -1, fmt.Errorf("aborted: %w", context.Canceled), exitCodeCanceled},
+		{crv1.PgtaskBackrestCheck, -1, fmt.Errorf("aborted: %w", context.Canceled), exitCodeCanceled},
+	} {
+		if actual := exitStatus(tt.command, tt.exitCode, tt.err); actual != tt.expected {
+			t.Errorf("expected %d for %q, %d and %v, got %d", tt.expected, tt.command, tt.exitCode, tt.err, actual)
+		}
+	}
+}
+
+func TestTolerateExistingStanza(t *testing.T) {
+	failure := errors.New("command terminated with exit code 28")
+	failing := func(message string) execFunc {
+		return func(cmdStrs []string, stdout, stderr io.Writer) (int, error) {
+			fmt.Fprintln(stderr, message)
+			return 28, failure
+		}
+	}
+
+	t.Run("already exists", func(t *testing.T) {
+		exec := tolerateExistingStanza(failing("INFO: stanza 'db' already exists and is valid"))
+
+		var stderr strings.Builder
+		exitCode, err := exec([]string{"pgbackrest", "stanza-create", "--stanza=db"}, ioutil.Discard, &stderr)
+		if exitCode != 0 || err != nil {
+			t.Errorf("expected success, got %d and %v", exitCode, err)
+		}
+		if !strings.Contains(stderr.String(), "already exists") {
+			t.Errorf("expected stderr to be passed along, got %q", stderr.String())
+		}
+	})
+
+	t.Run("other failure", func(t *testing.T) {
+		exec := tolerateExistingStanza(failing("ERROR: [028]: backup and archive info files exist but do not match the database"))
+
+		exitCode, err := exec([]string{"pgbackrest", "stanza-create", "--stanza=db"}, ioutil.Discard, ioutil.Discard)
+		if exitCode != 28 || err != failure {
+			t.Errorf("expected the failure, got %d and %v", exitCode, err)
+		}
+		if status := exitStatus(crv1.PgtaskBackrestStanzaCreate, exitCode, err); status != 2 {
+			t.Errorf("expected exit status 2, got %d", status)
+		}
+	})
+
+	t.Run("other command", func(t *testing.T) {
+		exec := tolerateExistingStanza(failing("INFO: stanza 'db' already exists and is valid"))
+
+		if _, err := exec([]string{"pgbackrest", "check", "--stanza=db"}, ioutil.Discard, ioutil.Discard); err != failure {
+			t.Errorf("expected the failure of check, got %v", err)
+		}
+	})
+
+	t.Run("transport error", func(t *testing.T) {
+		exec := tolerateExistingStanza(func(cmdStrs []string, stdout, stderr io.Writer) (int, error) {
+			fmt.Fprintln(stderr, "stanza already exists")
+			return -1, &kubeapi.ExecTransportError{Pod: "hippo", Err: errors.New("connection reset")}
+		})
+
+		if _, err := exec([]string{"pgbackrest", "stanza-create"}, ioutil.Discard, ioutil.Discard); err == nil {
+			t.Error("expected the transport error")
+		}
+	})
+}
+
+func TestSplitCommandOpts(t *testing.T) {
+	for _, tt := range []struct {
+		opts     string
+		expected []string
+	}{
+		{"", []string{}},
+		{"  --stanza=db   --type=full ", []string{"--stanza=db", "--type=full"}},
+		{`--annotation=label="nightly backup"`, []string{"--annotation=label=nightly backup"}},
+		{`--target='2020-06-01 12:00:00+00'`, []string{"--target=2020-06-01 12:00:00+00"}},
+		{`--annotation="it's \"quoted\""`, []string{`--annotation=it's "quoted"`}},
+		{`--annotation='say "hi"'`, []string{`--annotation=say "hi"`}},
+		{`--stanza=db; rm -rf /`, []string{"--stanza=db;", "rm", "-rf", "/"}},
+		{`--stanza=db\;reboot $(id) && true`, []string{"--stanza=db;reboot", "$(id)", "&&", "true"}},
+		{`--path=/some\ dir ''`, []string{"--path=/some dir", ""}},
+	} {
+		actual, err := splitCommandOpts(tt.opts)
+		if err != nil {
+			t.Errorf("expected no error for %q, got %v", tt.opts, err)
+		}
+		if !reflect.DeepEqual(tt.expected, actual) {
+			t.Errorf("expected %q for %q, got %q", tt.expected, tt.opts, actual)
+		}
+	}
+
+	for _, opts := range []string{`--target='2020`, `--annotation="x`, `--stanza=db\`} {
+		if _, err := splitCommandOpts(opts); err == nil {
+			t.Errorf("expected an error for %q", opts)
+		}
+	}
+}
+
+func TestBuildCommandsLiteralOpts(t *testing.T) {
+	commands, err := buildCommands(crv1.PgtaskBackrestBackup,
+		`--stanza=db --annotation=note="a; b" --type=full;reboot`, commandSettings{}, legacyRepoTargets("s3", nil))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	expected := [][]string{{
+		"pgbackrest", "backup", "--stanza=db", "--annotation=note=a; b", "--type=full;reboot", "--repo-type=s3",
+	}}
+	if !reflect.DeepEqual(expected, commands) {
+		t.Errorf("expected %q, got %q", expected, commands)
+	}
+}
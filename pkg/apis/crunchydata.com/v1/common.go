@@ -20,6 +20,7 @@ import (
 	"strings"
 
 	log "github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 // RootSecretSuffix ...
@@ -91,6 +92,37 @@ type PgStorageSpec struct {
 	StorageType        string `json:"storagetype"`
 	SupplementalGroups string `json:"supplementalgroups"`
 	MatchLabels        string `json:"matchLabels"`
+	// Selector allows a PVC to be bound to a PV using set-based requirements
+	// in addition to any MatchLabels
+	Selector *metav1.LabelSelector `json:"selector,omitempty"`
+	// Annotations and Labels are added to any PVC created from this spec. Labels
+	// that are managed by the Operator cannot be overridden
+	Annotations map[string]string `json:"annotations,omitempty"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	// OwnedByCluster causes a PVC created from this spec to be owned by its
+	// Pgcluster so that it is garbage collected along with the cluster
+	OwnedByCluster bool `json:"ownedByCluster,omitempty"`
+	// VolumeMode is either "Filesystem" or "Block". When empty, the default
+	// of Kubernetes, "Filesystem", is used
+	VolumeMode string `json:"volumeMode,omitempty"`
+	// DataSource is the name of a VolumeSnapshot used to populate a PVC created
+	// from this spec. It only applies to the "create" and "dynamic" types
+	DataSource string `json:"dataSource,omitempty"`
+	// SizeLimit is an optional upper bound on the storage of a PVC created from
+	// this spec. When set, it must not be less than Size
+	SizeLimit string `json:"sizeLimit,omitempty"`
+	// RetainOnDelete keeps a PVC created from this spec when its cluster is
+	// deleted. The Operator will not delete the PVC, though it can still be
+	// deleted by hand
+	RetainOnDelete bool `json:"retainOnDelete,omitempty"`
+	// FSGroup is the group that should own the volume of this spec once it is
+	// mounted, for storage drivers that honor securityContext.fsGroup. When nil,
+	// the fsGroup of the pod is left as it is
+	FSGroup *int64 `json:"fsGroup,omitempty"`
+	// ReadOnly mounts the volume of an "existing" spec read-only, e.g. to
+	// validate a restored volume without writing to it. It is ignored for any
+	// other type
+	ReadOnly bool `json:"readOnly,omitempty"`
 }
 
 // GetSupplementalGroups converts the comma-separated list of SupplementalGroups
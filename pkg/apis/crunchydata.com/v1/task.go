@@ -54,10 +54,15 @@ const PgtaskWorkflowCloneRestoreBackup = "clone 2: restoring backup"
 const PgtaskWorkflowCloneClusterCreate = "clone 3: cluster creating"
 
 const PgtaskBackrest = "backrest"
+const PgtaskBackrestArchiveGet = "archive-get"
+const PgtaskBackrestArchivePush = "archive-push"
 const PgtaskBackrestBackup = "backup"
+const PgtaskBackrestCheck = "check"
+const PgtaskBackrestExpire = "expire"
 const PgtaskBackrestInfo = "info"
 const PgtaskBackrestRestore = "restore"
 const PgtaskBackrestStanzaCreate = "stanza-create"
+const PgtaskBackrestStanzaDelete = "stanza-delete"
 
 const PgtaskpgDump = "pgdump"
 const PgtaskpgDumpBackup = "pgdumpbackup"
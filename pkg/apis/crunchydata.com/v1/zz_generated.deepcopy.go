@@ -21,6 +21,7 @@ package v1
 
 import (
 	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
 )
 
@@ -57,6 +58,30 @@ func (in *PgBouncerSpec) DeepCopy() *PgBouncerSpec {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *PgStorageSpec) DeepCopyInto(out *PgStorageSpec) {
 	*out = *in
+	if in.Selector != nil {
+		in, out := &in.Selector, &out.Selector
+		*out = new(metav1.LabelSelector)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Annotations != nil {
+		in, out := &in.Annotations, &out.Annotations
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.Labels != nil {
+		in, out := &in.Labels, &out.Labels
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.FSGroup != nil {
+		in, out := &in.FSGroup, &out.FSGroup
+		*out = new(int64)
+		**out = **in
+	}
 	return
 }
 
@@ -134,11 +159,11 @@ func (in *PgclusterList) DeepCopyObject() runtime.Object {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *PgclusterSpec) DeepCopyInto(out *PgclusterSpec) {
 	*out = *in
-	out.PrimaryStorage = in.PrimaryStorage
-	out.WALStorage = in.WALStorage
-	out.ArchiveStorage = in.ArchiveStorage
-	out.ReplicaStorage = in.ReplicaStorage
-	out.BackrestStorage = in.BackrestStorage
+	in.PrimaryStorage.DeepCopyInto(&out.PrimaryStorage)
+	in.WALStorage.DeepCopyInto(&out.WALStorage)
+	in.ArchiveStorage.DeepCopyInto(&out.ArchiveStorage)
+	in.ReplicaStorage.DeepCopyInto(&out.ReplicaStorage)
+	in.BackrestStorage.DeepCopyInto(&out.BackrestStorage)
 	if in.Resources != nil {
 		in, out := &in.Resources, &out.Resources
 		*out = make(corev1.ResourceList, len(*in))
@@ -185,7 +210,7 @@ func (in *PgclusterSpec) DeepCopyInto(out *PgclusterSpec) {
 		in, out := &in.TablespaceMounts, &out.TablespaceMounts
 		*out = make(map[string]PgStorageSpec, len(*in))
 		for key, val := range *in {
-			(*out)[key] = val
+			(*out)[key] = *val.DeepCopy()
 		}
 	}
 	out.TLS = in.TLS
@@ -375,7 +400,7 @@ func (in *PgreplicaList) DeepCopyObject() runtime.Object {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *PgreplicaSpec) DeepCopyInto(out *PgreplicaSpec) {
 	*out = *in
-	out.ReplicaStorage = in.ReplicaStorage
+	in.ReplicaStorage.DeepCopyInto(&out.ReplicaStorage)
 	if in.UserLabels != nil {
 		in, out := &in.UserLabels, &out.UserLabels
 		*out = make(map[string]string, len(*in))
@@ -476,7 +501,7 @@ func (in *PgtaskList) DeepCopyObject() runtime.Object {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *PgtaskSpec) DeepCopyInto(out *PgtaskSpec) {
 	*out = *in
-	out.StorageSpec = in.StorageSpec
+	in.StorageSpec.DeepCopyInto(&out.StorageSpec)
 	if in.Parameters != nil {
 		in, out := &in.Parameters, &out.Parameters
 		*out = make(map[string]string, len(*in))